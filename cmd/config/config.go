@@ -3,13 +3,20 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type AppConfig struct {
-	Database DatabaseSection `yaml:"database"`
-	App      AppSection      `yaml:"application"`
+	Database    DatabaseSection    `yaml:"database"`
+	App         AppSection         `yaml:"application"`
+	Notes       NotesSection       `yaml:"notes"`
+	Idempotency IdempotencySection `yaml:"idempotency"`
+	Reminders   RemindersSection   `yaml:"reminders"`
+	Collab      CollabSection      `yaml:"collab"`
+	Events      EventsSection      `yaml:"events"`
+	Attachments AttachmentsSection `yaml:"attachments"`
 }
 
 type DatabaseSection struct {
@@ -25,6 +32,95 @@ type AppSection struct {
 	JWTKey string `yaml:"jwtkey"`
 }
 
+type NotesSection struct {
+	Revisions      RevisionsSection `yaml:"revisions"`
+	RequireIfMatch bool             `yaml:"require_if_match"`
+	Trash          TrashSection     `yaml:"trash"`
+	Bulk           BulkSection      `yaml:"bulk"`
+}
+
+type TrashSection struct {
+	RetentionDays int           `yaml:"retention_days"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+type BulkSection struct {
+	MaxOperations int `yaml:"max_operations"`
+}
+
+type IdempotencySection struct {
+	TTL             time.Duration `yaml:"ttl"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	MaxBodySize     int64         `yaml:"max_body_size"`
+}
+
+type RemindersSection struct {
+	Interval  time.Duration    `yaml:"interval"`
+	BatchSize int              `yaml:"batch_size"`
+	Notifiers NotifiersSection `yaml:"notifiers"`
+}
+
+type NotifiersSection struct {
+	Log     bool           `yaml:"log"`
+	SMTP    SMTPSection    `yaml:"smtp"`
+	Webhook WebhookSection `yaml:"webhook"`
+}
+
+type SMTPSection struct {
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type WebhookSection struct {
+	URL     string        `yaml:"url"`
+	Secret  string        `yaml:"secret"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type CollabSection struct {
+	PersistInterval time.Duration `yaml:"persist_interval"`
+}
+
+type EventsSection struct {
+	Heartbeat       time.Duration `yaml:"heartbeat"`
+	Retention       time.Duration `yaml:"retention"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+type AttachmentsSection struct {
+	Store           string            `yaml:"store"`
+	MaxSize         int64             `yaml:"max_size"`
+	CleanupInterval time.Duration     `yaml:"cleanup_interval"`
+	Local           LocalSection      `yaml:"local"`
+	S3              S3Section         `yaml:"s3"`
+	Thumbnails      ThumbnailsSection `yaml:"thumbnails"`
+}
+
+type ThumbnailsSection struct {
+	Size     int           `yaml:"size"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type LocalSection struct {
+	Path string `yaml:"path"`
+}
+
+type S3Section struct {
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"`
+}
+
+type RevisionsSection struct {
+	KeepLast int `yaml:"keep_last"`
+	KeepDays int `yaml:"keep_days"`
+}
+
 func GetConfig() (*AppConfig, error) {
 	yamlFile, err := os.ReadFile("config/config.yaml")
 	if err != nil {
@@ -2,15 +2,31 @@ package main
 
 import (
 	"NotesService/cmd/config"
+	"NotesService/internal/attachments"
+	"NotesService/internal/collab"
+	"NotesService/internal/comments"
+	"NotesService/internal/events"
+	"NotesService/internal/idempotency"
 	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"NotesService/internal/publiclinks"
+	"NotesService/internal/reminders"
 	"NotesService/internal/service"
+	"NotesService/internal/templates"
 	"NotesService/internal/users"
+	"NotesService/internal/workspaces"
+	"NotesService/pkg/blob"
 	"NotesService/pkg/logs"
+	"NotesService/pkg/notify"
+	"context"
+	"fmt"
+	_ "time/tzdata"
 
 	"github.com/golang-jwt/jwt/v5"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
@@ -22,6 +38,7 @@ func main() {
 	}
 
 	router := echo.New()
+	router.Use(middleware.Recover())
 	appConf, err := config.GetConfig()
 	if err != nil {
 		logger.Fatal(err)
@@ -29,27 +46,188 @@ func main() {
 
 	notesDbRepository := notes.NewNotesDbRepository(db)
 	usersDbRepository := users.NewUsersDbRepository(db)
-	svc := service.NewService(logger, notesDbRepository, usersDbRepository)
+	templatesDbRepository := templates.NewTemplatesDbRepository(db)
+	remindersDbRepository := reminders.NewRemindersDbRepository(db)
+	idempotencyDbRepository := idempotency.NewIdempotencyDbRepository(db)
+	publicLinksDbRepository := publiclinks.NewPublicLinksDbRepository(db)
+	workspacesDbRepository := workspaces.NewWorkspacesDbRepository(db)
+	commentsDbRepository := comments.NewCommentsDbRepository(db)
+	notificationsDbRepository := notifications.NewNotificationsDbRepository(db)
+	collabDbRepository := collab.NewCollabDbRepository(db)
+	collabBroker := collab.NewPgBroker(db, PostgresConnectionString(*appConf))
+	eventsDbRepository := events.NewEventsDbRepository(db, PostgresConnectionString(*appConf))
+	attachmentsDbRepository := attachments.NewAttachmentsDbRepository(db)
+	blobStore, err := newBlobStore(appConf.Attachments)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	svc := service.NewService(
+		logger,
+		notesDbRepository,
+		usersDbRepository,
+		service.WithRevisionRetention(
+			appConf.Notes.Revisions.KeepLast,
+			appConf.Notes.Revisions.KeepDays),
+		service.WithRequireIfMatch(appConf.Notes.RequireIfMatch),
+		service.WithBulkLimit(appConf.Notes.Bulk.MaxOperations),
+		service.WithTemplates(templatesDbRepository),
+		service.WithReminders(remindersDbRepository, newNotifier(appConf.Reminders.Notifiers, logger)),
+		service.WithIdempotency(idempotencyDbRepository, appConf.Idempotency.TTL, appConf.Idempotency.MaxBodySize),
+		service.WithPublicLinks(publicLinksDbRepository),
+		service.WithWorkspaces(workspacesDbRepository),
+		service.WithComments(commentsDbRepository),
+		service.WithNotifications(notificationsDbRepository),
+		service.WithCollab(collabDbRepository, collabBroker),
+		service.WithEvents(eventsDbRepository, appConf.Events.Heartbeat),
+		service.WithAttachments(attachmentsDbRepository, blobStore, appConf.Attachments.MaxSize),
+		service.WithThumbnailSize(appConf.Attachments.Thumbnails.Size))
+
+	trash := appConf.Notes.Trash
+	if trash.RetentionDays > 0 && trash.PurgeInterval > 0 {
+		go svc.RunTrashPurge(context.Background(), trash.PurgeInterval, trash.RetentionDays)
+		logger.Info("Trash purge started")
+	}
+
+	if appConf.Reminders.Interval > 0 {
+		go svc.RunReminderScheduler(context.Background(), appConf.Reminders.Interval, appConf.Reminders.BatchSize)
+		logger.Info("Reminder scheduler started")
+	}
+
+	if appConf.Idempotency.CleanupInterval > 0 {
+		go svc.RunIdempotencyCleanup(context.Background(), appConf.Idempotency.CleanupInterval)
+		logger.Info("Idempotency keys cleanup started")
+	}
+
+	go svc.RunEventsListener(context.Background())
+	if appConf.Events.Retention > 0 && appConf.Events.CleanupInterval > 0 {
+		go svc.RunEventsCleanup(context.Background(), appConf.Events.CleanupInterval, appConf.Events.Retention)
+		logger.Info("Note events cleanup started")
+	}
+
+	if appConf.Attachments.CleanupInterval > 0 {
+		go svc.RunAttachmentsCleanup(context.Background(), appConf.Attachments.CleanupInterval)
+		logger.Info("Attachments cleanup started")
+	}
+	if appConf.Attachments.Thumbnails.Interval > 0 {
+		go svc.RunThumbnails(context.Background(), appConf.Attachments.Thumbnails.Interval)
+		logger.Info("Thumbnail generation started")
+	}
+
+	go svc.RunCollab(context.Background(), appConf.Collab.PersistInterval)
+	logger.Info("Collaborative editing started")
 
 	router.POST("/login", svc.Login)
 	router.POST("/register", svc.Register)
 	logger.Info("Authorization routes configured successfully")
 
+	router.GET("/calendar/:file", svc.GetCalendar)
+	router.GET("/s/:token", svc.GetPublicNote)
+
 	api := router.Group("api")
 	jwtKey := []byte(appConf.App.JWTKey)
+	newClaims := func(c echo.Context) jwt.Claims {
+		return new(service.Claims)
+	}
+	// Browsers cannot set headers on WebSockets and EventSources, so their
+	// routes also take the token from the query or a cookie.
+	streamRoutes := map[string]bool{"/api/events": true, "/api/note/:id/collab": true}
+	streamAuth := echojwt.WithConfig(echojwt.Config{
+		SigningKey:    jwtKey,
+		TokenLookup:   "header:Authorization,query:access_token,cookie:access_token",
+		NewClaimsFunc: newClaims,
+	})
 	api.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey:  jwtKey,
-		TokenLookup: "header:Authorization",
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(service.Claims)
+		Skipper: func(c echo.Context) bool {
+			return streamRoutes[c.Path()]
 		},
+		SigningKey:    jwtKey,
+		TokenLookup:   "header:Authorization",
+		NewClaimsFunc: newClaims,
 	}))
+	api.Use(svc.Idempotency)
 
+	api.GET("/events", svc.StreamEvents, streamAuth)
+	api.GET("/sync", svc.GetSync)
+	api.POST("/sync", svc.PostSync)
 	api.GET("/notes", svc.GetUserNotes)
+	api.POST("/notes/bulk", svc.BulkNotes)
+	api.GET("/tasks", svc.GetTasks)
+	api.GET("/graph", svc.GetGraph)
+	api.GET("/links/dangling", svc.GetDanglingLinks)
+	api.GET("/shared", svc.GetSharedNotes)
 	api.GET("/note/:id", svc.GetNote)
 	api.POST("/note", svc.CreateNote)
+	api.POST("/note/from-template/:id", svc.CreateNoteFromTemplate)
 	api.PUT("/note/:id", svc.UpdateNote)
+	api.PATCH("/note/:id", svc.PatchNote)
 	api.DELETE("/note/:id", svc.DeleteNote)
+	api.GET("/note/:id/render", svc.RenderNote)
+	api.GET("/note/:id/tasks", svc.GetNoteTasks)
+	api.GET("/note/:id/backlinks", svc.GetBacklinks)
+	api.GET("/note/:id/shares", svc.GetNoteShares)
+	api.PUT("/note/:id/shares", svc.ShareNote)
+	api.DELETE("/note/:id/shares/:user", svc.UnshareNote)
+	api.GET("/note/:id/links", svc.GetPublicLinks)
+	api.POST("/note/:id/links", svc.CreatePublicLink)
+	api.POST("/note/:id/transfer", svc.TransferNote)
+	api.GET("/note/:id/collab", svc.CollabNote, streamAuth)
+	api.GET("/note/:id/comments", svc.GetComments)
+	api.POST("/note/:id/comments", svc.CreateComment)
+	api.GET("/note/:id/attachments", svc.GetAttachments)
+	api.POST("/note/:id/attachments", svc.UploadAttachment)
+	api.GET("/note/:id/reminders", svc.GetNoteReminders)
+	api.POST("/note/:id/reminders", svc.CreateReminder)
+	api.PATCH("/note/:id/tasks/:index", svc.UpdateNoteTask)
+	api.GET("/note/:id/revisions", svc.GetNoteRevisions)
+	api.GET("/note/:id/revisions/diff", svc.DiffNoteRevisions)
+	api.POST("/note/:id/revisions/:rev/restore", svc.RestoreNoteRevision)
+	api.POST("/note/:id/restore", svc.RestoreNote)
+	api.PUT("/note/:id/pin", svc.PinNote)
+	api.DELETE("/note/:id/pin", svc.UnpinNote)
+	api.PUT("/note/:id/archive", svc.ArchiveNote)
+	api.DELETE("/note/:id/archive", svc.UnarchiveNote)
+	api.PUT("/note/:id/favorite", svc.FavoriteNote)
+	api.DELETE("/note/:id/favorite", svc.UnfavoriteNote)
+	api.GET("/daily", svc.GetDailyNotes)
+	api.GET("/daily/:date", svc.GetDailyNote)
+	api.GET("/templates", svc.GetTemplates)
+	api.GET("/template/:id", svc.GetTemplate)
+	api.POST("/template", svc.CreateTemplate)
+	api.PUT("/template/:id", svc.UpdateTemplate)
+	api.DELETE("/template/:id", svc.DeleteTemplate)
+	api.GET("/reminders", svc.GetReminders)
+	api.DELETE("/reminder/:id", svc.DeleteReminder)
+	api.DELETE("/link/:id", svc.RevokePublicLink)
+	api.GET("/attachment/:id", svc.DownloadAttachment)
+	api.DELETE("/attachment/:id", svc.DeleteAttachment)
+	api.GET("/attachment/:id/thumbnail", svc.GetThumbnail)
+	api.PUT("/comment/:id", svc.UpdateComment)
+	api.DELETE("/comment/:id", svc.DeleteComment)
+	api.PUT("/comment/:id/resolve", svc.ResolveComment)
+	api.DELETE("/comment/:id/resolve", svc.UnresolveComment)
+	api.GET("/notifications", svc.GetNotifications)
+	api.PUT("/notifications/read", svc.MarkAllNotificationsRead)
+	api.PUT("/notification/:id/read", svc.MarkNotificationRead)
+	api.GET("/workspaces", svc.GetWorkspaces)
+	api.POST("/workspace", svc.CreateWorkspace)
+	api.DELETE("/workspace/:id", svc.DeleteWorkspace)
+	api.GET("/workspace/:id/members", svc.GetWorkspaceMembers)
+	api.PUT("/workspace/:id/members/:user", svc.UpdateWorkspaceMember)
+	api.DELETE("/workspace/:id/members/:user", svc.RemoveWorkspaceMember)
+	api.GET("/workspace/:id/invitations", svc.GetWorkspaceInvitations)
+	api.POST("/workspace/:id/invitations", svc.InviteToWorkspace)
+	api.GET("/invitations", svc.GetInvitations)
+	api.POST("/invitation/:id/accept", svc.AcceptInvitation)
+	api.POST("/invitation/:id/decline", svc.DeclineInvitation)
+	api.GET("/trash", svc.GetTrash)
+	api.DELETE("/trash", svc.EmptyTrash)
+	api.PUT("/user/timezone", svc.UpdateTimeZone)
+	api.PUT("/user/daily-template", svc.UpdateDailyTemplate)
+	api.PUT("/user/workspace", svc.SwitchWorkspace)
+	api.GET("/user/notification-preferences", svc.GetNotificationPreferences)
+	api.PUT("/user/notification-preferences", svc.UpdateNotificationPreferences)
+	api.POST("/user/calendar-token", svc.RegenerateCalendarToken)
+	api.DELETE("/user/calendar-token", svc.DeleteCalendarToken)
 	logger.Info("Api routes configured successfully")
 
 	port := appConf.App.Port
@@ -57,3 +235,45 @@ func main() {
 	logger.Info("Starting application...")
 	router.Logger.Fatal(router.Start(":" + port))
 }
+
+// newNotifier combines the notifiers enabled in the configuration.
+func newNotifier(conf config.NotifiersSection, logger echo.Logger) notify.Notifier {
+	var notifiers notify.Multi
+	if conf.Log {
+		notifiers = append(notifiers, notify.Named{Name: "log", Notifier: notify.NewLogNotifier(logger)})
+	}
+	if conf.SMTP.Addr != "" {
+		notifiers = append(notifiers, notify.Named{Name: "smtp", Notifier: notify.NewSMTPNotifier(
+			conf.SMTP.Addr,
+			conf.SMTP.From,
+			conf.SMTP.Username,
+			conf.SMTP.Password)})
+	}
+	if conf.Webhook.URL != "" {
+		notifiers = append(notifiers, notify.Named{Name: "webhook", Notifier: notify.NewWebhookNotifier(
+			conf.Webhook.URL,
+			conf.Webhook.Secret,
+			conf.Webhook.Timeout)})
+	}
+
+	return notifiers
+}
+
+// newBlobStore opens the store of attachment contents chosen in the
+// configuration.
+func newBlobStore(conf config.AttachmentsSection) (blob.Store, error) {
+	switch conf.Store {
+	case "", "local":
+		return blob.NewLocalStore(conf.Local.Path)
+	case "s3":
+		return blob.NewS3Store(
+			conf.S3.Endpoint,
+			conf.S3.Bucket,
+			conf.S3.Region,
+			conf.S3.AccessKey,
+			conf.S3.SecretKey,
+			conf.S3.PathStyle)
+	}
+
+	return nil, fmt.Errorf("unknown attachments store %q", conf.Store)
+}
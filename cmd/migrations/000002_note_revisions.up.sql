@@ -0,0 +1,12 @@
+CREATE TABLE note_revisions (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (note_id, revision)
+);
+
+INSERT INTO note_revisions (note_id, revision, title, body, created_at)
+SELECT id, 1, title, body, created_at FROM notes;
@@ -0,0 +1,3 @@
+ALTER TABLE notes ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX notes_deleted_at_idx ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS pinned,
+    DROP COLUMN IF EXISTS pinned_at,
+    DROP COLUMN IF EXISTS archived,
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS favorite,
+    DROP COLUMN IF EXISTS favorited_at;
@@ -0,0 +1,7 @@
+ALTER TABLE notes
+    ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN pinned_at TIMESTAMP,
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN archived_at TIMESTAMP,
+    ADD COLUMN favorite BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN favorited_at TIMESTAMP;
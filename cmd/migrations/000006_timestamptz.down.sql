@@ -0,0 +1,20 @@
+DROP TRIGGER IF EXISTS notes_set_updated_at ON notes;
+
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+
+DROP FUNCTION IF EXISTS set_updated_at();
+
+ALTER TABLE note_revisions ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS updated_at,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN deleted_at TYPE TIMESTAMP,
+    ALTER COLUMN pinned_at TYPE TIMESTAMP,
+    ALTER COLUMN archived_at TYPE TIMESTAMP,
+    ALTER COLUMN favorited_at TYPE TIMESTAMP;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS time_zone,
+    DROP COLUMN IF EXISTS updated_at,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
@@ -0,0 +1,39 @@
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ADD COLUMN updated_at TIMESTAMPTZ,
+    ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
+
+UPDATE users SET updated_at = created_at;
+
+ALTER TABLE users
+    ALTER COLUMN updated_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE notes
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN deleted_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN pinned_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN archived_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN favorited_at TYPE TIMESTAMPTZ,
+    ADD COLUMN updated_at TIMESTAMPTZ;
+
+UPDATE notes SET updated_at = created_at;
+
+ALTER TABLE notes
+    ALTER COLUMN updated_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE note_revisions ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+CREATE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_set_updated_at BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER notes_set_updated_at BEFORE UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
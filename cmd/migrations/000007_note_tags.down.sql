@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notes_tags_idx;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS tags;
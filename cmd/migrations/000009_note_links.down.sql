@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS notes_user_id_title_idx;
+DROP TABLE IF EXISTS note_links;
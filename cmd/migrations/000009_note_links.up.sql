@@ -0,0 +1,15 @@
+CREATE TABLE note_links (
+    source_note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    target_title TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX note_links_source_target_idx ON note_links (source_note_id, lower(target_title));
+CREATE INDEX note_links_target_title_idx ON note_links (lower(target_title));
+CREATE INDEX notes_user_id_title_idx ON notes (user_id, lower(title));
+
+-- Links in code blocks are picked up here as well; they are dropped the next
+-- time the note is saved.
+INSERT INTO note_links (source_note_id, target_title)
+SELECT DISTINCT ON (id, lower(trim(link[1]))) id, trim(link[1])
+FROM notes, regexp_matches(body, '\[\[([^][|\r\n]+)(?:\|[^][\r\n]*)?\]\]', 'g') AS link
+WHERE trim(link[1]) <> '';
@@ -0,0 +1,13 @@
+CREATE TABLE note_templates (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TRIGGER note_templates_set_updated_at BEFORE UPDATE ON note_templates
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN IF EXISTS daily_template_id;
+
+DROP INDEX IF EXISTS notes_user_id_daily_date_idx;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS daily_date;
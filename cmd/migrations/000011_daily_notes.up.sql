@@ -0,0 +1,5 @@
+ALTER TABLE notes ADD COLUMN daily_date DATE;
+
+CREATE UNIQUE INDEX notes_user_id_daily_date_idx ON notes (user_id, daily_date);
+
+ALTER TABLE users ADD COLUMN daily_template_id INT REFERENCES note_templates(id) ON DELETE SET NULL;
@@ -0,0 +1,21 @@
+CREATE TABLE reminders (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    remind_at TIMESTAMPTZ NOT NULL,
+    rrule TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT 'UTC',
+    due_at TIMESTAMPTZ,
+    retry_at TIMESTAMPTZ,
+    attempts INT NOT NULL DEFAULT 0,
+    last_fired_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX reminders_note_id_idx ON reminders (note_id);
+CREATE INDEX reminders_fire_at_idx ON reminders ((COALESCE(retry_at, due_at)))
+    WHERE due_at IS NOT NULL;
+
+CREATE TRIGGER reminders_set_updated_at BEFORE UPDATE ON reminders
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
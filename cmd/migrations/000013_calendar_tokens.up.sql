@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN calendar_token_hash TEXT;
+
+CREATE UNIQUE INDEX users_calendar_token_hash_idx ON users (calendar_token_hash);
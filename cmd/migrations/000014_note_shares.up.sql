@@ -0,0 +1,13 @@
+CREATE TABLE note_shares (
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (note_id, user_id)
+);
+
+CREATE INDEX note_shares_user_id_idx ON note_shares (user_id);
+
+CREATE TRIGGER note_shares_set_updated_at BEFORE UPDATE ON note_shares
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,14 @@
+CREATE TABLE public_links (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    password_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    max_views INT CHECK (max_views > 0),
+    views INT NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX public_links_note_id_idx ON public_links (note_id);
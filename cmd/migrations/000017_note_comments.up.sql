@@ -0,0 +1,18 @@
+CREATE TABLE note_comments (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES note_comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    anchor_start INT,
+    anchor_end INT,
+    anchor_quote TEXT,
+    resolved_at TIMESTAMPTZ,
+    resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    edited_at TIMESTAMPTZ,
+    CHECK (anchor_start IS NULL OR (anchor_start >= 0 AND anchor_end > anchor_start))
+);
+
+CREATE INDEX note_comments_note_id_idx ON note_comments (note_id, created_at) WHERE parent_id IS NULL;
+CREATE INDEX note_comments_parent_id_idx ON note_comments (parent_id);
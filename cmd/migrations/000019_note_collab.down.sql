@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_operations;
+DROP TABLE IF EXISTS note_collab_states;
@@ -0,0 +1,16 @@
+CREATE TABLE note_collab_states (
+    note_id INT PRIMARY KEY REFERENCES notes(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    version INT NOT NULL,
+    body TEXT NOT NULL
+);
+
+CREATE TABLE note_operations (
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    client_id TEXT NOT NULL,
+    operation JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (note_id, revision)
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS notes_log_event ON notes;
+DROP FUNCTION IF EXISTS log_note_event();
+DROP TABLE IF EXISTS note_events;
@@ -0,0 +1,56 @@
+-- The events outlive their notes, users and workspaces: deleting those
+-- deletes notes, which is logged. Old events are cleaned up instead.
+CREATE TABLE note_events (
+    id BIGSERIAL PRIMARY KEY,
+    note_id INT NOT NULL,
+    user_id INT NOT NULL,
+    workspace_id INT,
+    type TEXT NOT NULL CHECK (type IN ('created', 'updated', 'deleted')),
+    version INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_events_user_id_idx ON note_events (user_id, id);
+CREATE INDEX note_events_note_id_idx ON note_events (note_id, id);
+CREATE INDEX note_events_workspace_id_idx ON note_events (workspace_id, id) WHERE workspace_id IS NOT NULL;
+CREATE INDEX note_events_created_at_idx ON note_events (created_at);
+
+-- Notes moved to the trash are reported as deleted and notes restored from
+-- it as created. Changes to notes in the trash are not reported.
+CREATE FUNCTION log_note_event() RETURNS TRIGGER AS $$
+DECLARE
+    note notes;
+    event_type TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        note := NEW;
+        event_type := 'created';
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.deleted_at IS NOT NULL THEN
+            RETURN OLD;
+        END IF;
+        note := OLD;
+        event_type := 'deleted';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        note := NEW;
+        event_type := 'deleted';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        note := NEW;
+        event_type := 'created';
+    ELSIF NEW.deleted_at IS NULL THEN
+        note := NEW;
+        event_type := 'updated';
+    ELSE
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO note_events (note_id, user_id, workspace_id, type, version)
+    VALUES (note.id, note.user_id, note.workspace_id, event_type, note.version);
+    PERFORM pg_notify('note_events', note.id::TEXT);
+
+    RETURN note;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_log_event AFTER INSERT OR UPDATE OR DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION log_note_event();
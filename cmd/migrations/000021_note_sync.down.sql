@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS notes_add_tombstone ON notes;
+DROP FUNCTION IF EXISTS add_note_tombstone();
+DROP TABLE IF EXISTS note_tombstones;
+
+DROP TRIGGER IF EXISTS notes_set_change_seq ON notes;
+DROP FUNCTION IF EXISTS set_change_seq();
+DROP INDEX IF EXISTS notes_workspace_id_change_seq_idx;
+DROP INDEX IF EXISTS notes_user_id_change_seq_idx;
+ALTER TABLE notes DROP COLUMN IF EXISTS change_seq;
+DROP SEQUENCE IF EXISTS note_change_seq;
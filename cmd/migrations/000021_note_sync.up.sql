@@ -0,0 +1,47 @@
+CREATE SEQUENCE note_change_seq;
+
+ALTER TABLE notes ADD COLUMN change_seq BIGINT;
+
+UPDATE notes SET change_seq = nextval('note_change_seq');
+
+ALTER TABLE notes
+    ALTER COLUMN change_seq SET DEFAULT nextval('note_change_seq'),
+    ALTER COLUMN change_seq SET NOT NULL;
+
+CREATE INDEX notes_user_id_change_seq_idx ON notes (user_id, change_seq);
+CREATE INDEX notes_workspace_id_change_seq_idx ON notes (workspace_id, change_seq) WHERE workspace_id IS NOT NULL;
+
+CREATE FUNCTION set_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.change_seq = nextval('note_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_set_change_seq BEFORE UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION set_change_seq();
+
+-- Tombstones remember notes deleted for good, so that syncing clients learn
+-- about it. Notes in the trash are still rows of notes.
+CREATE TABLE note_tombstones (
+    note_id INT PRIMARY KEY,
+    user_id INT NOT NULL,
+    workspace_id INT,
+    change_seq BIGINT NOT NULL DEFAULT nextval('note_change_seq'),
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_tombstones_user_id_change_seq_idx ON note_tombstones (user_id, change_seq);
+CREATE INDEX note_tombstones_workspace_id_change_seq_idx ON note_tombstones (workspace_id, change_seq) WHERE workspace_id IS NOT NULL;
+
+CREATE FUNCTION add_note_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO note_tombstones (note_id, user_id, workspace_id)
+    VALUES (OLD.id, OLD.user_id, OLD.workspace_id)
+    ON CONFLICT (note_id) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_add_tombstone AFTER DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION add_note_tombstone();
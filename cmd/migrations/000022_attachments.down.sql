@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS note_attachments_sha256_idx;
+DROP INDEX IF EXISTS note_attachments_note_id_idx;
+DROP TABLE IF EXISTS note_attachments;
+DROP TABLE IF EXISTS blobs;
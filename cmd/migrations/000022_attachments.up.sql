@@ -0,0 +1,24 @@
+-- Blobs are the contents of attachments, stored once per SHA-256 in the blob
+-- store. used_at keeps blobs just found by an upload from being cleaned up
+-- before the upload adds its attachment.
+CREATE TABLE blobs (
+    sha256 TEXT PRIMARY KEY,
+    size BIGINT NOT NULL,
+    content_type TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE note_attachments (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    sha256 TEXT NOT NULL REFERENCES blobs(sha256),
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_attachments_note_id_idx ON note_attachments (note_id, created_at);
+CREATE INDEX note_attachments_sha256_idx ON note_attachments (sha256);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS blobs_thumbnail_pending_idx;
+
+ALTER TABLE blobs
+    DROP COLUMN IF EXISTS thumbnail_height,
+    DROP COLUMN IF EXISTS thumbnail_width,
+    DROP COLUMN IF EXISTS thumbnail_size,
+    DROP COLUMN IF EXISTS thumbnail_content_type,
+    DROP COLUMN IF EXISTS thumbnail_attempts,
+    DROP COLUMN IF EXISTS thumbnail_status,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
@@ -0,0 +1,16 @@
+-- Images get their dimensions recorded on upload and a thumbnail made in
+-- the background. Blobs waiting for one are 'pending'.
+ALTER TABLE blobs
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN thumbnail_status TEXT CHECK (thumbnail_status IN ('pending', 'ready', 'failed')),
+    ADD COLUMN thumbnail_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN thumbnail_content_type TEXT,
+    ADD COLUMN thumbnail_size BIGINT,
+    ADD COLUMN thumbnail_width INT,
+    ADD COLUMN thumbnail_height INT;
+
+UPDATE blobs SET thumbnail_status = 'pending'
+WHERE content_type IN ('image/jpeg', 'image/png', 'image/gif');
+
+CREATE INDEX blobs_thumbnail_pending_idx ON blobs (created_at) WHERE thumbnail_status = 'pending';
@@ -0,0 +1,9 @@
+-- Deliveries remember the notifiers an occurrence of a reminder went out
+-- through, so that a retry only uses the ones that failed.
+CREATE TABLE reminder_deliveries (
+    reminder_id INT NOT NULL REFERENCES reminders(id) ON DELETE CASCADE,
+    due_at TIMESTAMPTZ NOT NULL,
+    channel TEXT NOT NULL,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (reminder_id, due_at, channel)
+);
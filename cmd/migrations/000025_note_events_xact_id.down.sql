@@ -0,0 +1 @@
+ALTER TABLE note_events DROP COLUMN IF EXISTS xact_id;
@@ -0,0 +1,4 @@
+-- Event ids are taken when an event is logged, not when it is committed, so
+-- a transaction that is still running may commit events with lower ids than
+-- ones already read. Readers use the transaction ids to hold those back.
+ALTER TABLE note_events ADD COLUMN xact_id xid8 NOT NULL DEFAULT pg_current_xact_id();
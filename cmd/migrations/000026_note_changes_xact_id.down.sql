@@ -0,0 +1,9 @@
+CREATE OR REPLACE FUNCTION set_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.change_seq = nextval('note_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE note_tombstones DROP COLUMN IF EXISTS xact_id;
+ALTER TABLE notes DROP COLUMN IF EXISTS xact_id;
@@ -0,0 +1,14 @@
+-- Change sequence numbers are taken when a note is written, not when the
+-- write is committed, so a transaction that is still running may commit
+-- changes with lower numbers than ones already synced. Readers use the
+-- transaction ids to hold those back.
+ALTER TABLE notes ADD COLUMN xact_id xid8 NOT NULL DEFAULT pg_current_xact_id();
+ALTER TABLE note_tombstones ADD COLUMN xact_id xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE OR REPLACE FUNCTION set_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.change_seq = nextval('note_change_seq');
+    NEW.xact_id = pg_current_xact_id();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,11 @@
+-- Client ids of the notes created by syncing clients, so that a retried
+-- upload returns the note instead of creating it again.
+CREATE TABLE sync_client_ids (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL,
+    note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE INDEX sync_client_ids_note_id_idx ON sync_client_ids (note_id);
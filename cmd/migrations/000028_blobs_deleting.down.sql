@@ -0,0 +1 @@
+ALTER TABLE blobs DROP COLUMN IF EXISTS deleting;
@@ -0,0 +1,3 @@
+-- Orphan blobs are marked before they are removed from the blob store, so a
+-- blob whose removal did not finish is stored again by the next upload.
+ALTER TABLE blobs ADD COLUMN deleting BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS blobs_location_pending_idx;
+
+ALTER TABLE blobs
+    DROP COLUMN IF EXISTS location_status,
+    DROP COLUMN IF EXISTS location_attempts;
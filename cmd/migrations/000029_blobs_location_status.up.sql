@@ -0,0 +1,10 @@
+-- Images uploaded before locations were stripped on upload are rewritten in
+-- the background. Blobs waiting for that are 'pending'.
+ALTER TABLE blobs
+    ADD COLUMN location_status TEXT CHECK (location_status IN ('pending', 'stripped', 'failed')),
+    ADD COLUMN location_attempts INT NOT NULL DEFAULT 0;
+
+UPDATE blobs SET location_status = 'pending'
+WHERE content_type IN ('image/jpeg', 'image/png');
+
+CREATE INDEX blobs_location_pending_idx ON blobs (created_at) WHERE location_status = 'pending';
@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS notes_leave_scope ON notes;
+
+CREATE OR REPLACE FUNCTION add_note_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO note_tombstones (note_id, user_id, workspace_id)
+    VALUES (OLD.id, OLD.user_id, OLD.workspace_id)
+    ON CONFLICT (note_id) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS note_tombstones_scope_idx;
+
+DELETE FROM note_tombstones t USING note_tombstones newer
+WHERE newer.note_id = t.note_id AND newer.change_seq > t.change_seq;
+
+ALTER TABLE note_tombstones ADD PRIMARY KEY (note_id);
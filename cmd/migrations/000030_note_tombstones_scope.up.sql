@@ -0,0 +1,24 @@
+-- Syncs only see the notes of one scope, the personal notes of a user or the
+-- notes of a workspace. A note moved to another scope gets a tombstone in
+-- the one it left, so a note may have several. Notes moved by the
+-- transaction that created them, as workspace notes are, never were in the
+-- scope they left.
+ALTER TABLE note_tombstones DROP CONSTRAINT note_tombstones_pkey;
+
+CREATE UNIQUE INDEX note_tombstones_scope_idx ON note_tombstones (note_id, user_id, COALESCE(workspace_id, 0));
+
+CREATE OR REPLACE FUNCTION add_note_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO note_tombstones (note_id, user_id, workspace_id)
+    VALUES (OLD.id, OLD.user_id, OLD.workspace_id)
+    ON CONFLICT (note_id, user_id, COALESCE(workspace_id, 0)) DO UPDATE
+    SET change_seq = nextval('note_change_seq'), xact_id = pg_current_xact_id(), deleted_at = NOW();
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_leave_scope AFTER UPDATE OF user_id, workspace_id ON notes
+    FOR EACH ROW
+    WHEN ((OLD.user_id <> NEW.user_id OR OLD.workspace_id IS DISTINCT FROM NEW.workspace_id)
+        AND OLD.xact_id <> pg_current_xact_id())
+    EXECUTE FUNCTION add_note_tombstone();
@@ -25,15 +25,7 @@ func PostgresConnection() (*sql.DB, error) {
 		return nil, err
 	}
 
-	connectionString := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		config.Database.Host,
-		config.Database.Port,
-		config.Database.User,
-		config.Database.Password,
-		config.Database.Name)
-
-	db, err := sql.Open("postgres", connectionString)
+	db, err := sql.Open("postgres", PostgresConnectionString(*config))
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +43,18 @@ func PostgresConnection() (*sql.DB, error) {
 	return db, nil
 }
 
+// PostgresConnectionString returns the connection string of the configured
+// database.
+func PostgresConnectionString(config config.AppConfig) string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		config.Database.Host,
+		config.Database.Port,
+		config.Database.User,
+		config.Database.Password,
+		config.Database.Name)
+}
+
 func Migrate(config config.AppConfig) error {
 	var databaseUrl = fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
@@ -0,0 +1,450 @@
+package attachments
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type AttachmentsRepository interface {
+	GetAttachment(id int) (*Attachment, error)
+	GetNoteAttachments(noteId int) (*[]Attachment, error)
+	UseBlob(sha256 string) (bool, error)
+	CreateAttachment(attachment Attachment) (int, error)
+	DeleteAttachment(id int) error
+	DeleteOrphanBlobs(unusedFor time.Duration, deleteBlob func(sha256 string) error) (int, error)
+	GenerateThumbnails(limit int, generate func(Image) (*Thumbnail, error)) (int, error)
+	GetPendingLocations(limit int) ([]Image, error)
+	AddStrippedBlob(sha256 string, stripped Blob) error
+	FinishStripLocation(sha256 string, stripped *Blob) error
+}
+
+var ErrAttachmentNotFound = errors.New("AttachmentNotFound")
+var ErrBlobDeleting = errors.New("BlobDeleting")
+
+// MaxThumbnailAttempts is how often making a thumbnail is tried before the
+// image is given up on.
+const MaxThumbnailAttempts = 3
+
+// MaxStripAttempts is how often stripping the location of an image is tried
+// before the image is given up on.
+const MaxStripAttempts = 3
+
+const attachmentColumns = `a.id, a.note_id, a.user_id, a.sha256, a.filename, a.content_type, a.size,
+	a.created_at, b.width, b.height, b.thumbnail_status, b.thumbnail_content_type,
+	b.thumbnail_size, b.thumbnail_width, b.thumbnail_height`
+
+type AttachmentsDbRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentsDbRepository(db *sql.DB) *AttachmentsDbRepository {
+	return &AttachmentsDbRepository{db: db}
+}
+
+func (r *AttachmentsDbRepository) GetAttachment(id int) (*Attachment, error) {
+	attachment, err := scanAttachment(r.db.QueryRow(
+		`SELECT `+attachmentColumns+`
+		FROM note_attachments a JOIN blobs b ON b.sha256 = a.sha256
+		WHERE a.id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return attachment, err
+}
+
+// GetNoteAttachments returns the attachments of the note, oldest first.
+func (r *AttachmentsDbRepository) GetNoteAttachments(noteId int) (*[]Attachment, error) {
+	rows, err := r.db.Query(
+		`SELECT `+attachmentColumns+`
+		FROM note_attachments a JOIN blobs b ON b.sha256 = a.sha256
+		WHERE a.note_id = $1
+		ORDER BY a.created_at, a.id`,
+		noteId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *attachment)
+	}
+
+	return &list, rows.Err()
+}
+
+// UseBlob tells whether the blob is stored already and keeps it from being
+// cleaned up for a while. Blobs being deleted are not taken for stored, as
+// they may be gone from the blob store.
+func (r *AttachmentsDbRepository) UseBlob(sha256 string) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE blobs SET used_at = NOW() WHERE sha256 = $1 AND NOT deleting`,
+		sha256)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CreateAttachment adds the attachment and records its blob, which must be
+// in the blob store already. Blobs of images, which have dimensions, wait
+// for a thumbnail. It returns ErrBlobDeleting while the blob is being
+// deleted, as the blob store may lose it still; it is stored again once its
+// deletion is recorded.
+func (r *AttachmentsDbRepository) CreateAttachment(attachment Attachment) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`INSERT INTO blobs (sha256, size, content_type, width, height, thumbnail_status)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $4::int IS NULL THEN NULL ELSE 'pending' END)
+		ON CONFLICT (sha256) DO UPDATE SET used_at = NOW() WHERE NOT blobs.deleting
+		RETURNING sha256`,
+		attachment.SHA256,
+		attachment.Size,
+		attachment.ContentType,
+		attachment.Width,
+		attachment.Height).Scan(&attachment.SHA256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrBlobDeleting
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO note_attachments (note_id, user_id, sha256, filename, content_type, size)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		attachment.NoteId,
+		attachment.UserId,
+		attachment.SHA256,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// DeleteAttachment deletes the attachment. Its blob is left for
+// DeleteOrphanBlobs.
+func (r *AttachmentsDbRepository) DeleteAttachment(id int) error {
+	res, err := r.db.Exec(`DELETE FROM note_attachments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+// DeleteOrphanBlobs deletes the blobs no attachment refers to that were not
+// used for unusedFor. The blobs are marked as deleting first, so uploads do
+// not attach them meanwhile, and deleteBlob removes them from the blob store outside of any
+// transaction before their rows are deleted. Blobs it fails for stay marked
+// and are tried again next time. It returns the number of blobs deleted.
+func (r *AttachmentsDbRepository) DeleteOrphanBlobs(unusedFor time.Duration, deleteBlob func(sha256 string) error) (int, error) {
+	orphans, err := r.markOrphanBlobs(unusedFor)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	deleted := 0
+	for _, sha256 := range orphans {
+		err := deleteBlob(sha256)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		_, err = r.db.Exec(`DELETE FROM blobs WHERE sha256 = $1 AND deleting`, sha256)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// markOrphanBlobs marks the blobs no attachment refers to that were not used
+// for unusedFor as deleting and returns them, along with those marked before
+// whose deletion did not finish.
+func (r *AttachmentsDbRepository) markOrphanBlobs(unusedFor time.Duration) ([]string, error) {
+	rows, err := r.db.Query(
+		`UPDATE blobs SET deleting = true
+		WHERE sha256 IN (
+			SELECT sha256 FROM blobs b
+			WHERE used_at < $1
+				AND NOT EXISTS (SELECT 1 FROM note_attachments a WHERE a.sha256 = b.sha256)
+			FOR UPDATE SKIP LOCKED)
+		RETURNING sha256`,
+		time.Now().Add(-unusedFor))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orphans []string
+	for rows.Next() {
+		var sha256 string
+		err := rows.Scan(&sha256)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, sha256)
+	}
+
+	return orphans, rows.Err()
+}
+
+// GenerateThumbnails calls generate for up to limit images waiting for a
+// thumbnail and records the thumbnails it made. Locked images are skipped,
+// so with several instances running every image is handled by one of them.
+// Images generate fails for are tried again until MaxThumbnailAttempts. It
+// returns the number of images handled.
+func (r *AttachmentsDbRepository) GenerateThumbnails(limit int, generate func(Image) (*Thumbnail, error)) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT sha256, content_type, size FROM blobs
+		WHERE thumbnail_status = 'pending'
+		ORDER BY created_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var images []Image
+	for rows.Next() {
+		var image Image
+		err := rows.Scan(&image.SHA256, &image.ContentType, &image.Size)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		images = append(images, image)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, image := range images {
+		thumbnail, generateErr := generate(image)
+		if generateErr != nil {
+			_, err = tx.Exec(
+				`UPDATE blobs SET thumbnail_attempts = thumbnail_attempts + 1,
+					thumbnail_status = CASE WHEN thumbnail_attempts + 1 >= $2 THEN 'failed' ELSE 'pending' END
+				WHERE sha256 = $1`,
+				image.SHA256,
+				MaxThumbnailAttempts)
+		} else {
+			_, err = tx.Exec(
+				`UPDATE blobs SET thumbnail_status = 'ready', thumbnail_content_type = $2,
+					thumbnail_size = $3, thumbnail_width = $4, thumbnail_height = $5
+				WHERE sha256 = $1`,
+				image.SHA256,
+				thumbnail.ContentType,
+				thumbnail.Size,
+				thumbnail.Width,
+				thumbnail.Height)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(images), tx.Commit()
+}
+
+// GetPendingLocations returns up to limit images stored before locations
+// were stripped on upload, oldest first. Nothing is locked: instances that
+// strip the same image store the same copy, and only the first to finish
+// moves the attachments.
+func (r *AttachmentsDbRepository) GetPendingLocations(limit int) ([]Image, error) {
+	rows, err := r.db.Query(
+		`SELECT sha256, content_type, size FROM blobs
+		WHERE location_status = 'pending' AND NOT deleting
+		ORDER BY created_at
+		LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		var image Image
+		err := rows.Scan(&image.SHA256, &image.ContentType, &image.Size)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// AddStrippedBlob records the stripped copy of the blob with the dimensions
+// of the original before it is put in the blob store. Until
+// FinishStripLocation points attachments to it, the copy is an orphan that
+// DeleteOrphanBlobs removes once unused for long enough. It returns
+// ErrBlobDeleting while the copy is being deleted.
+func (r *AttachmentsDbRepository) AddStrippedBlob(sha256 string, stripped Blob) error {
+	err := r.db.QueryRow(
+		`INSERT INTO blobs (sha256, size, content_type, width, height, thumbnail_status)
+		SELECT $2, $3, content_type, width, height, CASE WHEN width IS NULL THEN NULL ELSE 'pending' END
+		FROM blobs WHERE sha256 = $1
+		ON CONFLICT (sha256) DO UPDATE SET used_at = NOW() WHERE NOT blobs.deleting
+		RETURNING sha256`,
+		sha256,
+		stripped.SHA256,
+		stripped.Size).Scan(&stripped.SHA256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrBlobDeleting
+	}
+
+	return err
+}
+
+// FinishStripLocation records the outcome of stripping the location of the
+// blob. The attachments of the blob are moved to the stripped copy, which
+// must be recorded and in the blob store already; the original is left for
+// DeleteOrphanBlobs. Without a copy the attempt failed, and the blob is tried
+// again until MaxStripAttempts. Blobs finished meanwhile are left as they are.
+func (r *AttachmentsDbRepository) FinishStripLocation(sha256 string, stripped *Blob) error {
+	if stripped == nil {
+		_, err := r.db.Exec(
+			`UPDATE blobs SET location_attempts = location_attempts + 1,
+				location_status = CASE WHEN location_attempts + 1 >= $2 THEN 'failed' ELSE 'pending' END
+			WHERE sha256 = $1 AND location_status = 'pending'`,
+			sha256,
+			MaxStripAttempts)
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`SELECT sha256 FROM blobs WHERE sha256 = $1 AND location_status = 'pending' FOR UPDATE`,
+		sha256).Scan(&sha256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if stripped.SHA256 != sha256 {
+		err = moveAttachments(tx, sha256, *stripped)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE blobs SET location_status = 'stripped' WHERE sha256 = $1`, sha256)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// moveAttachments points the attachments of the blob to its stripped copy.
+// It returns ErrBlobDeleting while the copy is being deleted.
+func moveAttachments(tx *sql.Tx, sha256 string, stripped Blob) error {
+	result, err := tx.Exec(
+		`UPDATE blobs SET used_at = NOW() WHERE sha256 = $1 AND NOT deleting`,
+		stripped.SHA256)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBlobDeleting
+	}
+
+	_, err = tx.Exec(
+		`UPDATE note_attachments SET sha256 = $2, size = $3 WHERE sha256 = $1`,
+		sha256,
+		stripped.SHA256,
+		stripped.Size)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttachment(row scanner) (*Attachment, error) {
+	var attachment Attachment
+	var status, thumbnailType sql.NullString
+	var thumbnailSize sql.NullInt64
+	var thumbnailWidth, thumbnailHeight sql.NullInt32
+	err := row.Scan(
+		&attachment.Id,
+		&attachment.NoteId,
+		&attachment.UserId,
+		&attachment.SHA256,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.CreatedAt,
+		&attachment.Width,
+		&attachment.Height,
+		&status,
+		&thumbnailType,
+		&thumbnailSize,
+		&thumbnailWidth,
+		&thumbnailHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.String == ThumbnailReady {
+		attachment.Thumbnail = &Thumbnail{
+			ContentType: thumbnailType.String,
+			Size:        thumbnailSize.Int64,
+			Width:       int(thumbnailWidth.Int32),
+			Height:      int(thumbnailHeight.Int32),
+		}
+	}
+
+	return &attachment, nil
+}
@@ -0,0 +1,52 @@
+package attachments
+
+import "time"
+
+const (
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailFailed  = "failed"
+)
+
+// Attachment is a file attached to a note. Its content is the blob stored
+// under SHA256, shared by all attachments with the same content. Images
+// have their dimensions and, once it is made, a thumbnail.
+type Attachment struct {
+	Id          int        `json:"id"`
+	NoteId      int        `json:"note_id"`
+	UserId      *int       `json:"user_id"`
+	SHA256      string     `json:"sha256"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	Width       *int       `json:"width,omitempty"`
+	Height      *int       `json:"height,omitempty"`
+	Thumbnail   *Thumbnail `json:"thumbnail,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// In converts the timestamps of the attachment to the given location.
+func (a *Attachment) In(loc *time.Location) {
+	a.CreatedAt = a.CreatedAt.In(loc)
+}
+
+// Thumbnail is a reduced copy of an image, stored next to its blob.
+type Thumbnail struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// Image is a blob waiting for its thumbnail or its location to be stripped.
+type Image struct {
+	SHA256      string
+	ContentType string
+	Size        int64
+}
+
+// Blob is content stored in the blob store under SHA256.
+type Blob struct {
+	SHA256 string
+	Size   int64
+}
@@ -0,0 +1,74 @@
+package collab
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Broker fans events out to every service instance, the publishing one
+// included.
+type Broker interface {
+	Publish(event Event) error
+	// Listen passes received events to handle until ctx is cancelled.
+	Listen(ctx context.Context, handle func(Event)) error
+}
+
+const channel = "note_collab"
+
+// PgBroker sends events through Postgres NOTIFY on a channel every instance
+// LISTENs on.
+type PgBroker struct {
+	db               *sql.DB
+	connectionString string
+}
+
+// NewPgBroker publishes through db. Listening needs a connection of its own,
+// opened with connectionString.
+func NewPgBroker(db *sql.DB, connectionString string) *PgBroker {
+	return &PgBroker{db: db, connectionString: connectionString}
+}
+
+func (b *PgBroker) Publish(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.Exec(`SELECT pg_notify($1, $2)`, channel, string(payload))
+	return err
+}
+
+func (b *PgBroker) Listen(ctx context.Context, handle func(Event)) error {
+	listener := pq.NewListener(b.connectionString, time.Second, time.Minute, nil)
+	defer listener.Close()
+
+	err := listener.Listen(channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			// A nil notification follows a reconnect.
+			if notification == nil {
+				handle(Event{Type: EventReconnect})
+				continue
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				continue
+			}
+			handle(event)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package collab
+
+import (
+	"NotesService/pkg/ot"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type CollabRepository interface {
+	GetState(noteId int) (*State, error)
+	InitState(state State) error
+	SaveState(state State) error
+	GetOperations(noteId, after int) (*[]Operation, error)
+	AppendOperation(operation Operation) error
+	PruneOperations(noteId, before int) error
+	LockNote(ctx context.Context, noteId int) (func(), error)
+}
+
+var (
+	ErrStateNotFound = errors.New("StateNotFound")
+	ErrRevisionTaken = errors.New("RevisionTaken")
+)
+
+// lockSpace keeps the advisory locks of notes apart from other locks.
+const lockSpace = 46
+
+type CollabDbRepository struct {
+	db *sql.DB
+}
+
+func NewCollabDbRepository(db *sql.DB) *CollabDbRepository {
+	return &CollabDbRepository{db: db}
+}
+
+func (r *CollabDbRepository) GetState(noteId int) (*State, error) {
+	state := State{NoteId: noteId}
+	err := r.db.QueryRow(
+		`SELECT revision, version, body FROM note_collab_states WHERE note_id = $1`,
+		noteId).Scan(&state.Revision, &state.Version, &state.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// InitState stores the state unless the note has one already.
+func (r *CollabDbRepository) InitState(state State) error {
+	_, err := r.db.Exec(
+		`INSERT INTO note_collab_states (note_id, revision, version, body) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (note_id) DO NOTHING`,
+		state.NoteId,
+		state.Revision,
+		state.Version,
+		state.Body)
+
+	return err
+}
+
+// SaveState replaces the state unless a later revision was saved already.
+func (r *CollabDbRepository) SaveState(state State) error {
+	_, err := r.db.Exec(
+		`UPDATE note_collab_states SET revision = $2, version = $3, body = $4
+		WHERE note_id = $1 AND revision <= $2`,
+		state.NoteId,
+		state.Revision,
+		state.Version,
+		state.Body)
+
+	return err
+}
+
+// GetOperations returns the operations of the note after the revision, in
+// order.
+func (r *CollabDbRepository) GetOperations(noteId, after int) (*[]Operation, error) {
+	operations := []Operation{}
+	rows, err := r.db.Query(
+		`SELECT note_id, revision, user_id, client_id, operation, created_at FROM note_operations
+		WHERE note_id = $1 AND revision > $2
+		ORDER BY revision`,
+		noteId,
+		after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var operation Operation
+		var data []byte
+		err := rows.Scan(
+			&operation.NoteId,
+			&operation.Revision,
+			&operation.UserId,
+			&operation.ClientId,
+			&data,
+			&operation.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		operation.Operation = ot.New()
+		if err := json.Unmarshal(data, operation.Operation); err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+
+	return &operations, rows.Err()
+}
+
+// AppendOperation stores the operation under its revision. Concurrent
+// appends of the same revision, e.g. from different service instances, fail
+// with ErrRevisionTaken for all but one.
+func (r *CollabDbRepository) AppendOperation(operation Operation) error {
+	data, err := json.Marshal(operation.Operation)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		`INSERT INTO note_operations (note_id, revision, user_id, client_id, operation)
+		VALUES ($1, $2, $3, $4, $5)`,
+		operation.NoteId,
+		operation.Revision,
+		operation.UserId,
+		operation.ClientId,
+		data)
+	if isUniqueViolation(err) {
+		return ErrRevisionTaken
+	}
+
+	return err
+}
+
+// PruneOperations deletes the operations of the note before the revision.
+func (r *CollabDbRepository) PruneOperations(noteId, before int) error {
+	_, err := r.db.Exec(
+		`DELETE FROM note_operations WHERE note_id = $1 AND revision < $2`,
+		noteId,
+		before)
+
+	return err
+}
+
+// LockNote takes a lock on the collaborative document of the note that is
+// shared by all service instances. Calling the returned function releases
+// it.
+func (r *CollabDbRepository) LockNote(ctx context.Context, noteId int) (func(), error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, $2)`, lockSpace, noteId)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, $2)`, lockSpace, noteId)
+		conn.Close()
+	}, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
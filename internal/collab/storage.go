@@ -0,0 +1,60 @@
+package collab
+
+import (
+	"NotesService/pkg/ot"
+	"time"
+)
+
+const (
+	EventOperation = "operation"
+	EventPresence  = "presence"
+	EventLeave     = "leave"
+	// EventReconnect is delivered when the broker lost its connection and
+	// events may have been missed.
+	EventReconnect = "reconnect"
+)
+
+// State is the collaborative document of a note as last saved to the note:
+// the body after the operations up to Revision, saved as Version of the
+// note.
+type State struct {
+	NoteId   int
+	Revision int
+	Version  int
+	Body     string
+}
+
+// Operation is an edit of the collaborative document of a note. Revisions
+// number the operations of a note without gaps, starting at 1. Edits made to
+// the note outside of collaboration have no user.
+type Operation struct {
+	NoteId    int
+	Revision  int
+	UserId    *int
+	ClientId  string
+	Operation *ot.Operation
+	CreatedAt time.Time
+}
+
+type Cursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selection_end"`
+}
+
+// Presence is a client editing a note and where its cursor is.
+type Presence struct {
+	ClientId string  `json:"client_id"`
+	UserId   int     `json:"user_id"`
+	Email    string  `json:"email"`
+	Cursor   *Cursor `json:"cursor"`
+}
+
+// Event tells the service instances that an operation was stored or a
+// client moved its cursor or left.
+type Event struct {
+	Instance string    `json:"instance"`
+	NoteId   int       `json:"note_id"`
+	Type     string    `json:"type"`
+	Revision int       `json:"revision,omitempty"`
+	Presence *Presence `json:"presence,omitempty"`
+}
@@ -0,0 +1,238 @@
+package comments
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type CommentsRepository interface {
+	GetComment(id int) (*Comment, error)
+	GetThreads(noteId int, filter ThreadsFilter) (*[]Thread, int, error)
+	CreateComment(comment Comment) (int, error)
+	UpdateComment(id int, body string) error
+	DeleteComment(id int) error
+	ResolveThread(id, userid int, resolved bool) error
+}
+
+var ErrCommentNotFound = errors.New("CommentNotFound")
+
+const commentColumns = `c.id, c.note_id, c.user_id, u.email, c.parent_id, c.body,
+	c.anchor_start, c.anchor_end, c.anchor_quote, c.resolved_at, c.resolved_by,
+	c.created_at, c.edited_at`
+
+type CommentsDbRepository struct {
+	db *sql.DB
+}
+
+func NewCommentsDbRepository(db *sql.DB) *CommentsDbRepository {
+	return &CommentsDbRepository{db: db}
+}
+
+func (r *CommentsDbRepository) GetComment(id int) (*Comment, error) {
+	comment, err := scanComment(r.db.QueryRow(
+		`SELECT `+commentColumns+`
+		FROM note_comments c JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+
+	return comment, err
+}
+
+// GetThreads returns a page of the threads of the note, oldest first, with
+// all their replies, and the number of threads matching the filter.
+func (r *CommentsDbRepository) GetThreads(noteId int, filter ThreadsFilter) (*[]Thread, int, error) {
+	var total int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM note_comments
+		WHERE note_id = $1 AND parent_id IS NULL
+			AND ($2::boolean IS NULL OR (resolved_at IS NOT NULL) = $2)`,
+		noteId,
+		filter.Resolved).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	threads := []Thread{}
+	rows, err := r.db.Query(
+		`SELECT `+commentColumns+`
+		FROM note_comments c JOIN users u ON u.id = c.user_id
+		WHERE c.note_id = $1 AND c.parent_id IS NULL
+			AND ($2::boolean IS NULL OR (c.resolved_at IS NOT NULL) = $2)
+		ORDER BY c.created_at, c.id
+		LIMIT $3 OFFSET $4`,
+		noteId,
+		filter.Resolved,
+		filter.Limit,
+		filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	index := map[int]int{}
+	var ids []int64
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		index[comment.Id] = len(threads)
+		ids = append(ids, int64(comment.Id))
+		threads = append(threads, Thread{Comment: *comment, Replies: []Comment{}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return &threads, total, nil
+	}
+
+	replies, err := r.db.Query(
+		`SELECT `+commentColumns+`
+		FROM note_comments c JOIN users u ON u.id = c.user_id
+		WHERE c.parent_id = ANY($1)
+		ORDER BY c.created_at, c.id`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer replies.Close()
+
+	for replies.Next() {
+		reply, err := scanComment(replies)
+		if err != nil {
+			return nil, 0, err
+		}
+		thread := &threads[index[*reply.ParentId]]
+		thread.Replies = append(thread.Replies, *reply)
+	}
+
+	return &threads, total, replies.Err()
+}
+
+func (r *CommentsDbRepository) CreateComment(comment Comment) (int, error) {
+	var start, end sql.NullInt64
+	var quote sql.NullString
+	if comment.Anchor != nil {
+		start = sql.NullInt64{Int64: int64(comment.Anchor.Start), Valid: true}
+		end = sql.NullInt64{Int64: int64(comment.Anchor.End), Valid: true}
+		quote = sql.NullString{String: comment.Anchor.Quote, Valid: true}
+	}
+
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO note_comments (note_id, user_id, parent_id, body, anchor_start, anchor_end, anchor_quote)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		comment.NoteId,
+		comment.UserId,
+		comment.ParentId,
+		comment.Body,
+		start,
+		end,
+		quote).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *CommentsDbRepository) UpdateComment(id int, body string) error {
+	res, err := r.db.Exec(
+		`UPDATE note_comments SET body = $1, edited_at = NOW() WHERE id = $2`,
+		body,
+		id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrCommentNotFound
+	}
+
+	return nil
+}
+
+// DeleteComment deletes the comment, together with the replies when it
+// starts a thread.
+func (r *CommentsDbRepository) DeleteComment(id int) error {
+	res, err := r.db.Exec(`DELETE FROM note_comments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrCommentNotFound
+	}
+
+	return nil
+}
+
+// ResolveThread marks the thread started by the comment as resolved by the
+// user, or opens it again.
+func (r *CommentsDbRepository) ResolveThread(id, userid int, resolved bool) error {
+	query := `UPDATE note_comments SET resolved_at = NULL, resolved_by = NULL
+		WHERE id = $1 AND parent_id IS NULL`
+	args := []any{id}
+	if resolved {
+		query = `UPDATE note_comments SET resolved_at = COALESCE(resolved_at, NOW()),
+			resolved_by = COALESCE(resolved_by, $2)
+		WHERE id = $1 AND parent_id IS NULL`
+		args = append(args, userid)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrCommentNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner) (*Comment, error) {
+	var comment Comment
+	var start, end sql.NullInt64
+	var quote sql.NullString
+	err := row.Scan(
+		&comment.Id,
+		&comment.NoteId,
+		&comment.UserId,
+		&comment.Email,
+		&comment.ParentId,
+		&comment.Body,
+		&start,
+		&end,
+		&quote,
+		&comment.ResolvedAt,
+		&comment.ResolvedBy,
+		&comment.CreatedAt,
+		&comment.EditedAt)
+	if err != nil {
+		return nil, err
+	}
+	if start.Valid {
+		comment.Anchor = &Anchor{
+			Start: int(start.Int64),
+			End:   int(end.Int64),
+			Quote: quote.String,
+		}
+	}
+
+	return &comment, nil
+}
@@ -0,0 +1,59 @@
+package comments
+
+import "time"
+
+// Anchor ties a comment to the text between Start and End of the note body,
+// counted in characters. Quote keeps the text as it was when commented on.
+type Anchor struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Quote string `json:"quote"`
+}
+
+// Comment is a comment on a note. Comments without a parent start a thread,
+// the others are replies to it. Only threads are resolved.
+type Comment struct {
+	Id         int        `json:"id"`
+	NoteId     int        `json:"note_id"`
+	UserId     int        `json:"user_id"`
+	Email      string     `json:"email"`
+	ParentId   *int       `json:"parent_id"`
+	Body       string     `json:"body"`
+	Anchor     *Anchor    `json:"anchor,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *int       `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at"`
+}
+
+// In converts the timestamps of the comment to the given location.
+func (c *Comment) In(loc *time.Location) {
+	c.CreatedAt = c.CreatedAt.In(loc)
+	for _, t := range []*time.Time{c.ResolvedAt, c.EditedAt} {
+		if t != nil {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// Thread is a comment starting a thread with its replies, oldest first.
+type Thread struct {
+	Comment
+	Replies []Comment `json:"replies"`
+}
+
+// In converts the timestamps of the thread to the given location.
+func (t *Thread) In(loc *time.Location) {
+	t.Comment.In(loc)
+	for i := range t.Replies {
+		t.Replies[i].In(loc)
+	}
+}
+
+// ThreadsFilter selects a page of the threads of a note. A nil Resolved
+// selects both resolved and open threads.
+type ThreadsFilter struct {
+	Resolved *bool
+	Limit    int
+	Offset   int
+}
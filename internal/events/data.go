@@ -0,0 +1,131 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type EventsRepository interface {
+	GetEvents(userid int, after, xmin int64, limit int) (*[]Event, int64, error)
+	GetFirstEventId() (int64, error)
+	GetLastEventId() (int64, int64, error)
+	DeleteEventsBefore(before time.Time) (int64, error)
+	// Listen calls wake when events may have been logged until ctx is
+	// cancelled.
+	Listen(ctx context.Context, wake func()) error
+}
+
+const channel = "note_events"
+
+// EventsDbRepository reads the events logged by the notes_log_event trigger.
+type EventsDbRepository struct {
+	db               *sql.DB
+	connectionString string
+}
+
+// NewEventsDbRepository reads events through db. Listening needs a
+// connection of its own, opened with connectionString.
+func NewEventsDbRepository(db *sql.DB, connectionString string) *EventsDbRepository {
+	return &EventsDbRepository{db: db, connectionString: connectionString}
+}
+
+// GetEvents returns the events after the given id on notes the user owns,
+// has been shared or can access through a workspace, oldest first.
+//
+// Transactions running while events are read may still commit events with
+// lower ids. Such events are left out, and the oldest transaction that was
+// running is returned as xmin. Passed back with the id of the last event
+// read, the events those transactions commit are returned then. A zero xmin
+// returns only the events after the id.
+func (r *EventsDbRepository) GetEvents(userid int, after, xmin int64, limit int) (*[]Event, int64, error) {
+	var current int64
+	err := r.db.QueryRow(`SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&current)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(
+		`SELECT id, note_id, type, version, created_at FROM note_events
+		WHERE (id > $2 OR ($4::bigint <> 0 AND xact_id >= $4::bigint::text::xid8))
+			AND xact_id < $5::bigint::text::xid8
+			AND (
+				(workspace_id IS NULL AND user_id = $1)
+				OR note_id IN (SELECT note_id FROM note_shares WHERE user_id = $1)
+				OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1))
+		ORDER BY id
+		LIMIT $3`,
+		userid,
+		after,
+		limit,
+		xmin,
+		current)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Event{}
+	for rows.Next() {
+		var event Event
+		err := rows.Scan(&event.Id, &event.NoteId, &event.Type, &event.Version, &event.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, event)
+	}
+
+	return &list, current, rows.Err()
+}
+
+// GetFirstEventId returns the id of the oldest event kept, 0 if there is
+// none.
+func (r *EventsDbRepository) GetFirstEventId() (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`SELECT COALESCE(MIN(id), 0) FROM note_events`).Scan(&id)
+	return id, err
+}
+
+// GetLastEventId returns the id of the newest committed event, 0 if there is
+// none, and the oldest transaction running, see GetEvents.
+func (r *EventsDbRepository) GetLastEventId() (int64, int64, error) {
+	var id, xmin int64
+	err := r.db.QueryRow(
+		`SELECT COALESCE(MAX(id), 0), pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+		FROM note_events`).Scan(&id, &xmin)
+	return id, xmin, err
+}
+
+func (r *EventsDbRepository) DeleteEventsBefore(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM note_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *EventsDbRepository) Listen(ctx context.Context, wake func()) error {
+	listener := pq.NewListener(r.connectionString, time.Second, time.Minute, nil)
+	defer listener.Close()
+
+	err := listener.Listen(channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			// A nil notification follows a reconnect, events may have
+			// been missed meanwhile. Either way the streams look.
+			wake()
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
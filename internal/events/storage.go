@@ -0,0 +1,24 @@
+package events
+
+import "time"
+
+const (
+	TypeCreated = "created"
+	TypeUpdated = "updated"
+	TypeDeleted = "deleted"
+)
+
+// Event tells that a note was created, updated or deleted. Notes moved to
+// the trash count as deleted and notes restored from it as created.
+type Event struct {
+	Id        int64     `json:"id"`
+	NoteId    int       `json:"note_id"`
+	Type      string    `json:"type"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// In converts the timestamp of the event to the given location.
+func (e *Event) In(loc *time.Location) {
+	e.CreatedAt = e.CreatedAt.In(loc)
+}
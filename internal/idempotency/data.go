@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"database/sql"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	ReserveKey(userId int, key, fingerprint string, ttl time.Duration) (*Key, bool, error)
+	SaveResponse(userId int, key string, statusCode int, contentType string, response []byte) error
+	ReleaseKey(userId int, key string) error
+	DeleteExpiredKeys(ttl time.Duration) (int64, error)
+}
+
+type IdempotencyDbRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyDbRepository(db *sql.DB) *IdempotencyDbRepository {
+	return &IdempotencyDbRepository{db: db}
+}
+
+// ReserveKey claims the key for a new request. When the key is already
+// taken and has not expired, the stored key is returned instead and the
+// second result is false.
+func (r *IdempotencyDbRepository) ReserveKey(
+	userId int,
+	key, fingerprint string,
+	ttl time.Duration) (*Key, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND created_at < NOW() - make_interval(secs => $3)`,
+		userId,
+		key,
+		ttl.Seconds())
+	if err != nil {
+		return nil, false, err
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, key) DO NOTHING`,
+		userId,
+		key,
+		fingerprint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 1 {
+		return nil, true, tx.Commit()
+	}
+
+	var stored Key
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err = tx.QueryRow(
+		`SELECT user_id, key, fingerprint, status_code, content_type, response, created_at
+		FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userId,
+		key).Scan(
+		&stored.UserId,
+		&stored.Key,
+		&stored.Fingerprint,
+		&statusCode,
+		&contentType,
+		&stored.Response,
+		&stored.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	stored.ContentType = contentType.String
+
+	return &stored, false, tx.Commit()
+}
+
+func (r *IdempotencyDbRepository) SaveResponse(
+	userId int,
+	key string,
+	statusCode int,
+	contentType string,
+	response []byte) error {
+	_, err := r.db.Exec(
+		`UPDATE idempotency_keys SET status_code = $1, content_type = $2, response = $3
+		WHERE user_id = $4 AND key = $5`,
+		statusCode,
+		contentType,
+		response,
+		userId,
+		key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseKey forgets a reserved key so that the request can be retried.
+func (r *IdempotencyDbRepository) ReleaseKey(userId int, key string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userId,
+		key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *IdempotencyDbRepository) DeleteExpiredKeys(ttl time.Duration) (int64, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM idempotency_keys WHERE created_at < NOW() - make_interval(secs => $1)`,
+		ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
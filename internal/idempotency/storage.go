@@ -0,0 +1,15 @@
+package idempotency
+
+import "time"
+
+// Key is a stored idempotency key. StatusCode is zero while the original
+// request is still being processed.
+type Key struct {
+	UserId      int
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Response    []byte
+	CreatedAt   time.Time
+}
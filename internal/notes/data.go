@@ -1,18 +1,54 @@
 package notes
 
 import (
+	"NotesService/pkg/markdown"
 	"database/sql"
 	"errors"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 type NotesRepository interface {
 	GetNote(id int) (*Note, error)
-	GetUserNotes(userid int) (*[]Note, error)
-	CreateNote(user_id int, title, body string) error
-	UpdateNote(id int, title, body string) error
-	DeleteNote(id int) error
+	GetUserNotes(userid int, filter NotesFilter) (*[]Note, error)
+	CreateNote(user_id int, title, body string) (int, error)
+	UpdateNote(id int, update NoteUpdate, version int) error
+	DeleteNote(id int, version int) error
+	GetNoteRevisions(noteId int) (*[]Revision, error)
+	GetNoteRevision(noteId, revision int) (*Revision, error)
+	PruneNoteRevisions(noteId, keepLast, keepDays int) error
+	GetTrashedNotes(userid, workspaceId int) (*[]Note, error)
+	RestoreNote(userid, id int) error
+	EmptyTrash(userid, workspaceId int) (int64, error)
+	PurgeDeletedNotes(retentionDays int) (int64, error)
+	ExecuteBulk(userid, workspaceId int, operations []BulkOperation, atomic bool, authorize func(note *Note, role string) error) ([]BulkResult, error)
+	GetBacklinks(noteId, userid int) (*[]Note, error)
+	GetDanglingLinks(userid, workspaceId int) (*[]DanglingLink, error)
+	GetNoteGraph(userid, workspaceId int) (*Graph, error)
+	GetOrCreateDailyNote(userid int, date, title, body string) (*Note, bool, error)
+	GetDailyNotes(userid int, from, to string) (*[]Note, error)
+	GetNoteShares(noteId int) (*[]Share, error)
+	GetNoteShare(noteId, userid int) (*Share, error)
+	ShareNote(noteId, userid int, role string) error
+	UnshareNote(noteId, userid int) error
+	GetSharedNotes(userid int) (*[]SharedNote, error)
+	CreateWorkspaceNote(userid, workspaceId int, title, body string) (int, error)
+	MoveNoteToWorkspace(id, workspaceId int) error
+	GetNoteChanges(userid, workspaceId int, since, xmin int64, limit int) (*[]Change, int64, error)
+	GetOrCreateClientNote(userid int, workspaceId *int, clientId, title, body string) (*Note, bool, error)
 }
 
+var (
+	ErrNoteNotFound     = errors.New("NoteNotFound")
+	ErrVersionMismatch  = errors.New("VersionMismatch")
+	ErrUnknownOperation = errors.New("UnknownOperation")
+	ErrShareNotFound    = errors.New("ShareNotFound")
+)
+
+const noteColumns = `id, user_id, title, body, created_at, updated_at, version, deleted_at,
+	pinned, pinned_at, archived, archived_at, favorite, favorited_at, tags, daily_date::text, workspace_id`
+
 type NotesDbRepository struct {
 	db *sql.DB
 }
@@ -21,71 +57,1119 @@ func NewNotesDbRepository(db *sql.DB) *NotesDbRepository {
 	return &NotesDbRepository{db: db}
 }
 
+// GetNote returns the note unless it has been moved to the trash.
 func (r *NotesDbRepository) GetNote(id int) (*Note, error) {
-	var note Note
-	err := r.db.QueryRow(`SELECT * FROM notes WHERE id = $1`, id).
-		Scan(&note.Id, &note.UserId, &note.Title, &note.Body, &note.CreatedAt)
+	return scanNote(r.db.QueryRow(
+		`SELECT `+noteColumns+` FROM notes WHERE id = $1 AND deleted_at IS NULL`,
+		id))
+}
+
+// GetUserNotes lists notes matching the filter with pinned notes first.
+func (r *NotesDbRepository) GetUserNotes(userid int, filter NotesFilter) (*[]Note, error) {
+	pattern := ""
+	if filter.Query != "" {
+		pattern = "%" + likeEscaper.Replace(filter.Query) + "%"
+	}
+
+	return r.queryNotes(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE deleted_at IS NULL
+			AND CASE WHEN $5 = 0 THEN user_id = $1 AND workspace_id IS NULL ELSE workspace_id = $5 END
+			AND archived = $2
+			AND ($3 = FALSE OR favorite)
+			AND ($4 = '' OR $4 = ANY(tags))
+			AND ($6 = '' OR title ILIKE $6 OR body ILIKE $6)
+		ORDER BY pinned DESC, pinned_at DESC NULLS LAST, created_at DESC, id DESC`,
+		userid,
+		filter.Archived,
+		filter.Favorites,
+		filter.Tag,
+		filter.WorkspaceId,
+		pattern)
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// CreateNote creates the note and returns its id.
+func (r *NotesDbRepository) CreateNote(user_id int, title, body string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createNote(tx, user_id, title, body, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// CreateWorkspaceNote creates a note of the user in the workspace and
+// returns its id.
+func (r *NotesDbRepository) CreateWorkspaceNote(userid, workspaceId int, title, body string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createNote(tx, userid, title, body, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE notes SET workspace_id = $2 WHERE id = $1`, id, workspaceId)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// MoveNoteToWorkspace transfers a personal note to the workspace.
+func (r *NotesDbRepository) MoveNoteToWorkspace(id, workspaceId int) error {
+	res, err := r.db.Exec(
+		`UPDATE notes SET workspace_id = $2
+		WHERE id = $1 AND workspace_id IS NULL AND deleted_at IS NULL`,
+		id,
+		workspaceId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
+
+// UpdateNote changes the fields set in update and bumps the note version.
+// A non-zero version makes the update conditional: ErrVersionMismatch is
+// returned if the note has been changed since.
+func (r *NotesDbRepository) UpdateNote(id int, update NoteUpdate, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateNote(tx, id, update, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteNote moves the note to the trash. A non-zero version makes the
+// deletion conditional in the same way as for UpdateNote.
+func (r *NotesDbRepository) DeleteNote(id int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteNote(tx, id, version)
+	if err != nil && (version != 0 || !errors.Is(err, ErrNoteNotFound)) {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// trashOwner matches the notes the user $1 may restore or delete for good:
+// their personal notes and, as long as they are a member of the workspace,
+// the workspace notes they wrote or administer.
+const trashOwner = `CASE WHEN workspace_id IS NULL THEN user_id = $1
+	ELSE EXISTS (SELECT 1 FROM workspace_members m
+		WHERE m.workspace_id = notes.workspace_id AND m.user_id = $1
+			AND (m.role IN ('owner', 'admin') OR notes.user_id = $1)) END`
+
+// GetTrashedNotes lists the trashed notes of the user, or of the workspace
+// when workspaceId is not zero, most recently deleted first.
+func (r *NotesDbRepository) GetTrashedNotes(userid, workspaceId int) (*[]Note, error) {
+	return r.queryNotes(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE deleted_at IS NOT NULL AND COALESCE(workspace_id, 0) = $2 AND (`+trashOwner+`)
+		ORDER BY deleted_at DESC`,
+		userid,
+		workspaceId)
+}
+
+func (r *NotesDbRepository) RestoreNote(userid, id int) error {
+	res, err := r.db.Exec(
+		`UPDATE notes SET deleted_at = NULL, version = version + 1
+		WHERE id = $2 AND deleted_at IS NOT NULL AND (`+trashOwner+`)`,
+		userid,
+		id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently deletes the trashed notes of the user, or of the
+// workspace when workspaceId is not zero, and returns how many were removed.
+func (r *NotesDbRepository) EmptyTrash(userid, workspaceId int) (int64, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM notes
+		WHERE deleted_at IS NOT NULL AND COALESCE(workspace_id, 0) = $2 AND (`+trashOwner+`)`,
+		userid,
+		workspaceId)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// PurgeDeletedNotes permanently deletes notes trashed more than
+// retentionDays ago and returns how many were removed.
+func (r *NotesDbRepository) PurgeDeletedNotes(retentionDays int) (int64, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM notes WHERE deleted_at < NOW() - make_interval(days => $1)`,
+		retentionDays)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *NotesDbRepository) GetNoteRevisions(noteId int) (*[]Revision, error) {
+	var revisions []Revision
+	rows, err := r.db.Query(
+		`SELECT id, note_id, revision, title, body, created_at FROM note_revisions
+		WHERE note_id = $1 ORDER BY revision DESC`,
+		noteId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &note, nil
+	for rows.Next() {
+		var revision Revision
+		if err := rows.Scan(
+			&revision.Id,
+			&revision.NoteId,
+			&revision.Revision,
+			&revision.Title,
+			&revision.Body,
+			&revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return &revisions, rows.Err()
 }
 
-func (r *NotesDbRepository) GetUserNotes(userid int) (*[]Note, error) {
-	var notes []Note
-	rows, err := r.db.Query(`SELECT * FROM notes WHERE user_id = $1`, userid)
+func (r *NotesDbRepository) GetNoteRevision(noteId, revision int) (*Revision, error) {
+	var rev Revision
+	err := r.db.QueryRow(
+		`SELECT id, note_id, revision, title, body, created_at FROM note_revisions
+		WHERE note_id = $1 AND revision = $2`,
+		noteId,
+		revision).
+		Scan(&rev.Id, &rev.NoteId, &rev.Revision, &rev.Title, &rev.Body, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// PruneNoteRevisions removes revisions that fall outside the retention policy:
+// everything but the last keepLast revisions and everything older than keepDays.
+// A zero limit disables that rule. The latest revision is always kept.
+func (r *NotesDbRepository) PruneNoteRevisions(noteId, keepLast, keepDays int) error {
+	if keepLast <= 0 && keepDays <= 0 {
+		return nil
+	}
+
+	_, err := r.db.Exec(
+		`WITH latest AS (SELECT MAX(revision) AS revision FROM note_revisions WHERE note_id = $1)
+		DELETE FROM note_revisions
+		WHERE note_id = $1
+			AND revision < (SELECT revision FROM latest)
+			AND (($2 > 0 AND revision <= (SELECT revision FROM latest) - $2)
+				OR ($3 > 0 AND created_at < NOW() - make_interval(days => $3)))`,
+		noteId,
+		keepLast,
+		keepDays)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExecuteBulk runs the operations in a single transaction. In atomic mode
+// the first failing operation rolls everything back and ends the batch, so
+// the returned results stop at that operation. Otherwise every operation is
+// isolated by a savepoint and only failed operations are undone. Notes are
+// created in the workspace unless workspaceId is zero. authorize fails the
+// operations on notes the user lacks role on: RoleOwner to delete them,
+// RoleEditor for the rest.
+func (r *NotesDbRepository) ExecuteBulk(
+	userid, workspaceId int,
+	operations []BulkOperation,
+	atomic bool,
+	authorize func(note *Note, role string) error) ([]BulkResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]BulkResult, 0, len(operations))
+	for _, operation := range operations {
+		if !atomic {
+			if _, err := tx.Exec(`SAVEPOINT bulk_operation`); err != nil {
+				return nil, err
+			}
+		}
+
+		id, err := executeBulkOperation(tx, userid, workspaceId, operation, authorize)
+		results = append(results, BulkResult{Id: id, Err: err})
+
+		switch {
+		case err != nil && atomic:
+			return results, nil
+		case err != nil:
+			_, err = tx.Exec(`ROLLBACK TO SAVEPOINT bulk_operation`)
+		case !atomic:
+			_, err = tx.Exec(`RELEASE SAVEPOINT bulk_operation`)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, tx.Commit()
+}
+
+func executeBulkOperation(tx *sql.Tx, userid, workspaceId int, operation BulkOperation, authorize func(*Note, string) error) (int, error) {
+	if operation.Op == BulkCreate {
+		var title, body string
+		if operation.Title != nil {
+			title = *operation.Title
+		}
+		if operation.Body != nil {
+			body = *operation.Body
+		}
+		id, err := createNote(tx, userid, title, body, operation.Tags)
+		if err != nil || workspaceId == 0 {
+			return id, err
+		}
+		_, err = tx.Exec(`UPDATE notes SET workspace_id = $2 WHERE id = $1`, id, workspaceId)
+		return id, err
+	}
+
+	note, err := lockNote(tx, operation.Id)
+	if err != nil {
+		return operation.Id, err
+	}
+
+	role := RoleEditor
+	if operation.Op == BulkDelete {
+		role = RoleOwner
+	}
+	if err := authorize(note, role); err != nil {
+		return note.Id, err
+	}
+
+	var update NoteUpdate
+	switch operation.Op {
+	case BulkUpdate:
+		update = NoteUpdate{Title: operation.Title, Body: operation.Body}
+	case BulkDelete:
+		return note.Id, deleteNote(tx, note.Id, operation.Version)
+	case BulkTag:
+		tags := append(note.Tags, operation.Tags...)
+		update = NoteUpdate{Tags: &tags}
+	case BulkMove:
+		update = NoteUpdate{Tags: &operation.Tags}
+	case BulkArchive:
+		archived := true
+		if operation.Archived != nil {
+			archived = *operation.Archived
+		}
+		update = NoteUpdate{Archived: &archived}
+	default:
+		return note.Id, ErrUnknownOperation
+	}
+
+	return note.Id, updateNote(tx, note.Id, update, operation.Version)
+}
+
+// lockNote locks the note for the rest of the transaction.
+func lockNote(tx *sql.Tx, id int) (*Note, error) {
+	note, err := scanNote(tx.QueryRow(
+		`SELECT `+noteColumns+` FROM notes WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoteNotFound
+	}
+
+	return note, err
+}
+
+// linkScope matches the notes t whose wiki links resolve among the notes s:
+// the personal notes of the same user or the notes of the same workspace.
+const linkScope = `t.workspace_id IS NOT DISTINCT FROM s.workspace_id
+	AND (s.workspace_id IS NOT NULL OR t.user_id = s.user_id)`
+
+// noteScope matches the notes s of the user $1 when $2 is zero and the notes
+// of the workspace $2 otherwise, like GetUserNotes.
+const noteScope = `CASE WHEN $2 = 0 THEN s.user_id = $1 AND s.workspace_id IS NULL
+	ELSE s.workspace_id = $2 END`
+
+// GetBacklinks lists the notes of the same user, or of the same workspace for
+// workspace notes, that link to the title of the note, leaving out the ones
+// userid cannot read: only their personal notes, the notes of their
+// workspaces and the notes shared with them are listed.
+func (r *NotesDbRepository) GetBacklinks(noteId, userid int) (*[]Note, error) {
+	return r.queryNotes(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE deleted_at IS NULL AND id <> $1
+			AND id IN (SELECT l.source_note_id FROM note_links l
+				JOIN notes s ON s.id = l.source_note_id
+				JOIN notes t ON lower(l.target_title) = lower(t.title) AND `+linkScope+`
+				WHERE t.id = $1)
+			AND (CASE WHEN workspace_id IS NULL THEN user_id = $2
+				ELSE workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $2) END
+				OR id IN (SELECT note_id FROM note_shares WHERE user_id = $2))
+		ORDER BY updated_at DESC, id DESC`,
+		noteId,
+		userid)
+}
+
+// GetDanglingLinks lists the wiki links of the personal notes of the user,
+// or of the notes of the workspace when workspaceId is not zero, that no
+// note resolves.
+func (r *NotesDbRepository) GetDanglingLinks(userid, workspaceId int) (*[]DanglingLink, error) {
+	links := []DanglingLink{}
+	rows, err := r.db.Query(
+		`SELECT s.id, s.title, l.target_title FROM note_links l
+		JOIN notes s ON s.id = l.source_note_id
+		WHERE `+noteScope+` AND s.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM notes t
+				WHERE `+linkScope+` AND t.deleted_at IS NULL
+					AND lower(t.title) = lower(l.target_title))
+		ORDER BY s.id, lower(l.target_title)`,
+		userid,
+		workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link DanglingLink
+		if err := rows.Scan(&link.SourceNoteId, &link.SourceTitle, &link.TargetTitle); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return &links, rows.Err()
+}
+
+// GetNoteGraph returns the personal notes of the user, or the notes of the
+// workspace when workspaceId is not zero, as nodes and the resolved wiki
+// links between them as edges. A link to a title shared by several notes
+// leads to each of them.
+func (r *NotesDbRepository) GetNoteGraph(userid, workspaceId int) (*Graph, error) {
+	graph := Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	rows, err := r.db.Query(
+		`SELECT s.id, s.title FROM notes s WHERE `+noteScope+` AND s.deleted_at IS NULL ORDER BY s.id`,
+		userid,
+		workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node GraphNode
+		if err := rows.Scan(&node.Id, &node.Title); err != nil {
+			return nil, err
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	edges, err := r.db.Query(
+		`SELECT DISTINCT s.id, t.id FROM note_links l
+		JOIN notes s ON s.id = l.source_note_id
+		JOIN notes t ON `+linkScope+` AND lower(t.title) = lower(l.target_title)
+		WHERE `+noteScope+` AND s.deleted_at IS NULL AND t.deleted_at IS NULL
+		ORDER BY s.id, t.id`,
+		userid,
+		workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer edges.Close()
+
+	for edges.Next() {
+		var edge GraphEdge
+		if err := edges.Scan(&edge.Source, &edge.Target); err != nil {
+			return nil, err
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	return &graph, edges.Err()
+}
+
+// GetOrCreateDailyNote returns the daily note of the user for the date and
+// creates it with title and body if there is none. The second result tells
+// whether the note was created. A daily note in the trash no longer counts
+// and becomes a regular note.
+func (r *NotesDbRepository) GetOrCreateDailyNote(
+	userid int,
+	date, title, body string) (*Note, bool, error) {
+	note, err := r.getDailyNote(userid, date)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return note, false, err
+	}
+
+	id, err := r.createDailyNote(userid, date, title, body)
+	if isUniqueViolation(err) {
+		// Created by a concurrent request.
+		note, err := r.getDailyNote(userid, date)
+		return note, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	note, err = r.GetNote(id)
+	return note, true, err
+}
+
+// GetDailyNotes lists the daily notes of the user from one date to another,
+// both inclusive.
+func (r *NotesDbRepository) GetDailyNotes(userid int, from, to string) (*[]Note, error) {
+	return r.queryNotes(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE user_id = $1 AND deleted_at IS NULL
+			AND daily_date BETWEEN $2::date AND $3::date
+		ORDER BY daily_date`,
+		userid,
+		from,
+		to)
+}
+
+func (r *NotesDbRepository) getDailyNote(userid int, date string) (*Note, error) {
+	return scanNote(r.db.QueryRow(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE user_id = $1 AND daily_date = $2::date AND deleted_at IS NULL`,
+		userid,
+		date))
+}
+
+func (r *NotesDbRepository) createDailyNote(userid int, date, title, body string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE notes SET daily_date = NULL
+		WHERE user_id = $1 AND daily_date = $2::date AND deleted_at IS NOT NULL`,
+		userid,
+		date)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := createNote(tx, userid, title, body, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE notes SET daily_date = $1::date WHERE id = $2`, date, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetNoteShares lists the users the note is shared with.
+func (r *NotesDbRepository) GetNoteShares(noteId int) (*[]Share, error) {
+	shares := []Share{}
+	rows, err := r.db.Query(
+		`SELECT s.note_id, s.user_id, u.email, s.role, s.created_at
+		FROM note_shares s JOIN users u ON u.id = s.user_id
+		WHERE s.note_id = $1
+		ORDER BY s.created_at, s.user_id`,
+		noteId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var note Note
-		if err := rows.Scan(&note.Id, &note.UserId, &note.Title, &note.Body, &note.CreatedAt); err != nil {
+		share, err := scanShare(rows)
+		if err != nil {
 			return nil, err
 		}
-		notes = append(notes, note)
+		shares = append(shares, *share)
+	}
+
+	return &shares, rows.Err()
+}
+
+func (r *NotesDbRepository) GetNoteShare(noteId, userid int) (*Share, error) {
+	share, err := scanShare(r.db.QueryRow(
+		`SELECT s.note_id, s.user_id, u.email, s.role, s.created_at
+		FROM note_shares s JOIN users u ON u.id = s.user_id
+		WHERE s.note_id = $1 AND s.user_id = $2`,
+		noteId,
+		userid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrShareNotFound
 	}
 
-	return &notes, nil
+	return share, err
 }
 
-func (r *NotesDbRepository) CreateNote(user_id int, title, body string) error {
+// ShareNote grants the user the role on the note, replacing the role
+// granted before.
+func (r *NotesDbRepository) ShareNote(noteId, userid int, role string) error {
 	_, err := r.db.Exec(
-		`INSERT INTO notes (user_id, title, body, created_at) VALUES ($1, $2, $3, NOW())`,
-		user_id,
-		title,
-		body)
+		`INSERT INTO note_shares (note_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (note_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		noteId,
+		userid,
+		role)
+
+	return err
+}
+
+func (r *NotesDbRepository) UnshareNote(noteId, userid int) error {
+	res, err := r.db.Exec(`DELETE FROM note_shares WHERE note_id = $1 AND user_id = $2`, noteId, userid)
 	if err != nil {
 		return err
 	}
 
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrShareNotFound
+	}
+
 	return nil
 }
 
-func (r *NotesDbRepository) UpdateNote(id int, title, body string) error {
-	res, err := r.db.Exec(
-		`UPDATE notes SET title = $1, body = $2 WHERE id = $3`,
+// GetSharedNotes lists the notes of other users shared with the user,
+// recently updated first.
+func (r *NotesDbRepository) GetSharedNotes(userid int) (*[]SharedNote, error) {
+	shared := []SharedNote{}
+	rows, err := r.db.Query(
+		`SELECT `+noteColumns+`, role, owner_email FROM (
+			SELECT n.*, s.role, u.email AS owner_email
+			FROM notes n
+			JOIN note_shares s ON s.note_id = n.id
+			JOIN users u ON u.id = n.user_id
+			WHERE s.user_id = $1 AND n.deleted_at IS NULL
+		) AS shared
+		ORDER BY updated_at DESC, id DESC`,
+		userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item SharedNote
+		note, err := scanNote(extraColumns{rows, []any{&item.Role, &item.OwnerEmail}})
+		if err != nil {
+			return nil, err
+		}
+		item.Note = *note
+		shared = append(shared, item)
+	}
+
+	return &shared, rows.Err()
+}
+
+// GetNoteChanges returns up to limit changes after the change sequence
+// number since, oldest first: personal notes of the user, or notes of the
+// workspace when workspaceId is not zero, those in the trash included, and
+// tombstones of notes deleted for good or moved out of them.
+//
+// Transactions running while changes are read may still commit changes with
+// lower numbers. Such changes are left out, and the oldest transaction that
+// was running is returned as xmin. Passed back with the number of the last
+// change read, the changes those transactions commit are returned then. A
+// zero xmin returns only the changes after since.
+func (r *NotesDbRepository) GetNoteChanges(userid, workspaceId int, since, xmin int64, limit int) (*[]Change, int64, error) {
+	var current int64
+	err := r.db.QueryRow(`SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&current)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+noteColumns+`, change_seq FROM notes
+		WHERE (change_seq > $3 OR ($5::bigint <> 0 AND xact_id >= $5::bigint::text::xid8))
+			AND xact_id < $6::bigint::text::xid8
+			AND CASE WHEN $2 = 0 THEN user_id = $1 AND workspace_id IS NULL ELSE workspace_id = $2 END
+		ORDER BY change_seq
+		LIMIT $4`,
+		userid,
+		workspaceId,
+		since,
+		limit,
+		xmin,
+		current)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var changed []Change
+	for rows.Next() {
+		var change Change
+		change.Note, err = scanNote(extraColumns{rows, []any{&change.Seq}})
+		if err != nil {
+			return nil, 0, err
+		}
+		change.NoteId = change.Note.Id
+		changed = append(changed, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err = r.db.Query(
+		`SELECT note_id, change_seq FROM note_tombstones
+		WHERE (change_seq > $3 OR ($5::bigint <> 0 AND xact_id >= $5::bigint::text::xid8))
+			AND xact_id < $6::bigint::text::xid8
+			AND CASE WHEN $2 = 0 THEN user_id = $1 AND workspace_id IS NULL ELSE workspace_id = $2 END
+		ORDER BY change_seq
+		LIMIT $4`,
+		userid,
+		workspaceId,
+		since,
+		limit,
+		xmin,
+		current)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var deleted []Change
+	for rows.Next() {
+		var change Change
+		err := rows.Scan(&change.NoteId, &change.Seq)
+		if err != nil {
+			return nil, 0, err
+		}
+		deleted = append(deleted, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Both lists are ordered, the first limit changes of both are kept.
+	changes := make([]Change, 0, min(len(changed)+len(deleted), limit))
+	for len(changes) < limit && (len(changed) > 0 || len(deleted) > 0) {
+		if len(deleted) == 0 || (len(changed) > 0 && changed[0].Seq < deleted[0].Seq) {
+			changes = append(changes, changed[0])
+			changed = changed[1:]
+		} else {
+			changes = append(changes, deleted[0])
+			deleted = deleted[1:]
+		}
+	}
+
+	return &changes, current, nil
+}
+
+// GetOrCreateClientNote creates a note made offline by a client, which tells
+// it apart by clientId, in the workspace or in the notes of the user if it
+// is nil. The note the user created with the same clientId before is
+// returned instead, so that a retried upload does not create it again.
+func (r *NotesDbRepository) GetOrCreateClientNote(
+	userid int,
+	workspaceId *int,
+	clientId, title, body string) (*Note, bool, error) {
+	note, err := r.getClientNote(userid, clientId)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return note, false, err
+	}
+
+	id, err := r.createClientNote(userid, workspaceId, clientId, title, body)
+	if isUniqueViolation(err) {
+		// Created by a concurrent request.
+		note, err := r.getClientNote(userid, clientId)
+		return note, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	note, err = r.GetNote(id)
+	return note, true, err
+}
+
+func (r *NotesDbRepository) getClientNote(userid int, clientId string) (*Note, error) {
+	return scanNote(r.db.QueryRow(
+		`SELECT `+noteColumns+` FROM notes
+		WHERE id = (SELECT note_id FROM sync_client_ids WHERE user_id = $1 AND client_id = $2)`,
+		userid,
+		clientId))
+}
+
+func (r *NotesDbRepository) createClientNote(userid int, workspaceId *int, clientId, title, body string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createNote(tx, userid, title, body, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if workspaceId != nil {
+		_, err = tx.Exec(`UPDATE notes SET workspace_id = $2 WHERE id = $1`, id, *workspaceId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO sync_client_ids (user_id, client_id, note_id) VALUES ($1, $2, $3)`,
+		userid,
+		clientId,
+		id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *NotesDbRepository) queryNotes(query string, args ...any) (*[]Note, error) {
+	var notes []Note
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, *note)
+	}
+
+	return &notes, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// extraColumns scans the columns following the note columns of a row.
+type extraColumns struct {
+	row  scanner
+	dest []any
+}
+
+func (e extraColumns) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.dest...)...)
+}
+
+func scanShare(row scanner) (*Share, error) {
+	var share Share
+	err := row.Scan(
+		&share.NoteId,
+		&share.UserId,
+		&share.Email,
+		&share.Role,
+		&share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+func scanNote(row scanner) (*Note, error) {
+	var note Note
+	err := row.Scan(
+		&note.Id,
+		&note.UserId,
+		&note.Title,
+		&note.Body,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+		&note.Version,
+		&note.DeletedAt,
+		&note.Pinned,
+		&note.PinnedAt,
+		&note.Archived,
+		&note.ArchivedAt,
+		&note.Favorite,
+		&note.FavoritedAt,
+		pq.Array(&note.Tags),
+		&note.DailyDate,
+		&note.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &note, nil
+}
+
+func createNote(tx *sql.Tx, userid int, title, body string, tags []string) (int, error) {
+	var id int
+	err := tx.QueryRow(
+		`INSERT INTO notes (user_id, title, body, tags, created_at)
+		VALUES ($1, $2, $3, $4, NOW()) RETURNING id`,
+		userid,
 		title,
 		body,
-		id)
+		pq.Array(NormalizeTags(tags))).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertRevision(tx, id, title, body)
+	if err != nil {
+		return 0, err
+	}
+
+	err = syncLinks(tx, id, body)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func updateNote(tx *sql.Tx, id int, update NoteUpdate, version int) error {
+	var tags any
+	if update.Tags != nil {
+		tags = pq.Array(NormalizeTags(*update.Tags))
+	}
+
+	var oldTitle string
+	if update.RewriteLinks && update.Title != nil {
+		err := tx.QueryRow(
+			`SELECT title FROM notes WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+			id).Scan(&oldTitle)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoteNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var userid int
+	var title, body string
+	err := tx.QueryRow(
+		`UPDATE notes SET
+			title = COALESCE($1, title),
+			body = COALESCE($2, body),
+			pinned = COALESCE($5::boolean, pinned),
+			pinned_at = CASE WHEN $5::boolean IS NULL OR $5::boolean = pinned THEN pinned_at
+				WHEN $5::boolean THEN NOW() END,
+			archived = COALESCE($6::boolean, archived),
+			archived_at = CASE WHEN $6::boolean IS NULL OR $6::boolean = archived THEN archived_at
+				WHEN $6::boolean THEN NOW() END,
+			favorite = COALESCE($7::boolean, favorite),
+			favorited_at = CASE WHEN $7::boolean IS NULL OR $7::boolean = favorite THEN favorited_at
+				WHEN $7::boolean THEN NOW() END,
+			tags = COALESCE($8::text[], tags),
+			version = version + 1
+		WHERE id = $3 AND deleted_at IS NULL AND ($4 = 0 OR version = $4)
+		RETURNING user_id, title, COALESCE(body, '')`,
+		update.Title,
+		update.Body,
+		id,
+		version,
+		update.Pinned,
+		update.Archived,
+		update.Favorite,
+		tags).Scan(&userid, &title, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missingNoteError(tx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if update.Title != nil || update.Body != nil {
+		err = insertRevision(tx, id, title, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if update.Body != nil {
+		err = syncLinks(tx, id, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if update.RewriteLinks && update.Title != nil && oldTitle != title {
+		return rewriteLinks(tx, userid, id, oldTitle, title)
+	}
+
+	return nil
+}
+
+func deleteNote(tx *sql.Tx, id int, version int) error {
+	res, err := tx.Exec(
+		`UPDATE notes SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)`,
+		id,
+		version)
 	if err != nil {
 		return err
 	}
 
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		return errors.New("NoteNotFound")
+		return missingNoteError(tx, id)
 	}
 
 	return nil
 }
 
-func (r *NotesDbRepository) DeleteNote(id int) error {
-	_, err := r.db.Exec(`DELETE FROM notes WHERE id = $1`, id)
+// syncLinks replaces the stored wiki links of the note with those in body.
+func syncLinks(tx *sql.Tx, noteId int, body string) error {
+	_, err := tx.Exec(`DELETE FROM note_links WHERE source_note_id = $1`, noteId)
+	if err != nil {
+		return err
+	}
+
+	titles := markdown.WikiLinks(body)
+	if len(titles) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO note_links (source_note_id, target_title)
+		SELECT $1, title FROM unnest($2::text[]) AS title`,
+		noteId,
+		pq.Array(titles))
+
+	return err
+}
+
+// rewriteLinks points the wiki links to oldTitle in the other notes the links
+// of the note resolve among at newTitle: the personal notes of the user or
+// the notes of the workspace of the note. Each rewritten note gets a new
+// version and revision.
+func rewriteLinks(tx *sql.Tx, userid, noteId int, oldTitle, newTitle string) error {
+	rows, err := tx.Query(
+		`SELECT s.id, COALESCE(s.body, '') FROM notes s
+		JOIN notes t ON t.id = $2 AND t.user_id = $1 AND `+linkScope+`
+		WHERE s.id <> $2 AND s.deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM note_links l
+				WHERE l.source_note_id = s.id AND lower(l.target_title) = lower($3))
+		FOR UPDATE OF s`,
+		userid,
+		noteId,
+		strings.TrimSpace(oldTitle))
 	if err != nil {
 		return err
 	}
 
+	bodies := map[int]string{}
+	for rows.Next() {
+		var id int
+		var body string
+		if err := rows.Scan(&id, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		bodies[id] = body
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, body := range bodies {
+		body = markdown.RewriteWikiLinks(body, oldTitle, newTitle)
+		if err := updateNote(tx, id, NoteUpdate{Body: &body}, 0); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// insertRevision records the next revision of the note. The note row is
+// locked first, so that concurrent writers of a note number their revisions
+// one after the other instead of both taking the same number.
+func insertRevision(tx *sql.Tx, noteId int, title, body string) error {
+	_, err := tx.Exec(`SELECT 1 FROM notes WHERE id = $1 FOR UPDATE`, noteId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO note_revisions (note_id, revision, title, body, created_at)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, NOW()
+		FROM note_revisions WHERE note_id = $1`,
+		noteId,
+		title,
+		body)
+
+	return err
+}
+
+// missingNoteError tells apart a missing note from a failed version check
+// after a conditional write affected no rows.
+func missingNoteError(tx *sql.Tx, id int) error {
+	var exists bool
+	err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM notes WHERE id = $1 AND deleted_at IS NULL)`,
+		id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrVersionMismatch
+	}
+
+	return ErrNoteNotFound
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
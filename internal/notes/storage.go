@@ -1,9 +1,157 @@
 package notes
 
+import "time"
+
 type Note struct {
-	Id        int    `json:"id"`
-	UserId    int    `json:"user_id"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	CreatedAt string `json:"created_at"`
+	Id        int        `json:"id"`
+	UserId    int        `json:"user_id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	Pinned      bool       `json:"pinned"`
+	PinnedAt    *time.Time `json:"pinned_at,omitempty"`
+	Archived    bool       `json:"archived"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	Favorite    bool       `json:"favorite"`
+	FavoritedAt *time.Time `json:"favorited_at,omitempty"`
+
+	Tags []string `json:"tags"`
+
+	// DailyDate is set on daily notes, formatted as 2006-01-02.
+	DailyDate *string `json:"daily_date,omitempty"`
+	// WorkspaceId is set on notes owned by a workspace. UserId is then the
+	// author of the note.
+	WorkspaceId *int `json:"workspace_id,omitempty"`
+}
+
+// In converts the timestamps of the note to the given location.
+func (n *Note) In(loc *time.Location) {
+	n.CreatedAt = n.CreatedAt.In(loc)
+	n.UpdatedAt = n.UpdatedAt.In(loc)
+	for _, t := range []*time.Time{n.DeletedAt, n.PinnedAt, n.ArchivedAt, n.FavoritedAt} {
+		if t != nil {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// NotesFilter narrows note listings. Archived notes are only listed, and
+// then exclusively, when Archived is set. A non-zero WorkspaceId lists the
+// notes of the workspace instead of the personal notes of the user. Query
+// matches a substring of the title or body, ignoring case.
+type NotesFilter struct {
+	Archived    bool
+	Favorites   bool
+	Tag         string
+	WorkspaceId int
+	Query       string
+}
+
+// NoteUpdate lists the note fields to change. Nil fields are left untouched.
+// RewriteLinks makes a change of Title also update the wiki links pointing
+// at the old title in the other notes of the owner.
+type NoteUpdate struct {
+	Title    *string
+	Body     *string
+	Pinned   *bool
+	Archived *bool
+	Favorite *bool
+	Tags     *[]string
+
+	RewriteLinks bool
+}
+
+const (
+	BulkCreate  = "create"
+	BulkUpdate  = "update"
+	BulkDelete  = "delete"
+	BulkTag     = "tag"
+	BulkMove    = "move"
+	BulkArchive = "archive"
+)
+
+// BulkOperation is a single item of a bulk request. Tag adds Tags to the
+// note, Move replaces its tags with Tags, Archive sets Archived (true when
+// omitted).
+type BulkOperation struct {
+	Op       string
+	Id       int
+	Version  int
+	Title    *string
+	Body     *string
+	Tags     []string
+	Archived *bool
+}
+
+// BulkResult holds the id of the affected note or the error of the item.
+type BulkResult struct {
+	Id  int
+	Err error
+}
+
+type Revision struct {
+	Id        int       `json:"id"`
+	NoteId    int       `json:"note_id"`
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DanglingLink is a wiki link to a title no note of the user has.
+type DanglingLink struct {
+	SourceNoteId int    `json:"source_note_id"`
+	SourceTitle  string `json:"source_title"`
+	TargetTitle  string `json:"target_title"`
+}
+
+type GraphNode struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type GraphEdge struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+}
+
+// Graph is the wiki link graph of the notes of a user.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Share grants a user other than the owner access to a note. Viewers can
+// read the note, editors can also change it.
+type Share struct {
+	NoteId    int       `json:"note_id"`
+	UserId    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedNote is a note of another user shared with the reader.
+type SharedNote struct {
+	Note
+	Role       string `json:"role"`
+	OwnerEmail string `json:"owner_email"`
+}
+
+// Change is a note created, updated or deleted after a change sequence
+// number. Note is nil on the tombstones of notes deleted for good.
+type Change struct {
+	Seq    int64
+	NoteId int
+	Note   *Note
 }
@@ -0,0 +1,20 @@
+package notes
+
+import "strings"
+
+// NormalizeTags trims tags and drops empty and duplicate ones, keeping the
+// original order. The result is never nil.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
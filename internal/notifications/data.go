@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type NotificationsRepository interface {
+	GetNotifications(userid int, filter Filter) (*[]Notification, error)
+	CountUnread(userid int) (int, error)
+	CreateNotification(notification Notification) (int, error)
+	MarkRead(id, userid int) error
+	MarkAllRead(userid int) (int64, error)
+	GetPreferences(userid int) (*[]Preference, error)
+	UpdatePreferences(userid int, preferences []Preference) error
+}
+
+var ErrNotificationNotFound = errors.New("NotificationNotFound")
+
+type NotificationsDbRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationsDbRepository(db *sql.DB) *NotificationsDbRepository {
+	return &NotificationsDbRepository{db: db}
+}
+
+func (r *NotificationsDbRepository) GetNotifications(userid int, filter Filter) (*[]Notification, error) {
+	list := []Notification{}
+	rows, err := r.db.Query(
+		`SELECT n.id, n.user_id, n.type, n.actor_id, u.email, n.note_id, n.comment_id,
+			n.text, n.read_at, n.created_at
+		FROM notifications n LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4`,
+		userid,
+		filter.Unread,
+		filter.Limit,
+		filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&notification.Id,
+			&notification.UserId,
+			&notification.Type,
+			&notification.ActorId,
+			&notification.ActorEmail,
+			&notification.NoteId,
+			&notification.CommentId,
+			&notification.Text,
+			&notification.ReadAt,
+			&notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, notification)
+	}
+
+	return &list, rows.Err()
+}
+
+func (r *NotificationsDbRepository) CountUnread(userid int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userid).Scan(&count)
+
+	return count, err
+}
+
+func (r *NotificationsDbRepository) CreateNotification(notification Notification) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO notifications (user_id, type, actor_id, note_id, comment_id, text)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		notification.UserId,
+		notification.Type,
+		notification.ActorId,
+		notification.NoteId,
+		notification.CommentId,
+		notification.Text).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *NotificationsDbRepository) MarkRead(id, userid int) error {
+	res, err := r.db.Exec(
+		`UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`,
+		id,
+		userid)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and
+// returns how many there were.
+func (r *NotificationsDbRepository) MarkAllRead(userid int) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`,
+		userid)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetPreferences returns the preferences of the user for every type, the
+// defaults for types the user has not set one for.
+func (r *NotificationsDbRepository) GetPreferences(userid int) (*[]Preference, error) {
+	defaults := DefaultPreference("")
+	preferences := []Preference{}
+	rows, err := r.db.Query(
+		`SELECT t.type, COALESCE(p.in_app, $3), COALESCE(p.email, $4)
+		FROM unnest($2::text[]) WITH ORDINALITY AS t(type, position)
+		LEFT JOIN notification_preferences p ON p.user_id = $1 AND p.type = t.type
+		ORDER BY t.position`,
+		userid,
+		pq.Array(Types),
+		defaults.InApp,
+		defaults.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var preference Preference
+		err := rows.Scan(&preference.Type, &preference.InApp, &preference.Email)
+		if err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, preference)
+	}
+
+	return &preferences, rows.Err()
+}
+
+func (r *NotificationsDbRepository) UpdatePreferences(userid int, preferences []Preference) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, preference := range preferences {
+		_, err := tx.Exec(
+			`INSERT INTO notification_preferences (user_id, type, in_app, email) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, type) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email`,
+			userid,
+			preference.Type,
+			preference.InApp,
+			preference.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,55 @@
+package notifications
+
+import "time"
+
+const (
+	TypeMention = "mention"
+	TypeShare   = "share"
+	TypeComment = "comment"
+)
+
+// Types lists the kinds of notifications users have preferences for.
+var Types = []string{TypeMention, TypeShare, TypeComment}
+
+// Notification tells a user that another user, the actor, mentioned them,
+// shared a note with them or commented on a note of theirs.
+type Notification struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"user_id"`
+	Type       string     `json:"type"`
+	ActorId    *int       `json:"actor_id"`
+	ActorEmail *string    `json:"actor_email"`
+	NoteId     *int       `json:"note_id"`
+	CommentId  *int       `json:"comment_id,omitempty"`
+	Text       string     `json:"text"`
+	ReadAt     *time.Time `json:"read_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// In converts the timestamps of the notification to the given location.
+func (n *Notification) In(loc *time.Location) {
+	n.CreatedAt = n.CreatedAt.In(loc)
+	if n.ReadAt != nil {
+		*n.ReadAt = n.ReadAt.In(loc)
+	}
+}
+
+// Preference tells how a user is notified of a type of notification: in
+// the inbox of the app, by email, both or not at all.
+type Preference struct {
+	Type  string `json:"type"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+}
+
+// DefaultPreference is used for types the user has not set a preference for.
+func DefaultPreference(notificationType string) Preference {
+	return Preference{Type: notificationType, InApp: true}
+}
+
+// Filter selects a page of the notifications of a user, newest first.
+type Filter struct {
+	Unread bool
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,147 @@
+package publiclinks
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type PublicLinksRepository interface {
+	GetLink(id int) (*Link, error)
+	GetLinkByToken(tokenHash string) (*Link, error)
+	GetNoteLinks(noteId int) (*[]Link, error)
+	CreateLink(link Link) (int, error)
+	RevokeLink(id int) error
+	RecordView(id int) (bool, error)
+}
+
+var ErrLinkNotFound = errors.New("LinkNotFound")
+
+const linkColumns = `id, note_id, token_hash, password_hash, expires_at, max_views, views,
+	last_viewed_at, revoked_at, created_at`
+
+type PublicLinksDbRepository struct {
+	db *sql.DB
+}
+
+func NewPublicLinksDbRepository(db *sql.DB) *PublicLinksDbRepository {
+	return &PublicLinksDbRepository{db: db}
+}
+
+func (r *PublicLinksDbRepository) GetLink(id int) (*Link, error) {
+	link, err := scanLink(r.db.QueryRow(`SELECT `+linkColumns+` FROM public_links WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLinkNotFound
+	}
+
+	return link, err
+}
+
+func (r *PublicLinksDbRepository) GetLinkByToken(tokenHash string) (*Link, error) {
+	link, err := scanLink(r.db.QueryRow(
+		`SELECT `+linkColumns+` FROM public_links WHERE token_hash = $1`,
+		tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLinkNotFound
+	}
+
+	return link, err
+}
+
+// GetNoteLinks lists the links of the note, revoked ones included, newest
+// first.
+func (r *PublicLinksDbRepository) GetNoteLinks(noteId int) (*[]Link, error) {
+	links := []Link{}
+	rows, err := r.db.Query(
+		`SELECT `+linkColumns+` FROM public_links WHERE note_id = $1 ORDER BY created_at DESC, id DESC`,
+		noteId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+
+	return &links, rows.Err()
+}
+
+func (r *PublicLinksDbRepository) CreateLink(link Link) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO public_links (note_id, token_hash, password_hash, expires_at, max_views)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		link.NoteId,
+		link.TokenHash,
+		link.PasswordHash,
+		link.ExpiresAt,
+		link.MaxViews).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *PublicLinksDbRepository) RevokeLink(id int) error {
+	res, err := r.db.Exec(
+		`UPDATE public_links SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`,
+		id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+// RecordView counts a view of the link if it is still active and reports
+// whether it was. Checking and counting in one statement keeps concurrent
+// views from exceeding the view limit.
+func (r *PublicLinksDbRepository) RecordView(id int) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE public_links SET views = views + 1, last_viewed_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+			AND (max_views IS NULL OR views < max_views)`,
+		id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row scanner) (*Link, error) {
+	var link Link
+	err := row.Scan(
+		&link.Id,
+		&link.NoteId,
+		&link.TokenHash,
+		&link.PasswordHash,
+		&link.ExpiresAt,
+		&link.MaxViews,
+		&link.Views,
+		&link.LastViewedAt,
+		&link.RevokedAt,
+		&link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	link.Protected = link.PasswordHash != nil
+
+	return &link, nil
+}
@@ -0,0 +1,46 @@
+package publiclinks
+
+import "time"
+
+// Link gives everyone who knows its token read access to a note, until it
+// is revoked, expires or has been viewed MaxViews times. Only the hashes of
+// the token and of the optional password are stored.
+type Link struct {
+	Id           int        `json:"id"`
+	NoteId       int        `json:"note_id"`
+	TokenHash    string     `json:"-"`
+	PasswordHash *string    `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxViews     *int       `json:"max_views"`
+	Views        int        `json:"views"`
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	Protected bool `json:"protected"`
+}
+
+// In converts the timestamps of the link to the given location.
+func (l *Link) In(loc *time.Location) {
+	l.CreatedAt = l.CreatedAt.In(loc)
+	for _, t := range []*time.Time{l.ExpiresAt, l.LastViewedAt, l.RevokedAt} {
+		if t != nil {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// Active reports whether the link can still be viewed at now.
+func (l *Link) Active(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return false
+	}
+	if l.MaxViews != nil && l.Views >= *l.MaxViews {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,349 @@
+package reminders
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type RemindersRepository interface {
+	GetReminder(id int) (*Reminder, error)
+	GetNoteReminders(noteId int) (*[]Reminder, error)
+	GetUserReminders(userid int) (*[]Reminder, error)
+	GetCalendarReminders(userid int) (*[]NoteReminder, error)
+	CreateReminder(reminder Reminder) (int, error)
+	DeleteReminder(id int) error
+	ClaimDueReminder(lease time.Duration) (*Due, error)
+	GetDeliveries(reminderId int, dueAt time.Time) ([]string, error)
+	AddDelivery(reminderId int, dueAt time.Time, channel string) error
+	FinishReminder(reminder Reminder, delivered bool) error
+}
+
+var ErrReminderNotFound = errors.New("ReminderNotFound")
+
+const (
+	// MaxAttempts is how often delivery of an occurrence is tried before it
+	// is skipped.
+	MaxAttempts = 5
+	// RetryDelay is multiplied by the number of failed attempts to get the
+	// delay before the next one.
+	RetryDelay = time.Minute
+)
+
+// noteAccess matches the notes n the user of the reminder r can still reach:
+// their personal notes and the notes of the workspaces they are a member of.
+const noteAccess = `CASE WHEN n.workspace_id IS NULL THEN n.user_id = r.user_id
+	ELSE n.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = r.user_id) END`
+
+const reminderColumns = `id, note_id, user_id, remind_at, rrule, time_zone, due_at, last_fired_at,
+	created_at, attempts`
+
+type RemindersDbRepository struct {
+	db *sql.DB
+}
+
+func NewRemindersDbRepository(db *sql.DB) *RemindersDbRepository {
+	return &RemindersDbRepository{db: db}
+}
+
+func (r *RemindersDbRepository) GetReminder(id int) (*Reminder, error) {
+	reminder, err := scanReminder(r.db.QueryRow(
+		`SELECT `+reminderColumns+` FROM reminders WHERE id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReminderNotFound
+	}
+
+	return reminder, err
+}
+
+func (r *RemindersDbRepository) GetNoteReminders(noteId int) (*[]Reminder, error) {
+	return r.queryReminders(
+		`SELECT `+reminderColumns+` FROM reminders
+		WHERE note_id = $1 ORDER BY due_at NULLS LAST, id`,
+		noteId)
+}
+
+// GetUserReminders lists the pending reminders of the user on notes that are
+// not in the trash and they can still reach, soonest first.
+func (r *RemindersDbRepository) GetUserReminders(userid int) (*[]Reminder, error) {
+	return r.queryReminders(
+		`SELECT `+reminderColumns+` FROM reminders r
+		WHERE user_id = $1 AND due_at IS NOT NULL
+			AND note_id IN (SELECT n.id FROM notes n WHERE n.deleted_at IS NULL AND `+noteAccess+`)
+		ORDER BY due_at, id`,
+		userid)
+}
+
+// GetCalendarReminders lists all reminders of the user on notes that are not
+// in the trash and they can still reach, including the ones that are done,
+// with the note titles.
+func (r *RemindersDbRepository) GetCalendarReminders(userid int) (*[]NoteReminder, error) {
+	list := []NoteReminder{}
+	rows, err := r.db.Query(
+		`SELECT r.id, r.note_id, r.user_id, r.remind_at, r.rrule, r.time_zone, r.due_at,
+			r.last_fired_at, r.created_at, r.attempts, n.title
+		FROM reminders r
+		JOIN notes n ON n.id = r.note_id AND n.deleted_at IS NULL AND `+noteAccess+`
+		WHERE r.user_id = $1
+		ORDER BY r.remind_at, r.id`,
+		userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item NoteReminder
+		reminder := &item.Reminder
+		if err := rows.Scan(
+			&reminder.Id,
+			&reminder.NoteId,
+			&reminder.UserId,
+			&reminder.RemindAt,
+			&reminder.RRule,
+			&reminder.TimeZone,
+			&reminder.DueAt,
+			&reminder.LastFiredAt,
+			&reminder.CreatedAt,
+			&reminder.Attempts,
+			&item.NoteTitle); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+
+	return &list, rows.Err()
+}
+
+func (r *RemindersDbRepository) CreateReminder(reminder Reminder) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO reminders (note_id, user_id, remind_at, rrule, time_zone, due_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		reminder.NoteId,
+		reminder.UserId,
+		reminder.RemindAt,
+		reminder.RRule,
+		reminder.TimeZone,
+		reminder.DueAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *RemindersDbRepository) DeleteReminder(id int) error {
+	res, err := r.db.Exec(`DELETE FROM reminders WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrReminderNotFound
+	}
+
+	return nil
+}
+
+// ClaimDueReminder returns the reminder that has been due the longest, or nil
+// when none is. Reminders on notes their user can no longer reach are not
+// fired. The reminder is held back from other callers for lease, long
+// enough to deliver it and call FinishReminder, so with several instances
+// running every occurrence is handed to one of them at a time.
+//
+// Every claim counts as an attempt, the returned reminder has the number of
+// the attempt it is claimed for. A claim that is never finished, because
+// its caller stopped, expires and the occurrence is tried again, so
+// delivery is at least once: a notifier may get an occurrence again when
+// its caller stopped before recording the delivery. Reminders claimed
+// more than MaxAttempts times are to be finished without delivery.
+func (r *RemindersDbRepository) ClaimDueReminder(lease time.Duration) (*Due, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var due Due
+	reminder := &due.Reminder
+	err = tx.QueryRow(
+		`SELECT r.id, r.note_id, r.user_id, r.remind_at, r.rrule, r.time_zone, r.due_at,
+			r.last_fired_at, r.created_at, r.attempts, n.title, u.email
+		FROM reminders r
+		JOIN notes n ON n.id = r.note_id AND n.deleted_at IS NULL AND `+noteAccess+`
+		JOIN users u ON u.id = r.user_id
+		WHERE r.due_at IS NOT NULL AND COALESCE(r.retry_at, r.due_at) <= NOW()
+		ORDER BY COALESCE(r.retry_at, r.due_at)
+		LIMIT 1
+		FOR UPDATE OF r SKIP LOCKED`).Scan(
+		&reminder.Id,
+		&reminder.NoteId,
+		&reminder.UserId,
+		&reminder.RemindAt,
+		&reminder.RRule,
+		&reminder.TimeZone,
+		&reminder.DueAt,
+		&reminder.LastFiredAt,
+		&reminder.CreatedAt,
+		&reminder.Attempts,
+		&due.NoteTitle,
+		&due.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE reminders SET attempts = attempts + 1, retry_at = NOW() + make_interval(secs => $2)
+		WHERE id = $1`,
+		reminder.Id,
+		lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	reminder.Attempts++
+
+	return &due, tx.Commit()
+}
+
+// GetDeliveries lists the channels the occurrence of the reminder at dueAt
+// was already delivered through.
+func (r *RemindersDbRepository) GetDeliveries(reminderId int, dueAt time.Time) ([]string, error) {
+	channels := []string{}
+	rows, err := r.db.Query(
+		`SELECT channel FROM reminder_deliveries
+		WHERE reminder_id = $1 AND due_at = $2 ORDER BY channel`,
+		reminderId,
+		dueAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+// AddDelivery records that the occurrence of the reminder at dueAt was
+// delivered through channel.
+func (r *RemindersDbRepository) AddDelivery(reminderId int, dueAt time.Time, channel string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO reminder_deliveries (reminder_id, due_at, channel) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		reminderId,
+		dueAt,
+		channel)
+
+	return err
+}
+
+// FinishReminder ends a claimed occurrence of the reminder. An occurrence
+// that was not delivered through every channel is retried after RetryDelay
+// times the number of failed attempts; after MaxAttempts it is skipped.
+// Otherwise the reminder is advanced to its next occurrence. Occurrences
+// missed while no instance was running are fired once, not one by one.
+//
+// Nothing is changed when the occurrence was finished or the reminder was
+// rescheduled in the meantime.
+func (r *RemindersDbRepository) FinishReminder(reminder Reminder, delivered bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !delivered && reminder.Attempts < MaxAttempts {
+		_, err = tx.Exec(
+			`UPDATE reminders SET retry_at = NOW() + make_interval(secs => $3)
+			WHERE id = $1 AND due_at = $2`,
+			reminder.Id,
+			reminder.DueAt,
+			(time.Duration(reminder.Attempts) * RetryDelay).Seconds())
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// An invalid rule ends the reminder.
+	next, _ := reminder.Next(time.Now())
+	res, err := tx.Exec(
+		`UPDATE reminders SET due_at = $3, retry_at = NULL, attempts = 0,
+			last_fired_at = CASE WHEN $4 THEN NOW() ELSE last_fired_at END
+		WHERE id = $1 AND due_at = $2`,
+		reminder.Id,
+		reminder.DueAt,
+		next,
+		delivered)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return tx.Commit()
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM reminder_deliveries WHERE reminder_id = $1 AND due_at = $2`,
+		reminder.Id,
+		reminder.DueAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *RemindersDbRepository) queryReminders(query string, args ...any) (*[]Reminder, error) {
+	reminders := []Reminder{}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, *reminder)
+	}
+
+	return &reminders, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReminder(row scanner) (*Reminder, error) {
+	var reminder Reminder
+	err := row.Scan(
+		&reminder.Id,
+		&reminder.NoteId,
+		&reminder.UserId,
+		&reminder.RemindAt,
+		&reminder.RRule,
+		&reminder.TimeZone,
+		&reminder.DueAt,
+		&reminder.LastFiredAt,
+		&reminder.CreatedAt,
+		&reminder.Attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
@@ -0,0 +1,103 @@
+package reminders
+
+import (
+	"errors"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+var ErrInvalidRule = errors.New("InvalidRule")
+
+// Reminder fires at RemindAt and, if RRule is set, at every following
+// occurrence of the rule. RRule is an RFC 5545 recurrence rule without
+// DTSTART, e.g. FREQ=WEEKLY;BYDAY=MO. Occurrences are computed in TimeZone,
+// so a daily reminder keeps its wall clock time across DST changes. DueAt is
+// the next occurrence, nil once the reminder is done.
+type Reminder struct {
+	Id          int        `json:"id"`
+	NoteId      int        `json:"note_id"`
+	UserId      int        `json:"user_id"`
+	RemindAt    time.Time  `json:"remind_at"`
+	RRule       string     `json:"rrule,omitempty"`
+	TimeZone    string     `json:"time_zone"`
+	DueAt       *time.Time `json:"due_at"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	Attempts int `json:"-"`
+}
+
+// In converts the timestamps of the reminder to the given location.
+func (r *Reminder) In(loc *time.Location) {
+	r.RemindAt = r.RemindAt.In(loc)
+	r.CreatedAt = r.CreatedAt.In(loc)
+	for _, t := range []*time.Time{r.DueAt, r.LastFiredAt} {
+		if t != nil {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// Rule returns the recurrence rule of the reminder starting at RemindAt, or
+// nil for a one-shot reminder.
+func (r *Reminder) Rule() (*rrule.RRule, error) {
+	if r.RRule == "" {
+		return nil, nil
+	}
+
+	loc, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	option, err := rrule.StrToROptionInLocation(r.RRule, loc)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidRule, err)
+	}
+	option.Dtstart = r.RemindAt.In(loc)
+
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidRule, err)
+	}
+
+	return rule, nil
+}
+
+// Next returns the first occurrence strictly after t, or nil if there is
+// none.
+func (r *Reminder) Next(t time.Time) (*time.Time, error) {
+	rule, err := r.Rule()
+	if err != nil {
+		return nil, err
+	}
+
+	if rule == nil {
+		if r.RemindAt.After(t) {
+			next := r.RemindAt
+			return &next, nil
+		}
+		return nil, nil
+	}
+
+	next := rule.After(t, false)
+	if next.IsZero() {
+		return nil, nil
+	}
+
+	return &next, nil
+}
+
+// NoteReminder is a reminder with the title of its note.
+type NoteReminder struct {
+	Reminder  Reminder
+	NoteTitle string
+}
+
+// Due is a reminder that has to be delivered now.
+type Due struct {
+	Reminder  Reminder
+	NoteTitle string
+	Email     string
+}
@@ -0,0 +1,732 @@
+package service
+
+import (
+	"NotesService/internal/attachments"
+	"NotesService/internal/notes"
+	"NotesService/pkg/blob"
+	"NotesService/pkg/imaging"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultAttachmentMaxSize = 25 << 20
+	DefaultThumbnailSize     = 256
+
+	thumbnailBatchSize = 10
+
+	// blobGracePeriod keeps orphan blobs that were just found by an upload,
+	// which is about to attach them again.
+	blobGracePeriod = time.Hour
+
+	// blobDeletingAttempts bounds how often an upload of a blob that is
+	// being deleted is tried again, blobDeletingWait apart.
+	blobDeletingAttempts = 5
+	blobDeletingWait     = 100 * time.Millisecond
+
+	maxFilenameLength = 255
+)
+
+// inlineContentTypes are shown by browsers as they are. Other attachments,
+// HTML in particular, are always downloaded.
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// upload is a file received with an upload, kept in a temporary file.
+// Images have their dimensions.
+type upload struct {
+	file        *os.File
+	filename    string
+	contentType string
+	sha256      string
+	size        int64
+	width       *int
+	height      *int
+}
+
+func (u *upload) Close() {
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+// localhost:8000/api/note/:id/attachments
+//
+// Attaches the "file" part of a multipart/form-data request to the note.
+// The content type is detected from the content, the one sent is ignored.
+// Files with the same content are stored once. Images are stored without
+// the location they were taken at and get a thumbnail in the background.
+func (s *Service) UploadAttachment(c echo.Context) error {
+	if s.attachmentsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleEditor); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	file, err := s.receiveUpload(c)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	defer file.Close()
+
+	attachmentsRepository := s.attachmentsRepository
+	var attachmentId int
+	for attempt := 1; ; attempt++ {
+		attachmentId, err = s.attachUpload(c.Request().Context(), file, attachments.Attachment{
+			NoteId:      id,
+			UserId:      &dbUser.Id,
+			SHA256:      file.sha256,
+			Filename:    file.filename,
+			ContentType: file.contentType,
+			Size:        file.size,
+			Width:       file.width,
+			Height:      file.height,
+		})
+		if errors.Is(err, attachments.ErrBlobDeleting) && attempt < blobDeletingAttempts {
+			time.Sleep(blobDeletingWait)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	if file.width != nil {
+		s.wakeThumbnails()
+	}
+
+	attachment, err := attachmentsRepository.GetAttachment(attachmentId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	attachment.In(loc)
+
+	s.logger.Infof("User %d attached %d bytes to note with id %d", dbUser.Id, file.size, id)
+	return c.JSON(http.StatusOK, Response{Object: attachment})
+}
+
+// attachUpload stores the uploaded file in the blob store, unless it is
+// stored already, and adds the attachment.
+func (s *Service) attachUpload(ctx context.Context, file *upload, attachment attachments.Attachment) (int, error) {
+	stored, err := s.attachmentsRepository.UseBlob(file.sha256)
+	if err != nil {
+		return 0, err
+	}
+	if !stored {
+		_, err = file.file.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+
+		err = s.blobStore.Put(ctx, file.sha256, file.file, file.size)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return s.attachmentsRepository.CreateAttachment(attachment)
+}
+
+// localhost:8000/api/note/:id/attachments
+func (s *Service) GetAttachments(c echo.Context) error {
+	if s.attachmentsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleViewer); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	attachmentsRepository := s.attachmentsRepository
+	list, err := attachmentsRepository.GetNoteAttachments(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+
+	s.logger.Infof("Attachments of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: list})
+}
+
+// localhost:8000/api/attachment/:id
+//
+// Streams the content of the attachment. Range requests are supported, as
+// are If-None-Match and If-Range with the SHA-256 of the content as ETag.
+func (s *Service) DownloadAttachment(c echo.Context) error {
+	if s.attachmentsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	attachment, err := s.getAttachment(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	disposition := "attachment"
+	if inlineContentTypes[mediaType(attachment.ContentType)] {
+		disposition = "inline"
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, attachment.ContentType)
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	header.Set("ETag", `"`+attachment.SHA256+`"`)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	header.Set(echo.HeaderCacheControl, "private, max-age=0, must-revalidate")
+
+	reader := blob.NewReader(c.Request().Context(), s.blobStore, attachment.SHA256, attachment.Size)
+	defer reader.Close()
+
+	http.ServeContent(c.Response(), c.Request(), "", attachment.CreatedAt, reader)
+
+	s.logger.Infof("Attachment %d was downloaded", id)
+	return nil
+}
+
+// localhost:8000/api/attachment/:id/thumbnail
+//
+// Thumbnails never change, so they are cached for as long as browsers keep
+// them.
+func (s *Service) GetThumbnail(c echo.Context) error {
+	if s.attachmentsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	attachment, err := s.getAttachment(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if attachment.Thumbnail == nil {
+		s.logger.Errorf("Attachment %d has no thumbnail", id)
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, attachment.Thumbnail.ContentType)
+	header.Set("ETag", `"`+thumbnailKey(attachment.SHA256)+`"`)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set(echo.HeaderCacheControl, "private, max-age=31536000, immutable")
+
+	reader := blob.NewReader(c.Request().Context(), s.blobStore, thumbnailKey(attachment.SHA256), attachment.Thumbnail.Size)
+	defer reader.Close()
+
+	http.ServeContent(c.Response(), c.Request(), "", attachment.CreatedAt, reader)
+
+	s.logger.Infof("Thumbnail of attachment %d was given", id)
+	return nil
+}
+
+// localhost:8000/api/attachment/:id
+func (s *Service) DeleteAttachment(c echo.Context) error {
+	if s.attachmentsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getAttachment(c, id, notes.RoleEditor); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	attachmentsRepository := s.attachmentsRepository
+	err = attachmentsRepository.DeleteAttachment(id)
+	if errors.Is(err, attachments.ErrAttachmentNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Attachment %d was deleted", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// RunAttachmentsCleanup deletes the blobs of deleted attachments and purged
+// notes every interval until ctx is cancelled.
+func (s *Service) RunAttachmentsCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.deleteOrphanBlobs()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) deleteOrphanBlobs() {
+	if s.attachmentsRepository == nil {
+		return
+	}
+
+	deleted, err := s.attachmentsRepository.DeleteOrphanBlobs(blobGracePeriod, func(sha256 string) error {
+		err := s.blobStore.Delete(context.Background(), thumbnailKey(sha256))
+		if err != nil {
+			return err
+		}
+		return s.blobStore.Delete(context.Background(), sha256)
+	})
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	if deleted > 0 {
+		s.logger.Infof("%d unused attachment blobs were deleted", deleted)
+	}
+}
+
+// RunThumbnails makes the thumbnails of uploaded images as soon as they are
+// uploaded to this instance, and every interval for those uploaded to others
+// or failed before, until ctx is cancelled. Images stored before locations
+// were stripped on upload are stripped first.
+func (s *Service) RunThumbnails(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.stripLocations(ctx)
+		s.generateThumbnails(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.thumbnailsWake:
+		}
+	}
+}
+
+func (s *Service) wakeThumbnails() {
+	select {
+	case s.thumbnailsWake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) generateThumbnails(ctx context.Context) {
+	for ctx.Err() == nil {
+		handled, err := s.attachmentsRepository.GenerateThumbnails(thumbnailBatchSize, func(image attachments.Image) (*attachments.Thumbnail, error) {
+			thumbnail, err := s.generateThumbnail(ctx, image)
+			if err != nil {
+				s.logger.Errorf("Thumbnail of blob %s failed: %v", image.SHA256, err)
+			}
+			return thumbnail, err
+		})
+		if err != nil {
+			s.logger.Error(err)
+			return
+		}
+
+		if handled > 0 {
+			s.logger.Infof("Thumbnails of %d images were made", handled)
+		}
+		if handled < thumbnailBatchSize {
+			return
+		}
+	}
+}
+
+// generateThumbnail makes the thumbnail of the image and stores it next to
+// the image.
+func (s *Service) generateThumbnail(ctx context.Context, image attachments.Image) (*attachments.Thumbnail, error) {
+	body, err := s.blobStore.Get(ctx, image.SHA256, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var data bytes.Buffer
+	info, err := imaging.Thumbnail(&data, body, s.thumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(data.Len())
+	err = s.blobStore.Put(ctx, thumbnailKey(image.SHA256), &data, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachments.Thumbnail{
+		ContentType: info.ContentType,
+		Size:        size,
+		Width:       info.Width,
+		Height:      info.Height,
+	}, nil
+}
+
+// stripLocations strips the locations of images stored before they were
+// stripped on upload. Each image is stripped and stored outside of any
+// transaction, and only recording the outcome takes one.
+func (s *Service) stripLocations(ctx context.Context) {
+	for ctx.Err() == nil {
+		images, err := s.attachmentsRepository.GetPendingLocations(thumbnailBatchSize)
+		if err != nil {
+			s.logger.Error(err)
+			return
+		}
+
+		for _, image := range images {
+			stripped, err := s.stripLocation(ctx, image)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Errorf("Stripping the location of blob %s failed: %v", image.SHA256, err)
+			}
+
+			err = s.attachmentsRepository.FinishStripLocation(image.SHA256, stripped)
+			if err != nil {
+				s.logger.Error(err)
+				return
+			}
+		}
+
+		if len(images) > 0 {
+			s.logger.Infof("Locations of %d images were stripped", len(images))
+		}
+		if len(images) < thumbnailBatchSize {
+			return
+		}
+	}
+}
+
+// stripLocation stores a copy of the image without its location, the way
+// uploaded images are, and returns it. Images without a location are
+// returned as they are. The copy is recorded before it is stored, so one
+// that never gets attached is deleted as an orphan.
+func (s *Service) stripLocation(ctx context.Context, image attachments.Image) (*attachments.Blob, error) {
+	body, err := s.blobStore.Get(ctx, image.SHA256, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	stripped, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		stripped.Close()
+		os.Remove(stripped.Name())
+	}()
+
+	hash := sha256.New()
+	err = imaging.StripLocation(io.MultiWriter(stripped, hash), body, image.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := stripped.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &attachments.Blob{SHA256: hex.EncodeToString(hash.Sum(nil)), Size: size}
+	if blob.SHA256 == image.SHA256 {
+		return blob, nil
+	}
+
+	stored, err := s.attachmentsRepository.UseBlob(blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if stored {
+		return blob, nil
+	}
+
+	err = s.attachmentsRepository.AddStrippedBlob(image.SHA256, *blob)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = stripped.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.blobStore.Put(ctx, blob.SHA256, stripped, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// thumbnailKey is the blob store key of the thumbnail of a blob.
+func thumbnailKey(sha256 string) string {
+	return sha256 + "-thumbnail"
+}
+
+// getAttachment returns the attachment if the current user has at least
+// role on its note.
+func (s *Service) getAttachment(c echo.Context, id int, role string) (*attachments.Attachment, error) {
+	attachment, err := s.attachmentsRepository.GetAttachment(id)
+	if errors.Is(err, attachments.ErrAttachmentNotFound) {
+		return nil, &Response{ErrorMessage: NotFound}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := s.getSharedNote(c, attachment.NoteId, role); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// receiveUpload reads the "file" part of the multipart request into a
+// temporary file, hashing and sniffing it on the way.
+func (s *Service) receiveUpload(c echo.Context) (*upload, error) {
+	req := c.Request()
+	// Leaves room for the other parts and the multipart framing.
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, s.attachmentMaxSize+1<<20)
+
+	reader, err := req.MultipartReader()
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil, &Response{ErrorMessage: UnsupportedMediaType}
+	}
+	if err != nil {
+		return nil, &Response{ErrorMessage: InvalidParams}
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, &Response{ErrorMessage: InvalidParams}
+		}
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		file, err := s.saveUpload(part, part.FileName())
+		part.Close()
+		return file, err
+	}
+}
+
+func (s *Service) saveUpload(r io.Reader, filename string) (*upload, error) {
+	file, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	u := &upload{file: file, filename: attachmentFilename(filename)}
+
+	hash := sha256.New()
+	sniffer := &sniffBuffer{}
+	u.size, err = io.Copy(io.MultiWriter(file, hash, sniffer), io.LimitReader(r, s.attachmentMaxSize+1))
+	if err != nil {
+		u.Close()
+		return nil, uploadError(err)
+	}
+	if u.size > s.attachmentMaxSize {
+		u.Close()
+		return nil, &Response{ErrorMessage: FileTooLarge}
+	}
+	if u.size == 0 {
+		u.Close()
+		return nil, &Response{ErrorMessage: InvalidParams}
+	}
+
+	u.sha256 = hex.EncodeToString(hash.Sum(nil))
+	u.contentType = http.DetectContentType(sniffer.data)
+	if imaging.Supported(u.contentType) {
+		err = s.prepareImage(u)
+		if err != nil {
+			u.Close()
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// prepareImage replaces the uploaded image with a copy without its location
+// and reads its dimensions.
+func (s *Service) prepareImage(u *upload) error {
+	_, err := u.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	stripped, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	err = imaging.StripLocation(io.MultiWriter(stripped, hash), u.file, u.contentType)
+	if err != nil {
+		stripped.Close()
+		os.Remove(stripped.Name())
+		// An image that cannot be read may not give away its location
+		// either.
+		s.logger.Errorf("Stripping the location of an uploaded image failed: %v", err)
+		return &Response{ErrorMessage: InvalidParams}
+	}
+
+	u.Close()
+	u.file = stripped
+	u.sha256 = hex.EncodeToString(hash.Sum(nil))
+	u.size, err = stripped.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = stripped.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	info, err := imaging.DecodeConfig(stripped)
+	if err != nil {
+		// Kept as a file without a thumbnail.
+		s.logger.Errorf("Reading an uploaded image failed: %v", err)
+		return nil
+	}
+	u.width, u.height = &info.Width, &info.Height
+	return nil
+}
+
+// uploadError tells a request body over the size limit apart from other
+// failures to read it.
+func uploadError(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return &Response{ErrorMessage: FileTooLarge}
+	}
+
+	return &Response{ErrorMessage: InvalidParams}
+}
+
+// sniffBuffer keeps the first bytes written to it, as many as content type
+// detection looks at.
+type sniffBuffer struct {
+	data []byte
+}
+
+func (b *sniffBuffer) Write(p []byte) (int, error) {
+	if rest := 512 - len(b.data); rest > 0 {
+		b.data = append(b.data, p[:min(rest, len(p))]...)
+	}
+
+	return len(p), nil
+}
+
+// attachmentFilename makes a file name sent by a client safe to store and
+// to send back in headers.
+func attachmentFilename(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+
+	return name
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
@@ -0,0 +1,523 @@
+package service_test
+
+import (
+	"NotesService/internal/attachments"
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/blob"
+	"NotesService/pkg/logs"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func pngImage(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func newUploadContext(t *testing.T, filename string, content []byte) (echo.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("comment", "ignored"))
+	part, err := writer.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	_, err = part.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/attachments", body.Bytes())
+	c.Request().Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	return c, rec
+}
+
+func newBlobStore(t *testing.T) *blob.LocalStore {
+	store, err := blob.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	return store
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadAttachment_Success(t *testing.T) {
+	// Arrange
+	content := pngImage(t, 4, 2)
+	c, rec := newUploadContext(t, `C:\photos\cat.png`, content)
+	setUser(c, "user@test.com")
+	sha := hashOf(content)
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("UseBlob", sha).Return(false, nil)
+	userId, width, height := 1, 4, 2
+	mockAttachments.On("CreateAttachment", attachments.Attachment{
+		NoteId:      1,
+		UserId:      &userId,
+		SHA256:      sha,
+		Filename:    "cat.png",
+		ContentType: "image/png",
+		Size:        int64(len(content)),
+		Width:       &width,
+		Height:      &height,
+	}).Return(7, nil)
+	mockAttachments.On("GetAttachment", 7).Return(&attachments.Attachment{
+		Id: 7, NoteId: 1, SHA256: sha, Filename: "cat.png", ContentType: "image/png", CreatedAt: createdAt,
+	}, nil)
+	store := newBlobStore(t)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockAttachments.AssertExpectations(t)
+
+	stored, err := store.Get(context.Background(), sha, 0, -1)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(stored)
+		stored.Close()
+		assert.Equal(t, content, data)
+	}
+}
+
+func TestUploadAttachment_InvalidImage(t *testing.T) {
+	// Arrange
+	c, rec := newUploadContext(t, "broken.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, newBlobStore(t), 0))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockAttachments.AssertNotCalled(t, "UseBlob", mock.Anything)
+}
+
+func TestUploadAttachment_Deduplicated(t *testing.T) {
+	// Arrange
+	content := []byte("same content")
+	c, _ := newUploadContext(t, "notes.txt", content)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("UseBlob", hashOf(content)).Return(true, nil)
+	mockAttachments.On("CreateAttachment", mock.MatchedBy(func(a attachments.Attachment) bool {
+		return a.ContentType == "text/plain; charset=utf-8" && a.Filename == "notes.txt"
+	})).Return(8, nil)
+	mockAttachments.On("GetAttachment", 8).Return(&attachments.Attachment{Id: 8, NoteId: 1}, nil)
+	store := newBlobStore(t)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	mockAttachments.AssertExpectations(t)
+	_, err = store.Get(context.Background(), hashOf(content), 0, -1)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+func TestUploadAttachment_BlobBeingDeleted(t *testing.T) {
+	// Arrange
+	content := []byte("deleted meanwhile")
+	c, rec := newUploadContext(t, "notes.txt", content)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("UseBlob", hashOf(content)).Return(false, nil)
+	mockAttachments.On("CreateAttachment", mock.Anything).Return(0, attachments.ErrBlobDeleting).Once()
+	mockAttachments.On("CreateAttachment", mock.Anything).Return(9, nil).Once()
+	mockAttachments.On("GetAttachment", 9).Return(&attachments.Attachment{Id: 9, NoteId: 1}, nil)
+	store := newBlobStore(t)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockAttachments.AssertNumberOfCalls(t, "UseBlob", 2)
+	mockAttachments.AssertNumberOfCalls(t, "CreateAttachment", 2)
+	_, err = store.Get(context.Background(), hashOf(content), 0, -1)
+	assert.NoError(t, err)
+}
+
+func TestUploadAttachment_TooLarge(t *testing.T) {
+	// Arrange
+	c, rec := newUploadContext(t, "big.bin", bytes.Repeat([]byte{1}, 11))
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, newBlobStore(t), 10))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	mockAttachments.AssertNotCalled(t, "CreateAttachment", mock.Anything)
+}
+
+func TestUploadAttachment_ViewerForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newUploadContext(t, "cat.png", pngImage(t, 4, 2))
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(new(MockAttachmentsRepository), newBlobStore(t), 0))
+
+	// Act
+	err := s.UploadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestDownloadAttachment_Range(t *testing.T) {
+	// Arrange
+	content := []byte("0123456789")
+	sha := hashOf(content)
+	c, rec := newEchoContext(http.MethodGet, "/api/attachment/7", nil)
+	c.Request().Header.Set("Range", "bytes=2-5")
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("GetAttachment", 7).Return(&attachments.Attachment{
+		Id: 7, NoteId: 1, SHA256: sha, Filename: "digits.txt", ContentType: "text/plain; charset=utf-8", Size: 10,
+	}, nil)
+	store := newBlobStore(t)
+	assert.NoError(t, store.Put(context.Background(), sha, bytes.NewReader(content), 10))
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.DownloadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "2345", rec.Body.String())
+	assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+	assert.Equal(t, `"`+sha+`"`, rec.Header().Get("ETag"))
+	assert.Equal(t, `attachment; filename=digits.txt`, rec.Header().Get(echo.HeaderContentDisposition))
+}
+
+func TestDownloadAttachment_ImageInline(t *testing.T) {
+	// Arrange
+	content := pngImage(t, 4, 2)
+	sha := hashOf(content)
+	c, rec := newEchoContext(http.MethodGet, "/api/attachment/7", nil)
+	c.Request().Header.Set("If-None-Match", `"`+sha+`"`)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("GetAttachment", 7).Return(&attachments.Attachment{
+		Id: 7, NoteId: 1, SHA256: sha, Filename: "cat photo.png", ContentType: "image/png", Size: int64(len(content)),
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, newBlobStore(t), 0))
+
+	// Act
+	err := s.DownloadAttachment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, `inline; filename="cat photo.png"`, rec.Header().Get(echo.HeaderContentDisposition))
+	assert.Equal(t, "nosniff", rec.Header().Get(echo.HeaderXContentTypeOptions))
+}
+
+func TestEmptyTrash_DeletesOrphanBlobs(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/trash", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("EmptyTrash", 1, 0).Return(int64(1), nil)
+	store := newBlobStore(t)
+	assert.NoError(t, store.Put(context.Background(), "orphan", strings.NewReader("x"), 1))
+	mockAttachments.On("DeleteOrphanBlobs", time.Hour, mock.Anything).Run(func(args mock.Arguments) {
+		deleteBlob := args.Get(1).(func(string) error)
+		assert.NoError(t, deleteBlob("orphan"))
+	}).Return(1, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.EmptyTrash(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockAttachments.AssertExpectations(t)
+	_, err = store.Get(context.Background(), "orphan", 0, -1)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+func TestGetThumbnail_Success(t *testing.T) {
+	// Arrange
+	thumbnail := pngImage(t, 2, 1)
+	c, rec := newEchoContext(http.MethodGet, "/api/attachment/7/thumbnail", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("GetAttachment", 7).Return(&attachments.Attachment{
+		Id: 7, NoteId: 1, SHA256: "abc", ContentType: "image/png",
+		Thumbnail: &attachments.Thumbnail{ContentType: "image/png", Size: int64(len(thumbnail)), Width: 2, Height: 1},
+	}, nil)
+	store := newBlobStore(t)
+	assert.NoError(t, store.Put(context.Background(), "abc-thumbnail", bytes.NewReader(thumbnail), int64(len(thumbnail))))
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	err := s.GetThumbnail(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, thumbnail, rec.Body.Bytes())
+	assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "private, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+}
+
+func TestGetThumbnail_NotReady(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/attachment/7/thumbnail", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockAttachments := new(MockAttachmentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockAttachments.On("GetAttachment", 7).Return(&attachments.Attachment{Id: 7, NoteId: 1, SHA256: "abc"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithAttachments(mockAttachments, newBlobStore(t), 0))
+
+	// Act
+	err := s.GetThumbnail(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRunThumbnails_StoresThumbnails(t *testing.T) {
+	// Arrange
+	content := pngImage(t, 600, 300)
+	sha := hashOf(content)
+	store := newBlobStore(t)
+	assert.NoError(t, store.Put(context.Background(), sha, bytes.NewReader(content), int64(len(content))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var thumbnail *attachments.Thumbnail
+	mockAttachments := new(MockAttachmentsRepository)
+	mockAttachments.On("GetPendingLocations", 10).Return(nil, nil)
+	mockAttachments.On("GenerateThumbnails", 10, mock.Anything).Run(func(args mock.Arguments) {
+		generate := args.Get(1).(func(attachments.Image) (*attachments.Thumbnail, error))
+		var err error
+		thumbnail, err = generate(attachments.Image{SHA256: sha, ContentType: "image/png", Size: int64(len(content))})
+		assert.NoError(t, err)
+		cancel()
+	}).Return(1, nil).Once()
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithAttachments(mockAttachments, store, 0),
+		service.WithThumbnailSize(100))
+
+	// Act
+	s.RunThumbnails(ctx, time.Hour)
+
+	// Assert
+	mockAttachments.AssertExpectations(t)
+	if assert.NotNil(t, thumbnail) {
+		assert.Equal(t, "image/png", thumbnail.ContentType)
+		assert.Equal(t, 100, thumbnail.Width)
+		assert.Equal(t, 50, thumbnail.Height)
+		assert.Equal(t, thumbnail.Size, int64(len(readStored(t, store, sha+"-thumbnail"))))
+	}
+}
+
+func TestRunThumbnails_StripsLocations(t *testing.T) {
+	// Arrange
+	content := pngImage(t, 60, 30)
+	// An Exif chunk right after the header, as cameras write them.
+	exif := []byte("Exif location")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, exif...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	located := append(append(append([]byte{}, content[:33]...), chunk...), content[33:]...)
+
+	sha := hashOf(located)
+	store := newBlobStore(t)
+	assert.NoError(t, store.Put(context.Background(), sha, bytes.NewReader(located), int64(len(located))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stripped *attachments.Blob
+	copied := attachments.Blob{SHA256: hashOf(content), Size: int64(len(content))}
+	mockAttachments := new(MockAttachmentsRepository)
+	mockAttachments.On("GetPendingLocations", 10).Return([]attachments.Image{
+		{SHA256: sha, ContentType: "image/png", Size: int64(len(located))},
+	}, nil).Once()
+	mockAttachments.On("UseBlob", copied.SHA256).Return(false, nil)
+	mockAttachments.On("AddStrippedBlob", sha, copied).Return(nil)
+	mockAttachments.On("FinishStripLocation", sha, mock.Anything).Run(func(args mock.Arguments) {
+		stripped = args.Get(1).(*attachments.Blob)
+		cancel()
+	}).Return(nil).Once()
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithAttachments(mockAttachments, store, 0))
+
+	// Act
+	s.RunThumbnails(ctx, time.Hour)
+
+	// Assert
+	mockAttachments.AssertExpectations(t)
+	if assert.NotNil(t, stripped) {
+		assert.Equal(t, hashOf(content), stripped.SHA256)
+		assert.Equal(t, int64(len(content)), stripped.Size)
+		assert.Equal(t, content, readStored(t, store, stripped.SHA256))
+	}
+}
+
+func TestRunThumbnails_StripLocationFailed(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockAttachments := new(MockAttachmentsRepository)
+	mockAttachments.On("GetPendingLocations", 10).Return([]attachments.Image{
+		{SHA256: "missing", ContentType: "image/jpeg", Size: 10},
+	}, nil).Once()
+	mockAttachments.On("FinishStripLocation", "missing", (*attachments.Blob)(nil)).Run(func(args mock.Arguments) {
+		cancel()
+	}).Return(nil).Once()
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithAttachments(mockAttachments, newBlobStore(t), 0))
+
+	// Act
+	s.RunThumbnails(ctx, time.Hour)
+
+	// Assert
+	mockAttachments.AssertExpectations(t)
+	mockAttachments.AssertNotCalled(t, "AddStrippedBlob", mock.Anything, mock.Anything)
+}
+
+func readStored(t *testing.T, store blob.Store, key string) []byte {
+	body, err := store.Get(context.Background(), key, 0, -1)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	return data
+}
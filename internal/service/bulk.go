@@ -0,0 +1,244 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	BulkAtomic  = "atomic"
+	BulkPartial = "partial"
+
+	BulkStatusOK         = "ok"
+	BulkStatusError      = "error"
+	BulkStatusRolledBack = "rolled_back"
+	BulkStatusSkipped    = "skipped"
+
+	DefaultBulkLimit = 500
+)
+
+type BulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+type BulkOperation struct {
+	Op       string   `json:"op"`
+	Id       int      `json:"id"`
+	Version  int      `json:"version"`
+	Title    *string  `json:"title"`
+	Body     *string  `json:"body"`
+	Tags     []string `json:"tags"`
+	Archived *bool    `json:"archived"`
+}
+
+type BulkItemResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Id     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// localhost:8000/api/notes/bulk
+//
+// In the default atomic mode either all operations are applied or none. In
+// partial mode every operation succeeds or fails on its own.
+func (s *Service) BulkNotes(c echo.Context) error {
+	var request BulkRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.Mode == "" {
+		request.Mode = BulkAtomic
+	}
+	if request.Mode != BulkAtomic && request.Mode != BulkPartial {
+		s.logger.Errorf("Unknown bulk mode %q", request.Mode)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if len(request.Operations) == 0 {
+		s.logger.Error("Empty bulk request")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if len(request.Operations) > s.bulkLimit {
+		s.logger.Errorf("Bulk request with %d operations exceeds the limit", len(request.Operations))
+		return c.JSON(s.NewError(TooManyOperations))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspaceId, err := s.activeWorkspaceId(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	atomic := request.Mode == BulkAtomic
+	response := BulkResponse{
+		Mode:    request.Mode,
+		Results: make([]BulkItemResult, len(request.Operations)),
+	}
+
+	var operations []notes.BulkOperation
+	var indexes []int
+	invalid := false
+	for i, operation := range request.Operations {
+		response.Results[i] = BulkItemResult{Index: i, Op: operation.Op, Id: operation.Id}
+		if message := validateBulkOperation(operation); message != "" {
+			response.Results[i].Status = BulkStatusError
+			response.Results[i].Error = message
+			invalid = true
+			continue
+		}
+
+		operations = append(operations, notes.BulkOperation{
+			Op:       operation.Op,
+			Id:       operation.Id,
+			Version:  operation.Version,
+			Title:    operation.Title,
+			Body:     operation.Body,
+			Tags:     operation.Tags,
+			Archived: operation.Archived,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if invalid && atomic {
+		markBulkResults(response.Results, BulkStatusSkipped)
+		return c.JSON(http.StatusBadRequest, Response{Object: response, ErrorMessage: InvalidParams})
+	}
+
+	var results []notes.BulkResult
+	if len(operations) > 0 {
+		notesRepository := s.notesRepository
+		results, err = notesRepository.ExecuteBulk(dbUser.Id, workspaceId, operations, atomic,
+			func(note *notes.Note, role string) error {
+				return s.authorizeNote(note, dbUser.Id, role)
+			})
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+	}
+
+	failed := false
+	var updated []int
+	for i, result := range results {
+		item := &response.Results[indexes[i]]
+		item.Id = result.Id
+		if result.Err != nil {
+			item.Status = BulkStatusError
+			item.Error = s.bulkError(result.Err)
+			failed = true
+			continue
+		}
+
+		item.Status = BulkStatusOK
+		if operations[i].Op == notes.BulkUpdate {
+			updated = append(updated, result.Id)
+		}
+	}
+
+	if failed && atomic {
+		for i := range response.Results {
+			if response.Results[i].Status == BulkStatusOK {
+				response.Results[i].Status = BulkStatusRolledBack
+			}
+		}
+		markBulkResults(response.Results, BulkStatusSkipped)
+		return c.JSON(http.StatusConflict, Response{Object: response, ErrorMessage: Conflict})
+	}
+
+	for _, id := range updated {
+		s.pruneNoteRevisions(id)
+	}
+
+	response.Committed = true
+	s.logger.Infof("User %d executed %d bulk operations", dbUser.Id, len(request.Operations))
+	return c.JSON(http.StatusOK, Response{Object: response})
+}
+
+func validateBulkOperation(operation BulkOperation) string {
+	switch operation.Op {
+	case notes.BulkCreate:
+		if operation.Title == nil {
+			return "title is required"
+		}
+		return ""
+	case notes.BulkUpdate:
+		if operation.Title == nil && operation.Body == nil {
+			return "title or body is required"
+		}
+	case notes.BulkTag:
+		if len(notes.NormalizeTags(operation.Tags)) == 0 {
+			return "tags are required"
+		}
+	case notes.BulkMove, notes.BulkDelete, notes.BulkArchive:
+	default:
+		return "unknown operation"
+	}
+
+	if operation.Id <= 0 {
+		return "id is required"
+	}
+
+	return ""
+}
+
+// authorizeNote checks that the user has at least role on the note, the way
+// getSharedNote does. Notes the user has no access to are not found.
+func (s *Service) authorizeNote(note *notes.Note, userId int, role string) error {
+	granted, err := s.noteRole(note, userId)
+	if err != nil {
+		return err
+	}
+	if granted == "" {
+		return notes.ErrNoteNotFound
+	}
+	if noteRoleRanks[granted] < noteRoleRanks[role] {
+		return &Response{ErrorMessage: Forbidden}
+	}
+
+	return nil
+}
+
+func (s *Service) bulkError(err error) string {
+	var resp *Response
+	switch {
+	case errors.As(err, &resp):
+		return resp.ErrorMessage
+	case errors.Is(err, notes.ErrNoteNotFound):
+		return NotFound
+	case errors.Is(err, notes.ErrVersionMismatch):
+		return PreconditionFailed
+	case errors.Is(err, notes.ErrUnknownOperation):
+		return "unknown operation"
+	}
+
+	s.logger.Error(err)
+	return InternalServerError
+}
+
+// markBulkResults sets status on every result that has not got one yet.
+func markBulkResults(results []BulkItemResult, status string) {
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = status
+		}
+	}
+}
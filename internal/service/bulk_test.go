@@ -0,0 +1,139 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBulkNotes_Atomic(t *testing.T) {
+	// Arrange
+	body := []byte(`{"operations":[
+		{"op":"create","title":"new"},
+		{"op":"tag","id":2,"tags":["work"]},
+		{"op":"delete","id":3}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/notes/bulk", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	title := "new"
+	mockNotes.On("ExecuteBulk", 1, 0, []notes.BulkOperation{
+		{Op: notes.BulkCreate, Title: &title},
+		{Op: notes.BulkTag, Id: 2, Tags: []string{"work"}},
+		{Op: notes.BulkDelete, Id: 3},
+	}, true, mock.Anything).Return([]notes.BulkResult{{Id: 10}, {Id: 2}, {Id: 3}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.BulkNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	response := decodeBulkResponse(t, rec.Body.Bytes())
+	assert.True(t, response.Committed)
+	assert.Equal(t, 10, response.Results[0].Id)
+	for _, result := range response.Results {
+		assert.Equal(t, service.BulkStatusOK, result.Status)
+	}
+}
+
+func TestBulkNotes_AtomicFailure(t *testing.T) {
+	// Arrange
+	body := []byte(`{"mode":"atomic","operations":[
+		{"op":"archive","id":1},
+		{"op":"archive","id":2},
+		{"op":"archive","id":3}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/notes/bulk", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("ExecuteBulk", 1, 0, mock.Anything, true, mock.Anything).
+		Return([]notes.BulkResult{{Id: 1}, {Id: 2, Err: notes.ErrNoteNotFound}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.BulkNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	response := decodeBulkResponse(t, rec.Body.Bytes())
+	assert.False(t, response.Committed)
+	assert.Equal(t, service.BulkStatusRolledBack, response.Results[0].Status)
+	assert.Equal(t, service.BulkStatusError, response.Results[1].Status)
+	assert.Equal(t, service.NotFound, response.Results[1].Error)
+	assert.Equal(t, service.BulkStatusSkipped, response.Results[2].Status)
+}
+
+func TestBulkNotes_PartialSkipsInvalid(t *testing.T) {
+	// Arrange
+	body := []byte(`{"mode":"partial","operations":[
+		{"op":"rename","id":1},
+		{"op":"move","id":2,"tags":["archive"]}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/notes/bulk", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("ExecuteBulk", 1, 0, []notes.BulkOperation{
+		{Op: notes.BulkMove, Id: 2, Tags: []string{"archive"}},
+	}, false, mock.Anything).Return([]notes.BulkResult{{Id: 2}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.BulkNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	response := decodeBulkResponse(t, rec.Body.Bytes())
+	assert.Equal(t, service.BulkStatusError, response.Results[0].Status)
+	assert.Equal(t, service.BulkStatusOK, response.Results[1].Status)
+}
+
+func TestBulkNotes_TooManyOperations(t *testing.T) {
+	// Arrange
+	body := []byte(`{"operations":[{"op":"delete","id":1},{"op":"delete","id":2}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/notes/bulk", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithBulkLimit(1))
+
+	// Act
+	err := s.BulkNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	mockNotes.AssertNotCalled(t, "ExecuteBulk", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func decodeBulkResponse(t *testing.T, body []byte) service.BulkResponse {
+	var resp struct {
+		Object service.BulkResponse `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &resp))
+	return resp.Object
+}
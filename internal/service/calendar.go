@@ -0,0 +1,235 @@
+package service
+
+import (
+	"NotesService/internal/reminders"
+	"NotesService/pkg/ical"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	calendarProdId  = "-//NotesService//Reminders//EN"
+	calendarName    = "Notes reminders"
+	calendarRefresh = "PT1H"
+	calendarUIDHost = "notes-service"
+
+	// secretTokenLen is the number of random bytes in calendar feed and
+	// public link tokens.
+	secretTokenLen = 32
+)
+
+type CalendarTokenResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// localhost:8000/calendar/:file
+//
+// Serves the reminders of the user owning the token in the file name
+// <token>.ics as an iCalendar feed. Recurring reminders are events with
+// their recurrence rule, one-shot reminders are to-dos due at their time.
+func (s *Service) GetCalendar(c echo.Context) error {
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	usersRepository := s.usersRepository
+	dbUser, err := usersRepository.GetUserByCalendarToken(hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("Unknown calendar token")
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	remindersRepository := s.remindersRepository
+	list, err := remindersRepository.GetCalendarReminders(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	calendar := ical.NewCalendar(calendarProdId)
+	calendar.Add("METHOD", "PUBLISH")
+	calendar.AddText("X-WR-CALNAME", calendarName)
+	if dbUser.TimeZone != "" {
+		calendar.AddText("X-WR-TIMEZONE", dbUser.TimeZone)
+	}
+	calendar.Add("REFRESH-INTERVAL", calendarRefresh, ical.Param{Name: "VALUE", Value: "DURATION"})
+	calendar.Add("X-PUBLISHED-TTL", calendarRefresh)
+
+	now := time.Now().UTC()
+	zones := map[string]*time.Location{}
+	var components []ical.Component
+	for _, item := range *list {
+		loc, err := time.LoadLocation(item.Reminder.TimeZone)
+		if err != nil {
+			s.logger.Error(err)
+			loc = time.UTC
+		}
+		if loc != time.UTC {
+			zones[loc.String()] = loc
+		}
+
+		component, err := reminderComponent(item, loc, now)
+		if err != nil {
+			s.logger.Error(err)
+			continue
+		}
+		components = append(components, component)
+	}
+
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		calendar.Components = append(calendar.Components, ical.TimeZone(zones[name], now.Year()))
+	}
+	calendar.Components = append(calendar.Components, components...)
+
+	var body bytes.Buffer
+	err = calendar.Encode(&body)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `inline; filename="reminders.ics"`)
+	s.logger.Infof("User %d calendar was served with %d reminders", dbUser.Id, len(components))
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", body.Bytes())
+}
+
+// reminderComponent returns a VEVENT for a recurring reminder and a VTODO
+// for a one-shot one, with times in loc.
+func reminderComponent(item reminders.NoteReminder, loc *time.Location, now time.Time) (ical.Component, error) {
+	reminder := item.Reminder
+	start := reminder.RemindAt.In(loc)
+
+	// Only rules that parse are passed through to the feed.
+	rule, err := reminder.Rule()
+	if err != nil {
+		return ical.Component{}, err
+	}
+
+	var component ical.Component
+	if rule != nil {
+		component.Name = "VEVENT"
+	} else {
+		component.Name = "VTODO"
+	}
+	component.Add("UID", fmt.Sprintf("reminder-%d@%s", reminder.Id, calendarUIDHost))
+	component.AddTime("DTSTAMP", now)
+	component.AddTime("CREATED", reminder.CreatedAt.UTC())
+	component.AddText("SUMMARY", item.NoteTitle)
+	component.AddTime("DTSTART", start)
+
+	if rule != nil {
+		component.Add("RRULE", reminder.RRule)
+		component.Add("TRANSP", "TRANSPARENT")
+	} else {
+		component.AddTime("DUE", start)
+		if reminder.DueAt == nil {
+			component.Add("STATUS", "COMPLETED")
+			if reminder.LastFiredAt != nil {
+				component.AddTime("COMPLETED", reminder.LastFiredAt.UTC())
+			}
+		} else {
+			component.Add("STATUS", "NEEDS-ACTION")
+		}
+	}
+
+	alarm := ical.Component{Name: "VALARM"}
+	alarm.Add("ACTION", "DISPLAY")
+	alarm.Add("TRIGGER", "PT0S")
+	alarm.AddText("DESCRIPTION", item.NoteTitle)
+	component.Components = append(component.Components, alarm)
+
+	return component, nil
+}
+
+// localhost:8000/api/user/calendar-token
+//
+// Generates a new calendar token, revoking the feed URL of the previous one.
+// The token is only returned here, the database keeps its hash.
+func (s *Service) RegenerateCalendarToken(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	hash := hashToken(token)
+
+	usersRepository := s.usersRepository
+	err = usersRepository.UpdateUserCalendarToken(dbUser.Id, &hash)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	response := CalendarTokenResponse{
+		Token: token,
+		URL:   fmt.Sprintf("%s://%s/calendar/%s.ics", c.Scheme(), c.Request().Host, token),
+	}
+
+	s.logger.Infof("User %d regenerated his calendar token", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: response})
+}
+
+// localhost:8000/api/user/calendar-token
+func (s *Service) DeleteCalendarToken(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	usersRepository := s.usersRepository
+	err = usersRepository.UpdateUserCalendarToken(dbUser.Id, nil)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d disabled his calendar feed", dbUser.Id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// newSecretToken returns an unguessable token for use in URLs.
+func newSecretToken() (string, error) {
+	raw := make([]byte, secretTokenLen)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken returns the form secret tokens are stored in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"NotesService/internal/reminders"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetCalendar_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/calendar/secret.ics", nil)
+	c.SetPath("/calendar/:file")
+	c.SetParamNames("file")
+	c.SetParamValues("secret.ics")
+
+	sum := sha256.Sum256([]byte("secret"))
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByCalendarToken", hex.EncodeToString(sum[:])).
+		Return(&users.User{Id: 1, TimeZone: "Europe/Berlin"}, nil)
+
+	dueAt := time.Date(2030, 3, 1, 8, 30, 0, 0, time.UTC)
+	mockReminders.On("GetCalendarReminders", 1).Return(&[]reminders.NoteReminder{
+		{
+			Reminder: reminders.Reminder{
+				Id:       3,
+				RemindAt: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+				RRule:    "FREQ=WEEKLY;BYDAY=FR",
+				TimeZone: "Europe/Berlin",
+				DueAt:    &dueAt,
+			},
+			NoteTitle: "Weekly review, part 1",
+		},
+		{
+			Reminder: reminders.Reminder{
+				Id:       4,
+				RemindAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+				TimeZone: "UTC",
+			},
+			NoteTitle: "Pay rent",
+		},
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.GetCalendar(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.Contains(t, body, "X-WR-TIMEZONE:Europe/Berlin\r\n")
+	assert.Contains(t, body, "BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n")
+	assert.Contains(t, body, "BEGIN:VEVENT\r\nUID:reminder-3@notes-service\r\n")
+	assert.Contains(t, body, "SUMMARY:Weekly review\\, part 1\r\n")
+	assert.Contains(t, body, "DTSTART;TZID=Europe/Berlin:20240301T093000\r\n")
+	assert.Contains(t, body, "RRULE:FREQ=WEEKLY;BYDAY=FR\r\n")
+	assert.Contains(t, body, "BEGIN:VTODO\r\nUID:reminder-4@notes-service\r\n")
+	assert.Contains(t, body, "DUE:20240302T100000Z\r\nSTATUS:COMPLETED\r\n")
+	assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+}
+
+func TestGetCalendar_UnknownToken(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/calendar/revoked.ics", nil)
+	c.SetPath("/calendar/:file")
+	c.SetParamNames("file")
+	c.SetParamValues("revoked.ics")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByCalendarToken", mock.Anything).Return(nil, sql.ErrNoRows)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetCalendar(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRegenerateCalendarToken_StoresHash(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/user/calendar-token", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	var stored *string
+	mockUsers.On("UpdateUserCalendarToken", 1, mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*string) }).
+		Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.RegenerateCalendarToken(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Object service.CalendarTokenResponse `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Object.Token)
+	assert.True(t, strings.HasSuffix(response.Object.URL, "/calendar/"+response.Object.Token+".ics"))
+	sum := sha256.Sum256([]byte(response.Object.Token))
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, hex.EncodeToString(sum[:]), *stored)
+	}
+}
@@ -0,0 +1,973 @@
+package service
+
+import (
+	"NotesService/internal/collab"
+	"NotesService/internal/notes"
+	"NotesService/internal/users"
+	"NotesService/pkg/ot"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	CollabInit      = "init"
+	CollabOperation = "operation"
+	CollabAck       = "ack"
+	CollabCursor    = "cursor"
+	CollabPresence  = "presence"
+	CollabLeave     = "leave"
+	CollabError     = "error"
+
+	DefaultCollabSaveInterval = 5 * time.Second
+	// DefaultCollabRoleTTL is how long the role of a collaborator is
+	// trusted before the messages they send look it up again.
+	DefaultCollabRoleTTL = 10 * time.Second
+
+	// collabKeepOperations is how many operations are kept for clients
+	// that lag behind, in memory and before the saved revision.
+	collabKeepOperations = 1000
+	collabAppendAttempts = 10
+	collabSendBuffer     = 256
+	collabMaxMessageSize = 1 << 20
+	collabWriteTimeout   = 10 * time.Second
+	collabPongTimeout    = 60 * time.Second
+	collabPingInterval   = 50 * time.Second
+)
+
+// errCollabResync is reported when operations a client or an instance needs
+// to catch up were pruned already. The client has to connect again.
+var errCollabResync = errors.New("collaborative document has to be reloaded")
+
+var (
+	errCollabInvalid   = errors.New("invalid collaborative operation")
+	errCollabBusy      = errors.New("collaborative document is busy")
+	errCollabForbidden = errors.New("access to the collaborative document was revoked")
+)
+
+// CollabMessage is exchanged with clients over the WebSocket of a note.
+//
+// Clients send operations made on the document at Revision and cursor
+// positions. The server answers with an init message holding the document
+// and the clients editing it, acknowledges operations with the revision they
+// were stored as and forwards the operations and cursors of other clients.
+type CollabMessage struct {
+	Type      string            `json:"type"`
+	Revision  int               `json:"revision"`
+	Operation *ot.Operation     `json:"operation,omitempty"`
+	Body      *string           `json:"body,omitempty"`
+	Role      string            `json:"role,omitempty"`
+	ClientId  string            `json:"client_id,omitempty"`
+	UserId    int               `json:"user_id,omitempty"`
+	Cursor    *collab.Cursor    `json:"cursor,omitempty"`
+	Presence  *collab.Presence  `json:"presence,omitempty"`
+	Clients   []collab.Presence `json:"clients,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type collabHub struct {
+	instance string
+
+	mu       sync.Mutex
+	sessions map[int]*collabSession
+}
+
+// collabSession is the collaborative document of a note on this instance.
+// Operations are ordered by the revisions they are stored under, which all
+// instances agree on; the session follows the stored operations.
+type collabSession struct {
+	noteId int
+
+	mu       sync.Mutex
+	loaded   bool
+	closed   bool
+	revision int
+	body     string
+	saved    int
+	history  []collab.Operation
+	clients  map[string]*collabClient
+	remote   map[string]collab.Presence
+}
+
+type collabClient struct {
+	id     string
+	user   *users.User
+	role   string
+	cursor *collab.Cursor
+	send   chan CollabMessage
+	closed bool
+	// roleCheckedAt is when role was looked up. Only the goroutine reading
+	// from the client uses it.
+	roleCheckedAt time.Time
+}
+
+var collabUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+func newCollabHub() *collabHub {
+	return &collabHub{
+		instance: newCollabId(),
+		sessions: map[int]*collabSession{},
+	}
+}
+
+// localhost:8000/api/note/:id/collab
+//
+// Upgrades to a WebSocket on which everyone with access to the note edits
+// it together. Viewers follow the edits and cursors of the others.
+func (s *Service) CollabNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if s.collabHub == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	_, role, err := s.getSharedNote(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	conn, err := collabUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has answered the request already.
+		s.logger.Error(err)
+		return nil
+	}
+	defer conn.Close()
+
+	client := &collabClient{
+		id:            newCollabId(),
+		user:          dbUser,
+		role:          role,
+		send:          make(chan CollabMessage, collabSendBuffer),
+		roleCheckedAt: time.Now(),
+	}
+
+	session, err := s.joinCollab(id, client)
+	if err != nil {
+		s.logger.Error(err)
+		conn.WriteJSON(CollabMessage{Type: CollabError, Error: InternalServerError})
+		return nil
+	}
+	s.logger.Infof("User %d joined the collaboration on note with id %d", dbUser.Id, id)
+
+	written := make(chan struct{})
+	go func() {
+		writeCollab(conn, client.send)
+		close(written)
+	}()
+	s.readCollab(conn, session, client)
+
+	s.leaveCollab(session, client)
+	// The messages queued for the client, like the reason it was closed,
+	// are written before the connection is.
+	<-written
+	s.logger.Infof("User %d left the collaboration on note with id %d", dbUser.Id, id)
+	return nil
+}
+
+// RunCollab follows the collaboration events of other instances and saves
+// edited documents to their notes every interval until ctx is cancelled.
+func (s *Service) RunCollab(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCollabSaveInterval
+	}
+
+	go func() {
+		for {
+			err := s.collabBroker.Listen(ctx, s.handleCollabEvent)
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Errorf("Listening for collaboration events failed: %v", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			s.handleCollabEvent(collab.Event{Type: collab.EventReconnect})
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.saveCollabSessions()
+			return
+		case <-ticker.C:
+			s.saveCollabSessions()
+		}
+	}
+}
+
+// joinCollab adds the client to the session of the note, loading it first
+// if it is the first client on this instance, and sends it the document.
+func (s *Service) joinCollab(noteId int, client *collabClient) (*collabSession, error) {
+	for {
+		hub := s.collabHub
+		hub.mu.Lock()
+		session := hub.sessions[noteId]
+		if session == nil {
+			session = &collabSession{
+				noteId:  noteId,
+				clients: map[string]*collabClient{},
+				remote:  map[string]collab.Presence{},
+			}
+			hub.sessions[noteId] = session
+		}
+		hub.mu.Unlock()
+
+		session.mu.Lock()
+		// The last client left the session in the meantime.
+		if session.closed {
+			session.mu.Unlock()
+			continue
+		}
+
+		if !session.loaded {
+			err := s.loadCollab(session)
+			if err != nil {
+				s.closeCollab(session)
+				session.mu.Unlock()
+				return nil, err
+			}
+		}
+
+		clients := make([]collab.Presence, 0, len(session.clients)+len(session.remote))
+		for _, other := range session.clients {
+			clients = append(clients, other.presence())
+		}
+		for _, presence := range session.remote {
+			clients = append(clients, presence)
+		}
+
+		session.clients[client.id] = client
+		body := session.body
+		client.deliver(CollabMessage{
+			Type:     CollabInit,
+			Revision: session.revision,
+			Body:     &body,
+			Role:     client.role,
+			ClientId: client.id,
+			UserId:   client.user.Id,
+			Clients:  clients,
+		})
+		session.mu.Unlock()
+
+		return session, nil
+	}
+}
+
+// leaveCollab removes the client from the session. The session of the last
+// client is saved and closed.
+func (s *Service) leaveCollab(session *collabSession, client *collabClient) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	delete(session.clients, client.id)
+	client.close()
+
+	leave := CollabMessage{Type: CollabLeave, Revision: session.revision, ClientId: client.id}
+	for _, other := range session.clients {
+		other.deliver(leave)
+	}
+	s.publishCollab(collab.Event{
+		NoteId:   session.noteId,
+		Type:     collab.EventLeave,
+		Presence: &collab.Presence{ClientId: client.id},
+	})
+
+	if len(session.clients) > 0 {
+		return
+	}
+
+	if session.revision > session.saved {
+		if err := s.saveCollab(session); err != nil {
+			s.logger.Errorf("Saving the collaboration on note with id %d failed: %v", session.noteId, err)
+		}
+	}
+	s.closeCollab(session)
+}
+
+// closeCollab drops the session from the hub. The caller holds session.mu.
+func (s *Service) closeCollab(session *collabSession) {
+	session.closed = true
+
+	hub := s.collabHub
+	hub.mu.Lock()
+	if hub.sessions[session.noteId] == session {
+		delete(hub.sessions, session.noteId)
+	}
+	hub.mu.Unlock()
+}
+
+func (s *Service) readCollab(conn *websocket.Conn, session *collabSession, client *collabClient) {
+	conn.SetReadLimit(collabMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(collabPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		// Clients that only follow the edits are checked on every pong.
+		if !s.checkCollabRole(session, client, true) {
+			return errCollabForbidden
+		}
+		return conn.SetReadDeadline(time.Now().Add(collabPongTimeout))
+	})
+
+	for {
+		var message CollabMessage
+		err := conn.ReadJSON(&message)
+		if isCollabDecodeError(err) {
+			// Malformed messages are answered, the connection is kept.
+			session.mu.Lock()
+			client.deliver(CollabMessage{Type: CollabError, Error: InvalidParams})
+			session.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.Error(err)
+			}
+			return
+		}
+
+		if !s.checkCollabRole(session, client, false) || !s.handleCollabMessage(session, client, message) {
+			return
+		}
+	}
+}
+
+// checkCollabRole looks up the role of the client again, as the note may
+// have been unshared or the user removed from its workspace since they
+// joined, and reports whether the client still has access. Unless force is
+// set the role is trusted for collabRoleTTL, so that messages sent while
+// typing do not all query it. Clients that lost access are told so and
+// closed.
+func (s *Service) checkCollabRole(session *collabSession, client *collabClient, force bool) bool {
+	if !force && time.Since(client.roleCheckedAt) < s.collabRoleTTL {
+		return true
+	}
+
+	role, err := s.collabRole(session.noteId, client.user.Id)
+	if err != nil {
+		// The role the client has is kept until it can be looked up.
+		s.logger.Error(err)
+		return true
+	}
+	client.roleCheckedAt = time.Now()
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if role == "" {
+		s.logger.Errorf("User %d lost access to note with id %d", client.user.Id, session.noteId)
+		client.deliver(CollabMessage{Type: CollabError, Error: Forbidden})
+		client.close()
+		return false
+	}
+
+	client.role = role
+	return true
+}
+
+// collabRole returns the role the user has on the note, "" if they have no
+// access or the note was deleted.
+func (s *Service) collabRole(noteId, userId int) (string, error) {
+	note, err := s.notesRepository.GetNote(noteId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return s.noteRole(note, userId)
+}
+
+func writeCollab(conn *websocket.Conn, send <-chan CollabMessage) {
+	ticker := time.NewTicker(collabPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				conn.Close()
+				return
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// handleCollabMessage handles a message of the client and reports whether
+// the connection is kept.
+func (s *Service) handleCollabMessage(session *collabSession, client *collabClient, message CollabMessage) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if client.closed {
+		return false
+	}
+
+	switch message.Type {
+	case CollabOperation:
+		if noteRoleRanks[client.role] < noteRoleRanks[notes.RoleEditor] {
+			s.logger.Errorf("User %d cannot edit note with id %d", client.user.Id, session.noteId)
+			client.deliver(CollabMessage{Type: CollabError, Error: Forbidden})
+			break
+		}
+		if message.Operation == nil {
+			client.deliver(CollabMessage{Type: CollabError, Error: InvalidParams})
+			break
+		}
+
+		userId := client.user.Id
+		stored, err := s.commitCollab(session, collab.Operation{
+			Revision:  message.Revision,
+			UserId:    &userId,
+			ClientId:  client.id,
+			Operation: message.Operation,
+		})
+		if err != nil {
+			client.deliver(CollabMessage{Type: CollabError, Error: s.collabError(err)})
+			if errors.Is(err, errCollabResync) {
+				client.close()
+			}
+			break
+		}
+
+		client.deliver(CollabMessage{Type: CollabAck, Revision: stored.Revision})
+	case CollabCursor:
+		if message.Cursor == nil {
+			client.deliver(CollabMessage{Type: CollabError, Error: InvalidParams})
+			break
+		}
+
+		cursor, ok := s.transformCursor(session, *message.Cursor, message.Revision)
+		if !ok {
+			// The cursor is outdated, the client sends a newer one.
+			break
+		}
+		client.cursor = cursor
+
+		presence := client.presence()
+		for _, other := range session.clients {
+			if other != client {
+				other.deliver(CollabMessage{Type: CollabPresence, Revision: session.revision, Presence: &presence})
+			}
+		}
+		s.publishCollab(collab.Event{
+			NoteId:   session.noteId,
+			Type:     collab.EventPresence,
+			Revision: session.revision,
+			Presence: &presence,
+		})
+	default:
+		client.deliver(CollabMessage{Type: CollabError, Error: InvalidParams})
+	}
+
+	return !client.closed
+}
+
+// commitCollab stores an operation made on the document at its revision as
+// the next revision of the note and applies it. Operations stored meanwhile
+// are transformed into it. The caller holds session.mu.
+func (s *Service) commitCollab(session *collabSession, operation collab.Operation) (*collab.Operation, error) {
+	collabRepository := s.collabRepository
+	for attempt := 0; attempt < collabAppendAttempts; attempt++ {
+		err := s.catchUpCollab(session)
+		if err != nil {
+			return nil, err
+		}
+
+		transformed, err := s.rebaseCollab(session, operation.Operation, operation.Revision)
+		if err != nil {
+			return nil, err
+		}
+		body, err := transformed.Apply(session.body)
+		if err != nil {
+			return nil, errors.Join(errCollabInvalid, err)
+		}
+
+		stored := collab.Operation{
+			NoteId:    session.noteId,
+			Revision:  session.revision + 1,
+			UserId:    operation.UserId,
+			ClientId:  operation.ClientId,
+			Operation: transformed,
+			CreatedAt: time.Now(),
+		}
+		err = collabRepository.AppendOperation(stored)
+		if errors.Is(err, collab.ErrRevisionTaken) {
+			// Another instance stored the revision first.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.applyCollab(session, stored, body)
+		s.publishCollab(collab.Event{
+			NoteId:   session.noteId,
+			Type:     collab.EventOperation,
+			Revision: stored.Revision,
+		})
+		return &stored, nil
+	}
+
+	return nil, errCollabBusy
+}
+
+// rebaseCollab transforms an operation made on the document at revision
+// into one on the current document. The caller holds session.mu.
+func (s *Service) rebaseCollab(session *collabSession, operation *ot.Operation, revision int) (*ot.Operation, error) {
+	if revision < 0 || revision > session.revision {
+		return nil, errCollabInvalid
+	}
+
+	var concurrent []collab.Operation
+	first := session.revision - len(session.history)
+	if revision >= first {
+		concurrent = session.history[revision-first:]
+	} else {
+		stored, err := s.collabRepository.GetOperations(session.noteId, revision)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range *stored {
+			if other.Revision > session.revision {
+				break
+			}
+			concurrent = append(concurrent, other)
+		}
+		if len(concurrent) != session.revision-revision || (len(concurrent) > 0 && concurrent[0].Revision != revision+1) {
+			return nil, errCollabResync
+		}
+	}
+
+	for _, other := range concurrent {
+		var err error
+		operation, _, err = ot.Transform(operation, other.Operation)
+		if err != nil {
+			return nil, errors.Join(errCollabInvalid, err)
+		}
+	}
+
+	return operation, nil
+}
+
+// catchUpCollab applies the operations stored after the revision of the
+// session. The caller holds session.mu.
+func (s *Service) catchUpCollab(session *collabSession) error {
+	stored, err := s.collabRepository.GetOperations(session.noteId, session.revision)
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range *stored {
+		if operation.Revision != session.revision+1 {
+			return errCollabResync
+		}
+
+		body, err := operation.Operation.Apply(session.body)
+		if err != nil {
+			return err
+		}
+		s.applyCollab(session, operation, body)
+	}
+
+	return nil
+}
+
+// applyCollab moves the session to a stored operation and forwards it to
+// the clients, except for the one that made it. The caller holds session.mu.
+func (s *Service) applyCollab(session *collabSession, operation collab.Operation, body string) {
+	session.revision = operation.Revision
+	session.body = body
+	session.history = append(session.history, operation)
+	if len(session.history) > collabKeepOperations {
+		session.history = append([]collab.Operation(nil), session.history[len(session.history)-collabKeepOperations:]...)
+	}
+
+	for _, client := range session.clients {
+		if client.cursor != nil {
+			client.cursor = transformCursor(client.cursor, operation.Operation)
+		}
+	}
+	for id, presence := range session.remote {
+		if presence.Cursor != nil {
+			presence.Cursor = transformCursor(presence.Cursor, operation.Operation)
+			session.remote[id] = presence
+		}
+	}
+
+	message := CollabMessage{
+		Type:      CollabOperation,
+		Revision:  operation.Revision,
+		Operation: operation.Operation,
+		ClientId:  operation.ClientId,
+	}
+	if operation.UserId != nil {
+		message.UserId = *operation.UserId
+	}
+	for _, client := range session.clients {
+		if client.id != operation.ClientId {
+			client.deliver(message)
+		}
+	}
+}
+
+// transformCursor moves a cursor set on the document at revision to the
+// current document. It reports false if the operations in between are not
+// kept anymore. The caller holds session.mu.
+func (s *Service) transformCursor(session *collabSession, cursor collab.Cursor, revision int) (*collab.Cursor, bool) {
+	first := session.revision - len(session.history)
+	if revision < first || revision > session.revision {
+		return nil, false
+	}
+
+	moved := &cursor
+	for _, operation := range session.history[revision-first:] {
+		moved = transformCursor(moved, operation.Operation)
+	}
+
+	length := utf8.RuneCountInString(session.body)
+	moved.Position = min(max(moved.Position, 0), length)
+	moved.SelectionEnd = min(max(moved.SelectionEnd, 0), length)
+	return moved, true
+}
+
+func transformCursor(cursor *collab.Cursor, operation *ot.Operation) *collab.Cursor {
+	return &collab.Cursor{
+		Position:     operation.TransformIndex(cursor.Position),
+		SelectionEnd: operation.TransformIndex(cursor.SelectionEnd),
+	}
+}
+
+// loadCollab reads the document of the session from the stored state and
+// operations. The caller holds session.mu.
+func (s *Service) loadCollab(session *collabSession) error {
+	unlock, err := s.collabRepository.LockNote(context.Background(), session.noteId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	note, err := s.notesRepository.GetNote(session.noteId)
+	if err != nil {
+		return err
+	}
+
+	collabRepository := s.collabRepository
+	state, err := collabRepository.GetState(session.noteId)
+	if errors.Is(err, collab.ErrStateNotFound) {
+		state = &collab.State{NoteId: note.Id, Version: note.Version, Body: note.Body}
+		err = collabRepository.InitState(*state)
+	}
+	if err != nil {
+		return err
+	}
+
+	session.revision = state.Revision
+	session.body = state.Body
+	session.saved = state.Revision
+	session.history = nil
+	session.loaded = true
+
+	return s.persistCollab(session)
+}
+
+// saveCollab saves the document of the session to its note. The caller
+// holds session.mu.
+func (s *Service) saveCollab(session *collabSession) error {
+	unlock, err := s.collabRepository.LockNote(context.Background(), session.noteId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.persistCollab(session)
+}
+
+// persistCollab merges edits made to the note outside of the collaboration
+// into the document and saves the document to the note. The caller holds
+// session.mu and the lock of the note.
+func (s *Service) persistCollab(session *collabSession) error {
+	note, err := s.notesRepository.GetNote(session.noteId)
+	if err != nil {
+		return err
+	}
+
+	collabRepository := s.collabRepository
+	state, err := collabRepository.GetState(session.noteId)
+	if err != nil {
+		return err
+	}
+
+	err = s.catchUpCollab(session)
+	if err != nil {
+		return err
+	}
+
+	if note.Version != state.Version {
+		// The note was edited since the document was saved to it. The edit
+		// is stored as an operation on the saved document.
+		edit := ot.Diff(state.Body, note.Body)
+		if !edit.IsNoop() {
+			_, err = s.commitCollab(session, collab.Operation{Revision: state.Revision, Operation: edit})
+			if err != nil {
+				return err
+			}
+		}
+	} else if session.revision == state.Revision {
+		session.saved = session.revision
+		return nil
+	}
+
+	version := note.Version
+	if session.body != note.Body {
+		body := session.body
+		err = s.notesRepository.UpdateNote(note.Id, notes.NoteUpdate{Body: &body}, note.Version)
+		if err != nil {
+			return err
+		}
+		version++
+		s.pruneNoteRevisions(note.Id)
+	}
+
+	err = collabRepository.SaveState(collab.State{
+		NoteId:   note.Id,
+		Revision: session.revision,
+		Version:  version,
+		Body:     session.body,
+	})
+	if err != nil {
+		return err
+	}
+	session.saved = session.revision
+
+	if session.revision > collabKeepOperations {
+		err = collabRepository.PruneOperations(note.Id, session.revision-collabKeepOperations)
+		if err != nil {
+			s.logger.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// saveCollabSessions saves the documents edited on this instance and merges
+// edits made to their notes meanwhile.
+func (s *Service) saveCollabSessions() {
+	for _, session := range s.collabHub.list() {
+		session.mu.Lock()
+		if session.loaded && !session.closed {
+			err := s.saveCollab(session)
+			if errors.Is(err, sql.ErrNoRows) {
+				// The note was deleted.
+				for _, client := range session.clients {
+					client.deliver(CollabMessage{Type: CollabError, Error: NotFound})
+					client.close()
+				}
+			} else if err != nil {
+				s.logger.Errorf("Saving the collaboration on note with id %d failed: %v", session.noteId, err)
+			}
+		}
+		session.mu.Unlock()
+	}
+}
+
+// handleCollabEvent follows the operations and clients of other instances.
+func (s *Service) handleCollabEvent(event collab.Event) {
+	if event.Type == collab.EventReconnect {
+		// Events may have been missed.
+		for _, session := range s.collabHub.list() {
+			session.mu.Lock()
+			if session.loaded && !session.closed {
+				if err := s.catchUpCollab(session); err != nil {
+					s.logger.Error(err)
+				}
+			}
+			session.mu.Unlock()
+		}
+		return
+	}
+
+	if event.Instance == s.collabHub.instance {
+		return
+	}
+
+	session := s.collabHub.get(event.NoteId)
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if !session.loaded || session.closed {
+		return
+	}
+
+	if event.Revision > session.revision {
+		if err := s.catchUpCollab(session); err != nil {
+			s.logger.Error(err)
+			return
+		}
+	}
+
+	switch event.Type {
+	case collab.EventPresence:
+		if event.Presence == nil {
+			return
+		}
+
+		presence := *event.Presence
+		if presence.Cursor != nil {
+			cursor, ok := s.transformCursor(session, *presence.Cursor, event.Revision)
+			if !ok {
+				return
+			}
+			presence.Cursor = cursor
+		}
+		session.remote[presence.ClientId] = presence
+
+		for _, client := range session.clients {
+			client.deliver(CollabMessage{Type: CollabPresence, Revision: session.revision, Presence: &presence})
+		}
+	case collab.EventLeave:
+		if event.Presence == nil {
+			return
+		}
+
+		delete(session.remote, event.Presence.ClientId)
+		for _, client := range session.clients {
+			client.deliver(CollabMessage{Type: CollabLeave, Revision: session.revision, ClientId: event.Presence.ClientId})
+		}
+	}
+}
+
+func (s *Service) publishCollab(event collab.Event) {
+	if s.collabBroker == nil {
+		return
+	}
+
+	event.Instance = s.collabHub.instance
+	err := s.collabBroker.Publish(event)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
+
+func (s *Service) collabError(err error) string {
+	switch {
+	case errors.Is(err, errCollabInvalid):
+		return InvalidParams
+	case errors.Is(err, errCollabResync):
+		return Gone
+	case errors.Is(err, errCollabBusy):
+		return Conflict
+	}
+
+	s.logger.Error(err)
+	return InternalServerError
+}
+
+func (h *collabHub) get(noteId int) *collabSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.sessions[noteId]
+}
+
+func (h *collabHub) list() []*collabSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sessions := make([]*collabSession, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+func (c *collabClient) presence() collab.Presence {
+	return collab.Presence{
+		ClientId: c.id,
+		UserId:   c.user.Id,
+		Email:    c.user.Email,
+		Cursor:   c.cursor,
+	}
+}
+
+// deliver queues a message for the client. A client that does not keep up
+// is disconnected. The caller holds the mutex of the session.
+func (c *collabClient) deliver(message CollabMessage) {
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.send <- message:
+	default:
+		c.close()
+	}
+}
+
+// close ends the connection once the queued messages are written. The
+// caller holds the mutex of the session.
+func (c *collabClient) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func isCollabDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, ot.ErrInvalid)
+}
+
+func newCollabId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,476 @@
+package service_test
+
+import (
+	"NotesService/internal/collab"
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"NotesService/pkg/ot"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeCollabRepository keeps the collaborative documents in memory, shared
+// by the service instances of a test.
+type fakeCollabRepository struct {
+	mu         sync.Mutex
+	states     map[int]collab.State
+	operations map[int][]collab.Operation
+
+	lock sync.Mutex
+}
+
+func newFakeCollabRepository() *fakeCollabRepository {
+	return &fakeCollabRepository{
+		states:     map[int]collab.State{},
+		operations: map[int][]collab.Operation{},
+	}
+}
+
+func (r *fakeCollabRepository) GetState(noteId int) (*collab.State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[noteId]
+	if !ok {
+		return nil, collab.ErrStateNotFound
+	}
+	return &state, nil
+}
+
+func (r *fakeCollabRepository) InitState(state collab.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.states[state.NoteId]; !ok {
+		r.states[state.NoteId] = state
+	}
+	return nil
+}
+
+func (r *fakeCollabRepository) SaveState(state collab.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.states[state.NoteId].Revision <= state.Revision {
+		r.states[state.NoteId] = state
+	}
+	return nil
+}
+
+func (r *fakeCollabRepository) GetOperations(noteId, after int) (*[]collab.Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []collab.Operation{}
+	for _, operation := range r.operations[noteId] {
+		if operation.Revision > after {
+			list = append(list, operation)
+		}
+	}
+	return &list, nil
+}
+
+func (r *fakeCollabRepository) AppendOperation(operation collab.Operation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := r.operations[operation.NoteId]
+	last := r.states[operation.NoteId].Revision
+	if len(list) > 0 {
+		last = list[len(list)-1].Revision
+	}
+	if operation.Revision != last+1 {
+		return collab.ErrRevisionTaken
+	}
+	r.operations[operation.NoteId] = append(list, operation)
+	return nil
+}
+
+func (r *fakeCollabRepository) PruneOperations(noteId, before int) error {
+	return nil
+}
+
+func (r *fakeCollabRepository) LockNote(ctx context.Context, noteId int) (func(), error) {
+	r.lock.Lock()
+	return r.lock.Unlock, nil
+}
+
+func (r *fakeCollabRepository) state(noteId int) collab.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.states[noteId]
+}
+
+// fakeCollabBroker delivers events to every listening instance.
+type fakeCollabBroker struct {
+	mu        sync.Mutex
+	listeners []chan collab.Event
+}
+
+func (b *fakeCollabBroker) Publish(event collab.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, listener := range b.listeners {
+		listener <- event
+	}
+	return nil
+}
+
+func (b *fakeCollabBroker) Listen(ctx context.Context, handle func(collab.Event)) error {
+	listener := make(chan collab.Event, 100)
+	b.mu.Lock()
+	b.listeners = append(b.listeners, listener)
+	b.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-listener:
+			handle(event)
+		}
+	}
+}
+
+func TestCollabNote_ConcurrentOperations(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "owner@test.com").Return(&users.User{Id: 1, Email: "owner@test.com"}, nil)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2, Email: "editor@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "world", Version: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+	mockNotes.On("UpdateNote", 1, mock.MatchedBy(func(update notes.NoteUpdate) bool {
+		return update.Body != nil && *update.Body == "Hello world!"
+	}), 1).Return(nil)
+
+	repository := newFakeCollabRepository()
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, nil))
+	url := startCollabServer(t, s)
+
+	owner := dialCollab(t, url, "owner@test.com")
+	editor := dialCollab(t, url, "editor@test.com")
+	init := readCollab(t, owner, service.CollabInit)
+	assert.Equal(t, "world", *init.Body)
+	assert.Equal(t, notes.RoleOwner, init.Role)
+	init = readCollab(t, editor, service.CollabInit)
+	assert.Equal(t, 0, init.Revision)
+	assert.Len(t, init.Clients, 1)
+
+	// Act
+	sendCollab(t, owner, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Insert("Hello ").Retain(5),
+	})
+	ack := readCollab(t, owner, service.CollabAck)
+	sendCollab(t, editor, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Retain(5).Insert("!"),
+	})
+
+	// Assert
+	assert.Equal(t, 1, ack.Revision)
+
+	remote := readCollab(t, editor, service.CollabOperation)
+	assert.Equal(t, 1, remote.Revision)
+	assert.Equal(t, 1, remote.UserId)
+	ack = readCollab(t, editor, service.CollabAck)
+	assert.Equal(t, 2, ack.Revision)
+
+	remote = readCollab(t, owner, service.CollabOperation)
+	body, err := remote.Operation.Apply("Hello world")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", body)
+
+	owner.Close()
+	editor.Close()
+	assert.Eventually(t, func() bool {
+		return repository.state(1).Revision == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	state := repository.state(1)
+	assert.Equal(t, "Hello world!", state.Body)
+	assert.Equal(t, 2, state.Version)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestCollabNote_AcrossInstances(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "owner@test.com").Return(&users.User{Id: 1, Email: "owner@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "ab", Version: 1}, nil)
+	mockNotes.On("UpdateNote", 1, mock.Anything, 1).Return(nil).Maybe()
+
+	repository := newFakeCollabRepository()
+	broker := &fakeCollabBroker{}
+	first := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, broker))
+	second := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, broker))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go first.RunCollab(ctx, time.Hour)
+	go second.RunCollab(ctx, time.Hour)
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.listeners) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	a := dialCollab(t, startCollabServer(t, first), "owner@test.com")
+	b := dialCollab(t, startCollabServer(t, second), "owner@test.com")
+	readCollab(t, a, service.CollabInit)
+	readCollab(t, b, service.CollabInit)
+
+	// Act
+	sendCollab(t, a, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Retain(1).Insert("x").Retain(1),
+	})
+	sendCollab(t, a, service.CollabMessage{
+		Type:     service.CollabCursor,
+		Revision: 1,
+		Cursor:   &collab.Cursor{Position: 2, SelectionEnd: 2},
+	})
+
+	// Assert
+	readCollab(t, a, service.CollabAck)
+
+	remote := readCollab(t, b, service.CollabOperation)
+	assert.Equal(t, 1, remote.Revision)
+	body, err := remote.Operation.Apply("ab")
+	assert.NoError(t, err)
+	assert.Equal(t, "axb", body)
+
+	presence := readCollab(t, b, service.CollabPresence)
+	if assert.NotNil(t, presence.Presence) {
+		assert.Equal(t, "owner@test.com", presence.Presence.Email)
+		assert.Equal(t, &collab.Cursor{Position: 2, SelectionEnd: 2}, presence.Presence.Cursor)
+	}
+}
+
+func TestCollabNote_ViewerCannotEdit(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2, Email: "viewer@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "text", Version: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	repository := newFakeCollabRepository()
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, nil))
+	viewer := dialCollab(t, startCollabServer(t, s), "viewer@test.com")
+	init := readCollab(t, viewer, service.CollabInit)
+
+	// Act
+	sendCollab(t, viewer, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Delete(4),
+	})
+
+	// Assert
+	assert.Equal(t, notes.RoleViewer, init.Role)
+	message := readCollab(t, viewer, service.CollabError)
+	assert.Equal(t, service.Forbidden, message.Error)
+	ops, _ := repository.GetOperations(1, 0)
+	assert.Empty(t, *ops)
+}
+
+func TestCollabNote_InvalidOperation(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "owner@test.com").Return(&users.User{Id: 1, Email: "owner@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "text", Version: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(newFakeCollabRepository(), nil))
+	owner := dialCollab(t, startCollabServer(t, s), "owner@test.com")
+	readCollab(t, owner, service.CollabInit)
+
+	// Act
+	sendCollab(t, owner, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Retain(10),
+	})
+	err := owner.WriteMessage(websocket.TextMessage, []byte(`{"type":"operation","operation":[0]}`))
+
+	// Assert
+	assert.NoError(t, err)
+	message := readCollab(t, owner, service.CollabError)
+	assert.Equal(t, service.InvalidParams, message.Error)
+	message = readCollab(t, owner, service.CollabError)
+	assert.Equal(t, service.InvalidParams, message.Error)
+}
+
+func TestCollabNote_MergesNoteEdits(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "owner@test.com").Return(&users.User{Id: 1, Email: "owner@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "hello world", Version: 3}, nil)
+
+	repository := newFakeCollabRepository()
+	repository.InitState(collab.State{NoteId: 1, Version: 2, Body: "hello"})
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, nil))
+
+	// Act
+	owner := dialCollab(t, startCollabServer(t, s), "owner@test.com")
+	init := readCollab(t, owner, service.CollabInit)
+
+	// Assert
+	assert.Equal(t, "hello world", *init.Body)
+	assert.Equal(t, 1, init.Revision)
+	assert.Equal(t, collab.State{NoteId: 1, Revision: 1, Version: 3, Body: "hello world"}, repository.state(1))
+	mockNotes.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCollabNote_NoAccess(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "other@test.com").Return(&users.User{Id: 3}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 3).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(newFakeCollabRepository(), nil))
+	url := startCollabServer(t, s)
+
+	// Act
+	header := http.Header{"X-Test-User": {"other@test.com"}}
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+
+	// Assert
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestCollabNote_AccessRevoked(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2, Email: "editor@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "world", Version: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil).Once()
+	mockNotes.On("GetNoteShare", 1, 2).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	repository := newFakeCollabRepository()
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(repository, nil),
+		service.WithCollabRoleTTL(time.Millisecond))
+	editor := dialCollab(t, startCollabServer(t, s), "editor@test.com")
+	readCollab(t, editor, service.CollabInit)
+	time.Sleep(5 * time.Millisecond)
+
+	// Act
+	sendCollab(t, editor, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Insert("Hello ").Retain(5),
+	})
+
+	// Assert
+	message := readCollab(t, editor, service.CollabError)
+	assert.Equal(t, service.Forbidden, message.Error)
+	var next service.CollabMessage
+	assert.Error(t, editor.ReadJSON(&next))
+	assert.Empty(t, repository.operations[1])
+}
+
+func TestCollabNote_RoleCachedWhileTyping(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2, Email: "editor@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "world", Version: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithCollab(newFakeCollabRepository(), nil))
+	editor := dialCollab(t, startCollabServer(t, s), "editor@test.com")
+	readCollab(t, editor, service.CollabInit)
+
+	// Act
+	sendCollab(t, editor, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Operation: ot.New().Insert("H").Retain(5),
+	})
+	readCollab(t, editor, service.CollabAck)
+	sendCollab(t, editor, service.CollabMessage{
+		Type:      service.CollabOperation,
+		Revision:  1,
+		Operation: ot.New().Retain(1).Insert("i").Retain(5),
+	})
+	ack := readCollab(t, editor, service.CollabAck)
+
+	// Assert
+	assert.Equal(t, 2, ack.Revision)
+	mockNotes.AssertNumberOfCalls(t, "GetNoteShare", 1)
+}
+
+// startCollabServer serves the collaboration endpoint of note 1 and returns
+// its WebSocket URL. The user is taken from the X-Test-User header.
+func startCollabServer(t *testing.T, s *service.Service) string {
+	e := echo.New()
+	e.GET("/api/note/:id/collab", s.CollabNote, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			setUser(c, c.Request().Header.Get("X-Test-User"))
+			return next(c)
+		}
+	})
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/api/note/1/collab"
+}
+
+func dialCollab(t *testing.T, url, email string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Test-User": {email}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func sendCollab(t *testing.T, conn *websocket.Conn, message service.CollabMessage) {
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readCollab reads messages until one of the type arrives.
+func readCollab(t *testing.T, conn *websocket.Conn, messageType string) service.CollabMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message service.CollabMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
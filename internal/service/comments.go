@@ -0,0 +1,377 @@
+package service
+
+import (
+	"NotesService/internal/comments"
+	"NotesService/internal/notes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MaxCommentLength = 10000
+
+type CommentRequest struct {
+	Body     string         `json:"body"`
+	ParentId *int           `json:"parent_id"`
+	Anchor   *AnchorRequest `json:"anchor"`
+}
+
+// AnchorRequest selects the commented text by character offsets into the
+// note body.
+type AnchorRequest struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type CommentsPage struct {
+	Threads *[]comments.Thread `json:"threads"`
+	Total   int                `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+}
+
+// localhost:8000/api/note/:id/comments
+//
+// Lists the threads of the note, paginated with ?limit= and ?offset=.
+// ?resolved=true or false lists only resolved or open threads.
+func (s *Service) GetComments(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	filter, err := threadsFilter(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleViewer); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	commentsRepository := s.commentsRepository
+	threads, total, err := commentsRepository.GetThreads(id, filter)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *threads {
+		(*threads)[i].In(loc)
+	}
+
+	s.logger.Infof("Comments of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: CommentsPage{
+		Threads: threads,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	}})
+}
+
+// localhost:8000/api/note/:id/comments
+//
+// Everyone who can view the note can comment on it. A comment either starts
+// a thread, optionally anchored to a range of the note body, or replies to
+// one with parent_id.
+func (s *Service) CreateComment(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request CommentRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	body, ok := commentBody(request.Body)
+	if !ok {
+		s.logger.Error("Invalid comment body")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if request.ParentId != nil && request.Anchor != nil {
+		s.logger.Error("Replies cannot be anchored")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	comment := comments.Comment{
+		NoteId:   id,
+		UserId:   dbUser.Id,
+		Email:    dbUser.Email,
+		ParentId: request.ParentId,
+		Body:     body,
+	}
+
+	commentsRepository := s.commentsRepository
+	var parent *comments.Comment
+	if request.ParentId != nil {
+		parent, err = commentsRepository.GetComment(*request.ParentId)
+		if errors.Is(err, comments.ErrCommentNotFound) {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(NotFound))
+		}
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+		if parent.NoteId != id || parent.ParentId != nil {
+			s.logger.Errorf("Comment %d does not start a thread on note with id %d", parent.Id, id)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	if request.Anchor != nil {
+		comment.Anchor, ok = noteAnchor(note.Body, *request.Anchor)
+		if !ok {
+			s.logger.Errorf("Anchor %d-%d is outside of note with id %d", request.Anchor.Start, request.Anchor.End, id)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	comment.Id, err = commentsRepository.CreateComment(comment)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	mentioned := s.notifyMentions(c, note, "", comment.Body, &comment.Id)
+	s.notifyComment(dbUser, note, comment, parent, mentioned)
+
+	s.logger.Infof("User %d commented on note with id %d", dbUser.Id, id)
+	return c.JSON(http.StatusOK, Response{Object: comment})
+}
+
+// localhost:8000/api/comment/:id
+//
+// Only the author can edit a comment.
+func (s *Service) UpdateComment(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request CommentRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	body, ok := commentBody(request.Body)
+	if !ok {
+		s.logger.Error("Invalid comment body")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	comment, note, _, err := s.getComment(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	if comment.UserId != dbUser.Id {
+		s.logger.Errorf("User %d cannot edit comment %d", dbUser.Id, id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	commentsRepository := s.commentsRepository
+	err = commentsRepository.UpdateComment(id, body)
+	if errors.Is(err, comments.ErrCommentNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	s.notifyMentions(c, note, comment.Body, body, &comment.Id)
+
+	s.logger.Infof("Comment %d was updated", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/comment/:id
+//
+// Authors delete their comments, the owner of the note any comment.
+// Deleting the comment that starts a thread deletes the whole thread.
+func (s *Service) DeleteComment(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	comment, _, role, err := s.getComment(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	if comment.UserId != dbUser.Id && role != notes.RoleOwner {
+		s.logger.Errorf("User %d cannot delete comment %d", dbUser.Id, id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	commentsRepository := s.commentsRepository
+	err = commentsRepository.DeleteComment(id)
+	if errors.Is(err, comments.ErrCommentNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Comment %d was deleted", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/comment/:id/resolve
+func (s *Service) ResolveComment(c echo.Context) error {
+	return s.resolveThread(c, true)
+}
+
+// localhost:8000/api/comment/:id/resolve
+func (s *Service) UnresolveComment(c echo.Context) error {
+	return s.resolveThread(c, false)
+}
+
+// resolveThread resolves or reopens the thread started by the comment. The
+// author of the thread and editors of the note can.
+func (s *Service) resolveThread(c echo.Context, resolved bool) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	comment, _, role, err := s.getComment(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if comment.ParentId != nil {
+		s.logger.Errorf("Comment %d is a reply", id)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	if comment.UserId != dbUser.Id && noteRoleRanks[role] < noteRoleRanks[notes.RoleEditor] {
+		s.logger.Errorf("User %d cannot resolve comment %d", dbUser.Id, id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	commentsRepository := s.commentsRepository
+	err = commentsRepository.ResolveThread(id, dbUser.Id, resolved)
+	if errors.Is(err, comments.ErrCommentNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if resolved {
+		s.logger.Infof("Thread %d was resolved", id)
+	} else {
+		s.logger.Infof("Thread %d was reopened", id)
+	}
+	return c.String(http.StatusOK, "OK")
+}
+
+// getComment loads the comment with the given id and its note if the
+// authenticated user can view the note, and returns the role of the user on
+// the note.
+func (s *Service) getComment(c echo.Context, id int) (*comments.Comment, *notes.Note, string, error) {
+	comment, err := s.commentsRepository.GetComment(id)
+	if errors.Is(err, comments.ErrCommentNotFound) {
+		return nil, nil, "", &Response{ErrorMessage: NotFound}
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	note, role, err := s.getSharedNote(c, comment.NoteId, notes.RoleViewer)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return comment, note, role, nil
+}
+
+// threadsFilter reads the ?resolved=, ?limit= and ?offset= parameters.
+func threadsFilter(c echo.Context) (comments.ThreadsFilter, error) {
+	var filter comments.ThreadsFilter
+	var err error
+
+	if value := c.QueryParam("resolved"); value != "" {
+		resolved, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Resolved = &resolved
+	}
+
+	filter.Limit, filter.Offset, err = pageParams(c)
+
+	return filter, err
+}
+
+func commentBody(body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	return body, body != "" && utf8.RuneCountInString(body) <= MaxCommentLength
+}
+
+// noteAnchor checks that the range lies within the note body and quotes the
+// text it selects.
+func noteAnchor(body string, request AnchorRequest) (*comments.Anchor, bool) {
+	text := []rune(body)
+	if request.Start < 0 || request.End <= request.Start || request.End > len(text) {
+		return nil, false
+	}
+
+	return &comments.Anchor{
+		Start: request.Start,
+		End:   request.End,
+		Quote: string(text[request.Start:request.End]),
+	}, true
+}
@@ -0,0 +1,258 @@
+package service_test
+
+import (
+	"NotesService/internal/comments"
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetComments_Page(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/comments?resolved=false&limit=5&offset=10", nil)
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+	resolved := false
+	mockComments.On("GetThreads", 1, comments.ThreadsFilter{Resolved: &resolved, Limit: 5, Offset: 10}).
+		Return(&[]comments.Thread{{Comment: comments.Comment{Id: 3, Body: "why?"}, Replies: []comments.Comment{}}}, 11, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.GetComments(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"total":11`)
+	assert.Contains(t, rec.Body.String(), `"body":"why?"`)
+}
+
+func TestGetComments_InvalidLimit(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/comments?limit=1000", nil)
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository))
+
+	// Act
+	err := s.GetComments(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCreateComment_Anchored(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/comments",
+		[]byte(`{"body":" Is this right? ","anchor":{"start":2,"end":7}}`))
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2, Email: "viewer@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "Größe ändern"}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+	var created comments.Comment
+	mockComments.On("CreateComment", mock.Anything).
+		Run(func(args mock.Arguments) { created = args.Get(0).(comments.Comment) }).
+		Return(4, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.CreateComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Is this right?", created.Body)
+	assert.Equal(t, 2, created.UserId)
+	if assert.NotNil(t, created.Anchor) {
+		assert.Equal(t, "öße ä", created.Anchor.Quote)
+	}
+}
+
+func TestCreateComment_AnchorOutOfRange(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/comments",
+		[]byte(`{"body":"hm","anchor":{"start":2,"end":50}}`))
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "short"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.CreateComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockComments.AssertNotCalled(t, "CreateComment", mock.Anything)
+}
+
+func TestCreateComment_ReplyToReply(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/comments", []byte(`{"body":"+1","parent_id":5}`))
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	parentId := 3
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockComments.On("GetComment", 5).Return(&comments.Comment{Id: 5, NoteId: 1, ParentId: &parentId}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.CreateComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockComments.AssertNotCalled(t, "CreateComment", mock.Anything)
+}
+
+func TestUpdateComment_NotAuthor(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/comment/3", []byte(`{"body":"edited"}`))
+	c.SetPath("/api/comment/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockComments.On("GetComment", 3).Return(&comments.Comment{Id: 3, NoteId: 1, UserId: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.UpdateComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockComments.AssertNotCalled(t, "UpdateComment", mock.Anything, mock.Anything)
+}
+
+func TestDeleteComment_NoteOwner(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/comment/3", nil)
+	c.SetPath("/api/comment/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockComments.On("GetComment", 3).Return(&comments.Comment{Id: 3, NoteId: 1, UserId: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockComments.On("DeleteComment", 3).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.DeleteComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockComments.AssertExpectations(t)
+}
+
+func TestResolveComment_Viewer(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/comment/3/resolve", nil)
+	c.SetPath("/api/comment/:id/resolve")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockComments.On("GetComment", 3).Return(&comments.Comment{Id: 3, NoteId: 1, UserId: 3}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.ResolveComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockComments.AssertNotCalled(t, "ResolveThread", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResolveComment_ThreadAuthor(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/comment/3/resolve", nil)
+	c.SetPath("/api/comment/:id/resolve")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockComments.On("GetComment", 3).Return(&comments.Comment{Id: 3, NoteId: 1, UserId: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+	mockComments.On("ResolveThread", 3, 2, true).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithComments(mockComments))
+
+	// Act
+	err := s.ResolveComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockComments.AssertExpectations(t)
+}
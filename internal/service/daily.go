@@ -0,0 +1,185 @@
+package service
+
+import (
+	"NotesService/internal/templates"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxDailyRange bounds the number of days listed by GetDailyNotes.
+const maxDailyRange = 366
+
+type DailyNoteSummary struct {
+	Date      string `json:"date"`
+	NoteId    int    `json:"note_id"`
+	Title     string `json:"title"`
+	WordCount int    `json:"word_count"`
+}
+
+type DailyTemplateRequest struct {
+	TemplateId *int `json:"template_id"`
+}
+
+// localhost:8000/api/daily/:date
+//
+// The date is either 2006-01-02 or "today" in the time zone of the user. A
+// missing daily note is created from the daily template of the user.
+func (s *Service) GetDailyNote(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	day, err := parseDay(c.Param("date"), loc)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	date := day.Format(time.DateOnly)
+
+	title, body := date, ""
+	if dbUser.DailyTemplateId != nil {
+		template, err := s.templatesRepository.GetTemplate(*dbUser.DailyTemplateId)
+		if err != nil && !errors.Is(err, templates.ErrTemplateNotFound) {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+		if err == nil {
+			title, body = expandTemplate(template, day, nil, nil)
+			if strings.TrimSpace(title) == "" {
+				title = date
+			}
+		}
+	}
+
+	notesRepository := s.notesRepository
+	note, created, err := notesRepository.GetOrCreateDailyNote(dbUser.Id, date, title, body)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	note.In(loc)
+	setNoteETag(c, note)
+
+	if created {
+		s.logger.Infof("User %d created daily note for %s", dbUser.Id, date)
+	} else {
+		s.logger.Infof("User %d took daily note for %s", dbUser.Id, date)
+	}
+	return c.JSON(http.StatusOK, Response{Object: note})
+}
+
+// localhost:8000/api/daily?from=2006-01-02&to=2006-01-31
+//
+// Without a range the current month is listed.
+func (s *Service) GetDailyNotes(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 1, -1)
+	if value := c.QueryParam("from"); value != "" {
+		from, err = time.ParseInLocation(time.DateOnly, value, loc)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+	if value := c.QueryParam("to"); value != "" {
+		to, err = time.ParseInLocation(time.DateOnly, value, loc)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+	if to.Before(from) || to.After(from.AddDate(0, 0, maxDailyRange-1)) {
+		s.logger.Errorf("Invalid daily notes range %s - %s", from.Format(time.DateOnly), to.Format(time.DateOnly))
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	notesRepository := s.notesRepository
+	list, err := notesRepository.GetDailyNotes(dbUser.Id, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	summaries := []DailyNoteSummary{}
+	if list != nil {
+		for _, note := range *list {
+			if note.DailyDate == nil {
+				continue
+			}
+
+			summaries = append(summaries, DailyNoteSummary{
+				Date:      *note.DailyDate,
+				NoteId:    note.Id,
+				Title:     note.Title,
+				WordCount: len(strings.Fields(note.Body)),
+			})
+		}
+	}
+
+	s.logger.Infof("User %d took his daily notes", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: summaries})
+}
+
+// localhost:8000/api/user/daily-template
+func (s *Service) UpdateDailyTemplate(c echo.Context) error {
+	var request DailyTemplateRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.TemplateId != nil {
+		if _, err := s.getOwnTemplate(c, *request.TemplateId); err != nil {
+			return s.ErrorResponse(c, err)
+		}
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	usersRepository := s.usersRepository
+	err = usersRepository.UpdateUserDailyTemplate(dbUser.Id, request.TemplateId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d set his daily template", dbUser.Id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// parseDay reads a 2006-01-02 date or "today" in loc.
+func parseDay(value string, loc *time.Location) (time.Time, error) {
+	if value == "today" {
+		return time.Now().In(loc), nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, loc)
+}
@@ -0,0 +1,150 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/templates"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDailyNote_CreatesFromTemplate(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/daily/2024-05-01", nil)
+	c.SetPath("/api/daily/:date")
+	c.SetParamNames("date")
+	c.SetParamValues("2024-05-01")
+	setUser(c, "user@test.com")
+
+	templateId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").
+		Return(&users.User{Id: 1, DailyTemplateId: &templateId}, nil)
+	mockTemplates.On("GetTemplate", 5).
+		Return(&templates.Template{Id: 5, UserId: 1, Title: "Journal {{date}}", Body: "{{weekday}}"}, nil)
+	date := "2024-05-01"
+	mockNotes.On("GetOrCreateDailyNote", 1, date, "Journal 2024-05-01", "Wednesday").
+		Return(&notes.Note{Id: 3, UserId: 1, Version: 1, DailyDate: &date}, true, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	err := s.GetDailyNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3-1"`, rec.Header().Get("ETag"))
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetDailyNote_TodayInUserTimeZone(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/daily/today", nil)
+	c.SetPath("/api/daily/:date")
+	c.SetParamNames("date")
+	c.SetParamValues("today")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").
+		Return(&users.User{Id: 1, TimeZone: "Pacific/Kiritimati"}, nil)
+
+	loc, _ := time.LoadLocation("Pacific/Kiritimati")
+	date := time.Now().In(loc).Format(time.DateOnly)
+	mockNotes.On("GetOrCreateDailyNote", 1, date, date, "").
+		Return(&notes.Note{Id: 3, UserId: 1, DailyDate: &date}, false, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetDailyNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetDailyNote_InvalidDate(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/daily/2024-13-01", nil)
+	c.SetPath("/api/daily/:date")
+	c.SetParamNames("date")
+	c.SetParamValues("2024-13-01")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetDailyNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetDailyNotes_WordCounts(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/daily?from=2024-05-01&to=2024-05-31", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	first, second := "2024-05-01", "2024-05-03"
+	mockNotes.On("GetDailyNotes", 1, "2024-05-01", "2024-05-31").Return(&[]notes.Note{
+		{Id: 1, Title: "a", Body: "one two\nthree", DailyDate: &first},
+		{Id: 2, Title: "b", Body: "  ", DailyDate: &second},
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetDailyNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Object []service.DailyNoteSummary `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, []service.DailyNoteSummary{
+		{Date: "2024-05-01", NoteId: 1, Title: "a", WordCount: 3},
+		{Date: "2024-05-03", NoteId: 2, Title: "b", WordCount: 0},
+	}, response.Object)
+}
+
+func TestGetDailyNotes_RangeTooLong(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/daily?from=2023-01-01&to=2024-05-31", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetDailyNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+func noteETag(note *notes.Note) string {
+	return fmt.Sprintf(`"%d-%d"`, note.Id, note.Version)
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header value. Weak validators only match when weak comparison is allowed.
+func etagMatches(header, etag string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch evaluates the If-Match header of a write request against the
+// current state of the note. It returns the version the write has to be
+// conditioned on, or 0 when the request carries no precondition.
+func (s *Service) checkIfMatch(c echo.Context, id int) (int, error) {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		if s.requireIfMatch {
+			return 0, &Response{ErrorMessage: PreconditionRequired}
+		}
+		return 0, nil
+	}
+
+	note, err := s.notesRepository.GetNote(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &Response{ErrorMessage: PreconditionFailed}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !etagMatches(header, noteETag(note), false) {
+		return 0, &Response{ErrorMessage: PreconditionFailed}
+	}
+
+	return note.Version, nil
+}
+
+// noteWriteError maps errors of conditional note writes to responses.
+func (s *Service) noteWriteError(c echo.Context, err error) error {
+	s.logger.Error(err)
+	switch {
+	case errors.Is(err, notes.ErrVersionMismatch):
+		return c.JSON(s.NewError(PreconditionFailed))
+	case errors.Is(err, notes.ErrNoteNotFound):
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	return c.JSON(s.NewError(InternalServerError))
+}
+
+func setNoteETag(c echo.Context, note *notes.Note) {
+	c.Response().Header().Set("ETag", noteETag(note))
+}
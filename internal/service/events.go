@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// EventReset tells a resuming client that events it missed are gone and
+	// it has to reload its notes.
+	EventReset = "reset"
+
+	DefaultEventsHeartbeat = 15 * time.Second
+
+	eventsBatchSize = 100
+)
+
+// eventsHub wakes the open event streams when events were logged.
+type eventsHub struct {
+	mu      sync.Mutex
+	streams map[chan struct{}]struct{}
+}
+
+func newEventsHub() *eventsHub {
+	return &eventsHub{streams: map[chan struct{}]struct{}{}}
+}
+
+func (h *eventsHub) subscribe() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream := make(chan struct{}, 1)
+	h.streams[stream] = struct{}{}
+	return stream
+}
+
+func (h *eventsHub) unsubscribe(stream chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams, stream)
+}
+
+func (h *eventsHub) wake() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for stream := range h.streams {
+		select {
+		case stream <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// localhost:8000/api/events
+//
+// Streams the created, updated and deleted events of the notes the user has
+// access to as Server-Sent Events. A client that reconnects with the
+// Last-Event-ID header receives the events it missed.
+func (s *Service) StreamEvents(c echo.Context) error {
+	if s.eventsRepository == nil {
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	eventsRepository := s.eventsRepository
+	resume := c.Request().Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = c.QueryParam("last_event_id")
+	}
+
+	var lastId, xmin int64
+	reset := false
+	if resume != "" {
+		lastId, xmin, err = parseCursor(resume)
+		if err != nil {
+			s.logger.Errorf("Invalid last event id %q", resume)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+
+		firstId, err := eventsRepository.GetFirstEventId()
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+		if firstId > lastId+1 {
+			// Events after lastId were cleaned up already.
+			lastId = firstId - 1
+			reset = true
+		}
+	} else {
+		lastId, xmin, err = eventsRepository.GetLastEventId()
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+	}
+
+	wake := s.eventsHub.subscribe()
+	defer s.eventsHub.unsubscribe(wake)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if reset {
+		fmt.Fprintf(res, "id: %s\nevent: %s\ndata: {}\n\n", formatCursor(lastId, xmin), EventReset)
+	}
+	res.Flush()
+	s.logger.Infof("User %d opened the event stream at event %d", dbUser.Id, lastId)
+
+	heartbeat := time.NewTicker(s.eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		lastId, xmin, err = s.writeEvents(res, dbUser.Id, lastId, xmin, loc)
+		if err != nil {
+			s.logger.Error(err)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Infof("User %d closed the event stream", dbUser.Id)
+			return nil
+		case <-wake:
+		case <-heartbeat.C:
+			// Streams are also polled on every heartbeat in case a wake
+			// up was missed.
+			_, err = fmt.Fprint(res, ": heartbeat\n\n")
+			if err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+// RunEventsListener wakes the event streams of this instance whenever notes
+// change on any instance, until ctx is cancelled.
+func (s *Service) RunEventsListener(ctx context.Context) {
+	for {
+		err := s.eventsRepository.Listen(ctx, s.eventsHub.wake)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Errorf("Listening for note events failed: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.eventsHeartbeat):
+		}
+	}
+}
+
+// RunEventsCleanup deletes events older than retention every interval until
+// ctx is cancelled.
+func (s *Service) RunEventsCleanup(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.deleteOldEvents(retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) deleteOldEvents(retention time.Duration) {
+	deleted, err := s.eventsRepository.DeleteEventsBefore(time.Now().Add(-retention))
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	if deleted > 0 {
+		s.logger.Infof("%d old note events were deleted", deleted)
+	}
+}
+
+// writeEvents writes the events of the user after lastId, and those of
+// transactions running at xmin, to the stream and returns the cursor after
+// the last one written.
+func (s *Service) writeEvents(res *echo.Response, userId int, lastId, xmin int64, loc *time.Location) (int64, int64, error) {
+	eventsRepository := s.eventsRepository
+	for {
+		list, current, err := eventsRepository.GetEvents(userId, lastId, xmin, eventsBatchSize)
+		if err != nil {
+			return lastId, xmin, err
+		}
+		xmin = current
+
+		for _, event := range *list {
+			event.In(loc)
+			data, err := json.Marshal(event)
+			if err != nil {
+				return lastId, xmin, err
+			}
+
+			// Events of transactions that were running at xmin may come
+			// before ones already written, the cursor never goes back.
+			lastId = max(lastId, event.Id)
+			_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", formatCursor(lastId, xmin), event.Type, data)
+			if err != nil {
+				return lastId, xmin, err
+			}
+		}
+		if len(*list) > 0 {
+			res.Flush()
+		}
+
+		if len(*list) < eventsBatchSize {
+			return lastId, xmin, nil
+		}
+	}
+}
+
+// formatCursor encodes a position in a change log: after id, with the
+// changes of the transactions that were running at xmin still to come.
+func formatCursor(id, xmin int64) string {
+	if xmin == 0 {
+		return strconv.FormatInt(id, 10)
+	}
+
+	return fmt.Sprintf("%d.%d", id, xmin)
+}
+
+// parseCursor reads a cursor written by formatCursor. A plain id is read
+// with a zero xmin.
+func parseCursor(value string) (id, xmin int64, err error) {
+	idPart, xminPart, found := strings.Cut(value, ".")
+	id, err = strconv.ParseInt(idPart, 10, 64)
+	if err == nil && found {
+		xmin, err = strconv.ParseInt(xminPart, 10, 64)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if id < 0 || xmin < 0 {
+		return 0, 0, errors.New("negative cursor")
+	}
+
+	return id, xmin, nil
+}
@@ -0,0 +1,157 @@
+package service_test
+
+import (
+	"NotesService/internal/events"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamEvents_Resume(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/events", nil)
+	c.Request().Header.Set("Last-Event-ID", "5")
+	setUser(c, "user@test.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	mockUsers := new(MockUsersRepository)
+	mockEvents := new(MockEventsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockEvents.On("GetFirstEventId").Return(int64(3), nil)
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mockEvents.On("GetEvents", 1, int64(5), int64(0), 100).Return(&[]events.Event{
+		{Id: 6, NoteId: 2, Type: events.TypeUpdated, Version: 4, CreatedAt: createdAt},
+		{Id: 9, NoteId: 3, Type: events.TypeDeleted, Version: 2, CreatedAt: createdAt},
+	}, int64(700), nil).Once()
+	mockEvents.On("GetEvents", 1, int64(9), int64(700), 100).Return(&[]events.Event{}, int64(700), nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithEvents(mockEvents, 10*time.Millisecond))
+
+	// Act
+	err := s.StreamEvents(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	body := rec.Body.String()
+	assert.True(t, strings.HasPrefix(body,
+		"id: 6.700\nevent: updated\ndata: {\"id\":6,\"note_id\":2,\"type\":\"updated\",\"version\":4,\"created_at\":\"2024-03-01T10:00:00Z\"}\n\n"+
+			"id: 9.700\nevent: deleted\n"), body)
+	assert.Contains(t, body, ": heartbeat\n\n")
+	assert.NotContains(t, body, "reset")
+	mockEvents.AssertExpectations(t)
+}
+
+func TestStreamEvents_ResumeRunningTransactions(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/events", nil)
+	c.Request().Header.Set("Last-Event-ID", "9.700")
+	setUser(c, "user@test.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	mockUsers := new(MockUsersRepository)
+	mockEvents := new(MockEventsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockEvents.On("GetFirstEventId").Return(int64(3), nil)
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mockEvents.On("GetEvents", 1, int64(9), int64(700), 100).Return(&[]events.Event{
+		{Id: 8, NoteId: 2, Type: events.TypeUpdated, Version: 5, CreatedAt: createdAt},
+	}, int64(705), nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithEvents(mockEvents, 0))
+
+	// Act
+	err := s.StreamEvents(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "id: 9.705\nevent: updated\n"), rec.Body.String())
+	mockEvents.AssertExpectations(t)
+}
+
+func TestStreamEvents_ResetWhenCleanedUp(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/events?last_event_id=5", nil)
+	setUser(c, "user@test.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	mockUsers := new(MockUsersRepository)
+	mockEvents := new(MockEventsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockEvents.On("GetFirstEventId").Return(int64(20), nil)
+	mockEvents.On("GetEvents", 1, int64(19), int64(0), 100).Return(&[]events.Event{}, int64(700), nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithEvents(mockEvents, 0))
+
+	// Act
+	err := s.StreamEvents(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "id: 19\nevent: reset\ndata: {}\n\n", rec.Body.String())
+}
+
+func TestStreamEvents_StartsAtLastEvent(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/events", nil)
+	setUser(c, "user@test.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	mockUsers := new(MockUsersRepository)
+	mockEvents := new(MockEventsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockEvents.On("GetLastEventId").Return(int64(42), int64(700), nil)
+	mockEvents.On("GetEvents", 1, int64(42), int64(700), 100).Return(&[]events.Event{}, int64(700), nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithEvents(mockEvents, 0))
+
+	// Act
+	err := s.StreamEvents(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	mockEvents.AssertExpectations(t)
+}
+
+func TestStreamEvents_InvalidLastEventId(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/events", nil)
+	c.Request().Header.Set("Last-Event-ID", "abc")
+	setUser(c, "user@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithEvents(new(MockEventsRepository), 0))
+
+	// Act
+	err := s.StreamEvents(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
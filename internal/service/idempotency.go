@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	DefaultIdempotencyMaxBody = 10 << 20
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency replays the stored response when a mutating request is retried
+// with the same Idempotency-Key. It must run after the JWT middleware.
+//
+// The body is kept in memory to fingerprint the request, so it is limited to
+// the configured size. Multipart uploads are spooled to a temporary file
+// instead and limited like uploads.
+func (s *Service) Idempotency(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get("Idempotency-Key")
+		if key == "" || s.idempotencyRepository == nil || !isMutatingMethod(c.Request().Method) {
+			return next(c)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			s.logger.Errorf("Idempotency key of %d bytes is too long", len(key))
+			return c.JSON(s.NewError(InvalidParams))
+		}
+
+		var fingerprint string
+		var err error
+		if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+			var spooled *os.File
+			fingerprint, spooled, err = s.spoolMultipart(c)
+			if spooled != nil {
+				defer func() {
+					spooled.Close()
+					os.Remove(spooled.Name())
+				}()
+			}
+		} else {
+			fingerprint, err = s.readBody(c)
+		}
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			s.logger.Errorf("Request with idempotency key %q exceeds %d bytes", key, maxBytes.Limit)
+			return c.JSON(s.NewError(RequestTooLarge))
+		}
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+
+		dbUser, err := s.getCurrentUser(c)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+
+		idempotencyRepository := s.idempotencyRepository
+		stored, reserved, err := idempotencyRepository.ReserveKey(dbUser.Id, key, fingerprint, s.idempotencyTTL)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+
+		if !reserved {
+			if stored.Fingerprint != fingerprint {
+				s.logger.Errorf("Idempotency key %q of user %d was reused with another request", key, dbUser.Id)
+				return c.JSON(s.NewError(IdempotencyKeyReused))
+			}
+			if stored.StatusCode == 0 {
+				s.logger.Errorf("Request with idempotency key %q of user %d is still in progress", key, dbUser.Id)
+				return c.JSON(s.NewError(RequestInProgress))
+			}
+
+			s.logger.Infof("Replaying response for idempotency key %q of user %d", key, dbUser.Id)
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return c.Blob(stored.StatusCode, stored.ContentType, stored.Response)
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+		defer func() {
+			if r := recover(); r != nil {
+				// The key would otherwise stay in progress until it expires.
+				if releaseErr := idempotencyRepository.ReleaseKey(dbUser.Id, key); releaseErr != nil {
+					s.logger.Error(releaseErr)
+				}
+				panic(r)
+			}
+		}()
+		err = next(c)
+		c.Response().Writer = recorder.ResponseWriter
+
+		status := c.Response().Status
+		if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+			// Failed requests may be retried with the same key.
+			if releaseErr := idempotencyRepository.ReleaseKey(dbUser.Id, key); releaseErr != nil {
+				s.logger.Error(releaseErr)
+			}
+			return err
+		}
+
+		contentType := c.Response().Header().Get(echo.HeaderContentType)
+		err = idempotencyRepository.SaveResponse(dbUser.Id, key, status, contentType, recorder.body.Bytes())
+		if err != nil {
+			s.logger.Error(err)
+		}
+
+		return nil
+	}
+}
+
+// RunIdempotencyCleanup deletes expired idempotency keys every interval until
+// ctx is cancelled.
+func (s *Service) RunIdempotencyCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.deleteExpiredIdempotencyKeys()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) deleteExpiredIdempotencyKeys() {
+	deleted, err := s.idempotencyRepository.DeleteExpiredKeys(s.idempotencyTTL)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	if deleted > 0 {
+		s.logger.Infof("%d expired idempotency keys were deleted", deleted)
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// readBody reads the body of the request into memory, where the handler
+// reads it from again, and returns the fingerprint of the request.
+func (s *Service) readBody(c echo.Context) (string, error) {
+	req := c.Request()
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, s.idempotencyMaxBody))
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := requestHash(req, req.Header.Get(echo.HeaderContentType))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// spoolMultipart copies the multipart body of the request to a temporary
+// file, where the handler reads it from, and returns the fingerprint of the
+// request. The parts are fingerprinted rather than the body, as clients pick
+// another boundary for every request, retries included.
+func (s *Service) spoolMultipart(c echo.Context) (string, *os.File, error) {
+	req := c.Request()
+	_, params, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return "", nil, err
+	}
+
+	spooled, err := os.CreateTemp("", "request-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Leaves room for the other parts and the multipart framing, like
+	// receiveUpload.
+	body := io.TeeReader(http.MaxBytesReader(c.Response(), req.Body, s.attachmentMaxSize+1<<20), spooled)
+	hash := requestHash(req, echo.MIMEMultipartForm)
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", spooled, err
+		}
+
+		fmt.Fprintf(hash, "%q %q %q\n", part.FormName(), part.FileName(), part.Header.Get(echo.HeaderContentType))
+		_, err = io.Copy(hash, part)
+		part.Close()
+		if err != nil {
+			return "", spooled, err
+		}
+	}
+
+	// The epilogue is kept for the handler as well.
+	_, err = io.Copy(io.Discard, body)
+	if err != nil {
+		return "", spooled, err
+	}
+
+	_, err = spooled.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", spooled, err
+	}
+	req.Body = spooled
+
+	return hex.EncodeToString(hash.Sum(nil)), spooled, nil
+}
+
+// requestHash starts the fingerprint of a request with its method, path,
+// query and content type.
+func requestHash(r *http.Request, contentType string) hash.Hash {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n")
+	io.WriteString(h, r.URL.RequestURI()+"\n")
+	io.WriteString(h, contentType+"\n")
+
+	return h
+}
+
+// responseRecorder keeps a copy of the response body written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,288 @@
+package service_test
+
+import (
+	"NotesService/internal/idempotency"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIdempotency_StoresResponse(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"t","body":"b"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).Return(nil, true, nil)
+	mockKeys.On("SaveResponse", 1, "key-1", http.StatusOK, echo.MIMETextPlainCharsetUTF8, []byte("OK")).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "OK", rec.Body.String())
+	mockKeys.AssertExpectations(t)
+}
+
+func TestIdempotency_ReplaysResponse(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"t","body":"b"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	stored := &idempotency.Key{
+		StatusCode:  http.StatusCreated,
+		ContentType: echo.MIMETextPlainCharsetUTF8,
+		Response:    []byte("OK"),
+	}
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, service.DefaultIdempotencyTTL).
+		Run(func(args mock.Arguments) { stored.Fingerprint = args.String(2) }).
+		Return(stored, false, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithIdempotency(mockKeys, 0, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "OK", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotency_KeyReused(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"other"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).
+		Return(&idempotency.Key{Fingerprint: "another", StatusCode: http.StatusOK}, false, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/note/1", nil)
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	stored := &idempotency.Key{}
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).
+		Run(func(args mock.Arguments) { stored.Fingerprint = args.String(2) }).
+		Return(stored, false, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestIdempotency_ReleasesKeyOnServerError(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"t"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).Return(nil, true, nil)
+	mockKeys.On("ReleaseKey", 1, "key-1").Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		return c.JSON(s.NewError(service.InternalServerError))
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	mockKeys.AssertNotCalled(t, "SaveResponse", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockKeys.AssertCalled(t, "ReleaseKey", 1, "key-1")
+}
+
+func TestIdempotency_IgnoresReads(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes", nil)
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+
+	mockKeys := new(MockIdempotencyRepository)
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		return errors.New("handled")
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.EqualError(t, err, "handled")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockKeys.AssertNotCalled(t, "ReserveKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"too long"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockKeys := new(MockIdempotencyRepository)
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithIdempotency(mockKeys, time.Hour, 8))
+	handler := s.Idempotency(func(c echo.Context) error {
+		return errors.New("handled")
+	})
+
+	// Act
+	err := handler(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	mockKeys.AssertNotCalled(t, "ReserveKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_MultipartRetriedWithAnotherBoundary(t *testing.T) {
+	// Arrange
+	var fingerprints []string
+	mockKeys := new(MockIdempotencyRepository)
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).
+		Run(func(args mock.Arguments) { fingerprints = append(fingerprints, args.String(2)) }).
+		Return(nil, true, nil)
+	mockKeys.On("SaveResponse", 1, "key-1", http.StatusOK, echo.MIMETextPlainCharsetUTF8, []byte("OK")).Return(nil)
+
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 8))
+
+	var bodies []string
+	handler := s.Idempotency(func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		return c.String(http.StatusOK, "OK")
+	})
+
+	for _, boundary := range []string{"first", "second"} {
+		content := "--" + boundary + "\r\n" +
+			"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\n" +
+			"larger than the body limit\r\n" +
+			"--" + boundary + "--\r\n"
+		c, rec := newEchoContext(http.MethodPost, "/api/note/1/attachments", []byte(content))
+		c.Request().Header.Set(echo.HeaderContentType, "multipart/form-data; boundary="+boundary)
+		c.Request().Header.Set("Idempotency-Key", "key-1")
+		setUser(c, "user@test.com")
+
+		// Act
+		err := handler(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, content, bodies[len(bodies)-1])
+	}
+
+	if assert.Len(t, fingerprints, 2) {
+		assert.Equal(t, fingerprints[0], fingerprints[1])
+	}
+}
+
+func TestIdempotency_ReleasesKeyOnPanic(t *testing.T) {
+	// Arrange
+	c, _ := newEchoContext(http.MethodPost, "/api/note", []byte(`{"title":"t"}`))
+	c.Request().Header.Set("Idempotency-Key", "key-1")
+	setUser(c, "user@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockKeys := new(MockIdempotencyRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockKeys.On("ReserveKey", 1, "key-1", mock.Anything, time.Hour).Return(nil, true, nil)
+	mockKeys.On("ReleaseKey", 1, "key-1").Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithIdempotency(mockKeys, time.Hour, 0))
+	handler := s.Idempotency(func(c echo.Context) error {
+		panic("handler failed")
+	})
+
+	// Act
+	var recovered any
+	func() {
+		defer func() { recovered = recover() }()
+		handler(c)
+	}()
+
+	// Assert
+	assert.Equal(t, "handler failed", recovered)
+	mockKeys.AssertCalled(t, "ReleaseKey", 1, "key-1")
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// localhost:8000/api/note/:id/backlinks
+func (s *Service) GetBacklinks(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleViewer); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	backlinks, err := notesRepository.GetBacklinks(id, dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeNotes(backlinks, loc)
+
+	s.logger.Infof("Backlinks of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: backlinks})
+}
+
+// localhost:8000/api/links/dangling
+func (s *Service) GetDanglingLinks(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspaceId, err := s.activeWorkspaceId(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	links, err := notesRepository.GetDanglingLinks(dbUser.Id, workspaceId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d took his dangling links", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: links})
+}
+
+// localhost:8000/api/graph
+func (s *Service) GetGraph(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspaceId, err := s.activeWorkspaceId(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	graph, err := notesRepository.GetNoteGraph(dbUser.Id, workspaceId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d took his note graph", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: graph})
+}
+
+// rewriteLinks reads ?rewrite_links=true, which makes a rename update the
+// wiki links pointing at the note.
+func rewriteLinks(c echo.Context) (bool, error) {
+	value := c.QueryParam("rewrite_links")
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// checkRewriteLinks refuses to rewrite the links to the note for anyone but
+// its author, as the links are rewritten in the other notes of the author.
+func (s *Service) checkRewriteLinks(c echo.Context, note *notes.Note) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if note.UserId != dbUser.Id {
+		return &Response{ErrorMessage: Forbidden}
+	}
+
+	return nil
+}
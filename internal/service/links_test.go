@@ -0,0 +1,148 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetBacklinks_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/backlinks", nil)
+	c.SetPath("/api/note/:id/backlinks")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Go"}, nil)
+	mockNotes.On("GetBacklinks", 1, 1).Return(&[]notes.Note{{Id: 2, UserId: 1, Body: "see [[Go]]"}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetBacklinks(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetBacklinks_ForeignNote(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/backlinks", nil)
+	c.SetPath("/api/note/:id/backlinks")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 2}, nil)
+	mockNotes.On("GetNoteShare", 1, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetBacklinks(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "GetBacklinks", 1, mock.Anything)
+}
+
+func TestGetGraph_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/graph", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNoteGraph", 1, 0).Return(&notes.Graph{
+		Nodes: []notes.GraphNode{{Id: 1, Title: "Go"}, {Id: 2, Title: "Projects"}},
+		Edges: []notes.GraphEdge{{Source: 2, Target: 1}},
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetGraph(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Object notes.Graph `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Object.Nodes, 2)
+	assert.Equal(t, []notes.GraphEdge{{Source: 2, Target: 1}}, response.Object.Edges)
+}
+
+func TestUpdateNote_RewriteLinks(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1?rewrite_links=true",
+		[]byte(`{"title":"Golang","body":"text"}`))
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	update := noteUpdate("Golang", "text")
+	update.RewriteLinks = true
+	mockNotes.On("UpdateNote", 1, update, 0).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestUpdateNote_RewriteLinksSharedEditorForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1?rewrite_links=true",
+		[]byte(`{"title":"Golang","body":"text"}`))
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything, mock.Anything)
+}
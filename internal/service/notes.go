@@ -1,7 +1,11 @@
 package service
 
 import (
+	"NotesService/internal/notes"
+	"NotesService/internal/workspaces"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -23,11 +27,35 @@ func (s *Service) GetNote(c echo.Context) error {
 		return c.JSON(s.NewError(InvalidParams))
 	}
 
-	notesRepository := s.notesRepository
-	note, err := notesRepository.GetNote(id)
+	note, _, err := s.getSharedNote(c, id, notes.RoleViewer)
 	if err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return s.ErrorResponse(c, err)
+	}
+
+	setNoteETag(c, note)
+	if etagMatches(c.Request().Header.Get("If-None-Match"), noteETag(note), true) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	note.In(loc)
+
+	html, err := wantsHTML(c)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if html {
+		rendered, err := s.renderNotes([]notes.Note{*note})
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+
+		s.logger.Infof("Note with id %d was given rendered", id)
+		return c.JSON(http.StatusOK, Response{Object: rendered[0]})
 	}
 
 	s.logger.Infof("Note with id %d was given", id)
@@ -50,12 +78,47 @@ func (s *Service) GetUserNotes(c echo.Context) error {
 		return c.JSON(s.NewError(InternalServerError))
 	}
 
+	filter, err := notesFilter(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	workspace, err := s.getActiveWorkspace(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if workspace != nil {
+		filter.WorkspaceId = workspace.WorkspaceId
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
 	notesRepository := s.notesRepository
-	notes, err := notesRepository.GetUserNotes(dbUser.Id)
+	notes, err := notesRepository.GetUserNotes(dbUser.Id, filter)
 	if err != nil {
 		s.logger.Error(err)
 		return c.JSON(s.NewError(InternalServerError))
 	}
+	localizeNotes(notes, loc)
+
+	html, err := wantsHTML(c)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if html && notes != nil {
+		rendered, err := s.renderNotes(*notes)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+
+		s.logger.Infof("User %d took his rendered notes", dbUser.Id)
+		return c.JSON(http.StatusOK, Response{Object: rendered})
+	}
 
 	s.logger.Infof("User %d took his notes", dbUser.Id)
 	return c.JSON(http.StatusOK, Response{Object: notes})
@@ -101,11 +164,23 @@ func (s *Service) CreateNote(c echo.Context) error {
 		return c.JSON(s.NewError(InternalServerError))
 	}
 
-	err = notesRepository.CreateNote(dbUser.Id, note.Title, note.Body)
+	workspace, err := s.getActiveWorkspace(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	created := notes.Note{UserId: dbUser.Id, Title: note.Title, Body: note.Body}
+	if workspace != nil {
+		created.WorkspaceId = &workspace.WorkspaceId
+		created.Id, err = notesRepository.CreateWorkspaceNote(dbUser.Id, workspace.WorkspaceId, note.Title, note.Body)
+	} else {
+		created.Id, err = notesRepository.CreateNote(dbUser.Id, note.Title, note.Body)
+	}
 	if err != nil {
 		s.logger.Error(err)
 		return c.JSON(s.NewError(InternalServerError))
 	}
+	s.notifyMentions(c, &created, "", created.Body, nil)
 
 	s.logger.Infof("User %s created note", dbUser.Email)
 	return c.String(http.StatusOK, "OK")
@@ -126,13 +201,42 @@ func (s *Service) UpdateNote(c echo.Context) error {
 		return c.JSON(s.NewError(InvalidParams))
 	}
 
-	notesRepository := s.notesRepository
-	err = notesRepository.UpdateNote(id, note.Title, note.Body)
+	rewrite, err := rewriteLinks(c)
 	if err != nil {
 		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return c.JSON(s.NewError(InvalidParams))
 	}
 
+	current, _, err := s.getSharedNote(c, id, notes.RoleEditor)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	if rewrite {
+		if err := s.checkRewriteLinks(c, current); err != nil {
+			return s.ErrorResponse(c, err)
+		}
+	}
+
+	version, err := s.checkIfMatch(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.UpdateNote(
+		id,
+		notes.NoteUpdate{Title: &note.Title, Body: &note.Body, RewriteLinks: rewrite},
+		version)
+	if err != nil {
+		return s.noteWriteError(c, err)
+	}
+	s.pruneNoteRevisions(id)
+
+	previous := current.Body
+	current.Title, current.Body = note.Title, note.Body
+	s.notifyMentions(c, current, previous, current.Body, nil)
+
 	s.logger.Infof("Note with id %d was updated", id)
 	return c.String(http.StatusOK, "OK")
 }
@@ -145,13 +249,133 @@ func (s *Service) DeleteNote(c echo.Context) error {
 		return c.JSON(s.NewError(InvalidParams))
 	}
 
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	version, err := s.checkIfMatch(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
 	notesRepository := s.notesRepository
-	err = notesRepository.DeleteNote(id)
+	err = notesRepository.DeleteNote(id, version)
 	if err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return s.noteWriteError(c, err)
 	}
 
 	s.logger.Infof("Note with id %d was deleted", id)
 	return c.String(http.StatusOK, "OK")
 }
+
+// notesFilter reads the ?archived=true, ?favorite=true, ?tag= and ?q=
+// listing filters.
+func notesFilter(c echo.Context) (notes.NotesFilter, error) {
+	var filter notes.NotesFilter
+	var err error
+
+	if value := c.QueryParam("archived"); value != "" {
+		filter.Archived, err = strconv.ParseBool(value)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	if value := c.QueryParam("favorite"); value != "" {
+		filter.Favorites, err = strconv.ParseBool(value)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	filter.Tag = c.QueryParam("tag")
+	filter.Query = c.QueryParam("q")
+
+	return filter, nil
+}
+
+var noteRoleRanks = map[string]int{
+	notes.RoleViewer: 1,
+	notes.RoleEditor: 2,
+	notes.RoleOwner:  3,
+}
+
+// getSharedNote loads the note with the given id if the authenticated user
+// owns it, is a member of its workspace or it is shared with them with at
+// least the given role, and returns the role of the user. Notes the user has
+// no access to are reported as not found, notes they have a lesser role on as
+// forbidden.
+func (s *Service) getSharedNote(c echo.Context, id int, role string) (*notes.Note, string, error) {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		return nil, "", err
+	}
+
+	note, err := s.notesRepository.GetNote(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", &Response{ErrorMessage: NotFound}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	granted, err := s.noteRole(note, dbUser.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	if granted == "" {
+		return nil, "", &Response{ErrorMessage: NotFound}
+	}
+
+	if noteRoleRanks[granted] < noteRoleRanks[role] {
+		return nil, "", &Response{ErrorMessage: Forbidden}
+	}
+
+	return note, granted, nil
+}
+
+// noteRole returns the role the user has on the note as its owner, through
+// its workspace or a share, or "" when the user has no access.
+func (s *Service) noteRole(note *notes.Note, userId int) (string, error) {
+	if note.WorkspaceId != nil {
+		role, err := s.workspaceNoteRole(note, userId)
+		if role != "" || err != nil {
+			return role, err
+		}
+	} else if note.UserId == userId {
+		return notes.RoleOwner, nil
+	}
+
+	share, err := s.notesRepository.GetNoteShare(note.Id, userId)
+	if errors.Is(err, notes.ErrShareNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return share.Role, nil
+}
+
+// workspaceNoteRole returns the role a user has on a workspace note through
+// membership: owners and admins of the workspace and the author own the note,
+// other members edit it. Users outside the workspace get none.
+func (s *Service) workspaceNoteRole(note *notes.Note, userId int) (string, error) {
+	if s.workspacesRepository == nil {
+		return "", nil
+	}
+
+	member, err := s.workspacesRepository.GetMember(*note.WorkspaceId, userId)
+	if errors.Is(err, workspaces.ErrMemberNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if member.HasRole(workspaces.RoleAdmin) || note.UserId == userId {
+		return notes.RoleOwner, nil
+	}
+
+	return notes.RoleEditor, nil
+}
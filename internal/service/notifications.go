@@ -0,0 +1,357 @@
+package service
+
+import (
+	"NotesService/internal/comments"
+	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"NotesService/internal/users"
+	"NotesService/pkg/markdown"
+	"NotesService/pkg/notify"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// notificationDeliveryTimeout bounds the delivery of a notification by email.
+const notificationDeliveryTimeout = 30 * time.Second
+
+type NotificationsPage struct {
+	Notifications *[]notifications.Notification `json:"notifications"`
+	Unread        int                           `json:"unread"`
+	Limit         int                           `json:"limit"`
+	Offset        int                           `json:"offset"`
+}
+
+// localhost:8000/api/notifications
+//
+// Lists the notifications of the user, newest first, paginated with ?limit=
+// and ?offset=. ?unread=true lists only unread ones.
+func (s *Service) GetNotifications(c echo.Context) error {
+	var filter notifications.Filter
+	var err error
+	if value := c.QueryParam("unread"); value != "" {
+		filter.Unread, err = strconv.ParseBool(value)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	filter.Limit, filter.Offset, err = pageParams(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notificationsRepository := s.notificationsRepository
+	list, err := notificationsRepository.GetNotifications(dbUser.Id, filter)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+
+	unread, err := notificationsRepository.CountUnread(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d took his notifications", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: NotificationsPage{
+		Notifications: list,
+		Unread:        unread,
+		Limit:         filter.Limit,
+		Offset:        filter.Offset,
+	}})
+}
+
+// localhost:8000/api/notification/:id/read
+func (s *Service) MarkNotificationRead(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notificationsRepository := s.notificationsRepository
+	err = notificationsRepository.MarkRead(id, dbUser.Id)
+	if errors.Is(err, notifications.ErrNotificationNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Notification %d was read", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/notifications/read
+func (s *Service) MarkAllNotificationsRead(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notificationsRepository := s.notificationsRepository
+	read, err := notificationsRepository.MarkAllRead(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d read his %d notifications", dbUser.Id, read)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/user/notification-preferences
+func (s *Service) GetNotificationPreferences(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notificationsRepository := s.notificationsRepository
+	preferences, err := notificationsRepository.GetPreferences(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d took his notification preferences", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: preferences})
+}
+
+// localhost:8000/api/user/notification-preferences
+//
+// Sets the preferences for the listed types, the others are kept.
+func (s *Service) UpdateNotificationPreferences(c echo.Context) error {
+	var request []notifications.Preference
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if len(request) == 0 {
+		s.logger.Error("No notification preferences")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	for _, preference := range request {
+		if !slices.Contains(notifications.Types, preference.Type) {
+			s.logger.Errorf("Unknown notification type %q", preference.Type)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notificationsRepository := s.notificationsRepository
+	err = notificationsRepository.UpdatePreferences(dbUser.Id, request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d updated his notification preferences", dbUser.Id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// notifyMentions notifies the users newly mentioned in text, which was
+// before, on the note or a comment on it. Users without access to the note
+// and the author are skipped. It returns the ids of the notified users.
+func (s *Service) notifyMentions(c echo.Context, note *notes.Note, before, text string, commentId *int) []int {
+	if s.notificationsRepository == nil {
+		return nil
+	}
+
+	var mentioned []string
+	previous := markdown.Mentions(before)
+	for _, email := range markdown.Mentions(text) {
+		if !slices.Contains(previous, email) {
+			mentioned = append(mentioned, email)
+		}
+	}
+	if len(mentioned) == 0 {
+		return nil
+	}
+
+	actor, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return nil
+	}
+
+	where := fmt.Sprintf("note %q", note.Title)
+	if commentId != nil {
+		where = fmt.Sprintf("a comment on note %q", note.Title)
+	}
+
+	var notified []int
+	for _, email := range mentioned {
+		if strings.EqualFold(email, actor.Email) {
+			continue
+		}
+
+		user, err := s.usersRepository.GetUserByEmail(email)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error(err)
+			continue
+		}
+
+		if s.notifyNoteUser(user, note, notifications.Notification{
+			Type:      notifications.TypeMention,
+			ActorId:   &actor.Id,
+			NoteId:    &note.Id,
+			CommentId: commentId,
+			Text:      fmt.Sprintf("%s mentioned you in %s", actor.Email, where),
+		}) {
+			notified = append(notified, user.Id)
+		}
+	}
+
+	return notified
+}
+
+// notifyComment notifies the owner of the note and, for replies, the author
+// of the thread of a new comment. Users in skip were notified of it already.
+func (s *Service) notifyComment(actor *users.User, note *notes.Note, comment comments.Comment, thread *comments.Comment, skip []int) {
+	if s.notificationsRepository == nil {
+		return
+	}
+
+	recipients := []int{note.UserId}
+	if thread != nil {
+		recipients = append(recipients, thread.UserId)
+	}
+
+	for _, userId := range recipients {
+		if userId == actor.Id || slices.Contains(skip, userId) {
+			continue
+		}
+		skip = append(skip, userId)
+
+		user, err := s.usersRepository.GetUserById(userId)
+		if err != nil {
+			s.logger.Error(err)
+			continue
+		}
+
+		text := fmt.Sprintf("%s commented on note %q", actor.Email, note.Title)
+		if thread != nil && userId == thread.UserId {
+			text = fmt.Sprintf("%s replied to your comment on note %q", actor.Email, note.Title)
+		}
+		s.notifyNoteUser(user, note, notifications.Notification{
+			Type:      notifications.TypeComment,
+			ActorId:   &actor.Id,
+			NoteId:    &note.Id,
+			CommentId: &comment.Id,
+			Text:      text,
+		})
+	}
+}
+
+// notifyNoteUser notifies the user about the note if they have access to it
+// and reports whether they were notified.
+func (s *Service) notifyNoteUser(user *users.User, note *notes.Note, notification notifications.Notification) bool {
+	role, err := s.noteRole(note, user.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return false
+	}
+	if role == "" {
+		return false
+	}
+
+	s.notifyUser(user, notification)
+	return true
+}
+
+// notifyUser delivers the notification to the user in the app and by email,
+// as the preferences of the user ask for. Failures are only logged, they do
+// not fail the request that caused the notification.
+func (s *Service) notifyUser(user *users.User, notification notifications.Notification) {
+	if s.notificationsRepository == nil {
+		return
+	}
+
+	preferences, err := s.notificationsRepository.GetPreferences(user.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	preference := notifications.DefaultPreference(notification.Type)
+	for _, p := range *preferences {
+		if p.Type == notification.Type {
+			preference = p
+		}
+	}
+
+	notification.UserId = user.Id
+	if preference.InApp {
+		notification.Id, err = s.notificationsRepository.CreateNotification(notification)
+		if err != nil {
+			s.logger.Error(err)
+		}
+	}
+
+	if preference.Email {
+		go s.deliverNotification(user.Email, notification)
+	}
+}
+
+func (s *Service) deliverNotification(email string, notification notifications.Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationDeliveryTimeout)
+	defer cancel()
+
+	err := s.notifier.Notify(ctx, notify.Message{
+		Event:   notification.Type,
+		To:      email,
+		Subject: notification.Text,
+		Text:    notification.Text + ".",
+		Data:    notification,
+	})
+	if err != nil {
+		s.logger.Errorf("Delivery of %s notification to user %d failed: %v", notification.Type, notification.UserId, err)
+	}
+}
@@ -0,0 +1,203 @@
+package service_test
+
+import (
+	"NotesService/internal/comments"
+	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetNotifications_Unread(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notifications?unread=true", nil)
+	setUser(c, "user@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockNotifications := new(MockNotificationsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotifications.On("GetNotifications", 1, notifications.Filter{Unread: true, Limit: service.DefaultPageLimit}).
+		Return(&[]notifications.Notification{{Id: 4, Type: notifications.TypeShare, Text: "shared"}}, nil)
+	mockNotifications.On("CountUnread", 1).Return(3, nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.GetNotifications(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"unread":3`)
+	assert.Contains(t, rec.Body.String(), `"text":"shared"`)
+}
+
+func TestMarkNotificationRead_Foreign(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/notification/4/read", nil)
+	c.SetPath("/api/notification/:id/read")
+	c.SetParamNames("id")
+	c.SetParamValues("4")
+	setUser(c, "user@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockNotifications := new(MockNotificationsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotifications.On("MarkRead", 4, 1).Return(notifications.ErrNotificationNotFound)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers,
+		service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.MarkNotificationRead(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUpdateNotificationPreferences_UnknownType(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/user/notification-preferences",
+		[]byte(`[{"type":"mention","in_app":true,"email":true},{"type":"digest","in_app":false}]`))
+	setUser(c, "user@test.com")
+
+	mockNotifications := new(MockNotificationsRepository)
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.UpdateNotificationPreferences(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockNotifications.AssertNotCalled(t, "UpdatePreferences", mock.Anything, mock.Anything)
+}
+
+func TestUpdateNote_NotifiesNewMentions(t *testing.T) {
+	// Arrange
+	body := []byte(`{"title":"Plan","body":"@old@test.com @editor@test.com @stranger@test.com @ghost@test.com"}`)
+	c, rec := newEchoContext(http.MethodPut, "/note/5", body)
+	c.SetPath("/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockNotifications := new(MockNotificationsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1, Email: "user@test.com"}, nil)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2, Email: "editor@test.com"}, nil)
+	mockUsers.On("GetUserByEmail", "stranger@test.com").Return(&users.User{Id: 3, Email: "stranger@test.com"}, nil)
+	mockUsers.On("GetUserByEmail", "ghost@test.com").Return(nil, sql.ErrNoRows)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1, Body: "@old@test.com"}, nil)
+	mockNotes.On("UpdateNote", 5, mock.Anything, 0).Return(nil)
+	mockNotes.On("GetNoteShare", 5, 2).Return(&notes.Share{NoteId: 5, UserId: 2, Role: notes.RoleEditor}, nil)
+	mockNotes.On("GetNoteShare", 5, 3).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+	mockNotifications.On("GetPreferences", 2).Return(&[]notifications.Preference{}, nil)
+	var created notifications.Notification
+	mockNotifications.On("CreateNotification", mock.Anything).
+		Run(func(args mock.Arguments) { created = args.Get(0).(notifications.Notification) }).
+		Return(9, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotifications.AssertNumberOfCalls(t, "CreateNotification", 1)
+	assert.Equal(t, 2, created.UserId)
+	assert.Equal(t, notifications.TypeMention, created.Type)
+	assert.Equal(t, `user@test.com mentioned you in note "Plan"`, created.Text)
+	mockUsers.AssertNotCalled(t, "GetUserByEmail", "old@test.com")
+}
+
+func TestCreateComment_NotifiesOwnerAndThread(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/comments", []byte(`{"body":"agreed","parent_id":3}`))
+	c.SetPath("/api/note/:id/comments")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockComments := new(MockCommentsRepository)
+	mockNotifications := new(MockNotificationsRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2, Email: "editor@test.com"}, nil)
+	mockUsers.On("GetUserById", 1).Return(&users.User{Id: 1, Email: "user@test.com"}, nil)
+	mockUsers.On("GetUserById", 3).Return(&users.User{Id: 3, Email: "viewer@test.com"}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plan"}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+	mockNotes.On("GetNoteShare", 1, 3).Return(&notes.Share{NoteId: 1, UserId: 3, Role: notes.RoleViewer}, nil)
+	mockComments.On("GetComment", 3).Return(&comments.Comment{Id: 3, NoteId: 1, UserId: 3}, nil)
+	mockComments.On("CreateComment", mock.Anything).Return(8, nil)
+	mockNotifications.On("GetPreferences", 1).Return(&[]notifications.Preference{}, nil)
+	mockNotifications.On("GetPreferences", 3).
+		Return(&[]notifications.Preference{{Type: notifications.TypeComment, InApp: false}}, nil)
+	var created []notifications.Notification
+	mockNotifications.On("CreateNotification", mock.Anything).
+		Run(func(args mock.Arguments) { created = append(created, args.Get(0).(notifications.Notification)) }).
+		Return(9, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithComments(mockComments), service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.CreateComment(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, 1, created[0].UserId)
+		assert.Equal(t, notifications.TypeComment, created[0].Type)
+		assert.Equal(t, 8, *created[0].CommentId)
+	}
+	mockNotifications.AssertCalled(t, "GetPreferences", 3)
+}
+
+func TestShareNote_NotifiesCollaborator(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1/shares",
+		[]byte(`{"email":"editor@test.com","role":"editor"}`))
+	c.SetPath("/api/note/:id/shares")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockNotifications := new(MockNotificationsRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1, Email: "user@test.com"}, nil)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plan"}, nil)
+	mockNotes.On("ShareNote", 1, 2, notes.RoleEditor).Return(nil)
+	mockNotifications.On("GetPreferences", 2).Return(&[]notifications.Preference{}, nil)
+	mockNotifications.On("CreateNotification", mock.MatchedBy(func(n notifications.Notification) bool {
+		return n.UserId == 2 && n.Type == notifications.TypeShare &&
+			n.Text == `user@test.com shared note "Plan" with you as editor`
+	})).Return(9, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithNotifications(mockNotifications))
+
+	// Act
+	err := s.ShareNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotifications.AssertExpectations(t)
+}
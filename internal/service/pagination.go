@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// pageParams reads the ?limit= and ?offset= parameters of paginated
+// listings.
+func pageParams(c echo.Context) (limit, offset int, err error) {
+	limit = DefaultPageLimit
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, err
+		}
+		if limit <= 0 || limit > MaxPageLimit {
+			return 0, 0, errors.New("limit out of range")
+		}
+	}
+
+	if value := c.QueryParam("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset < 0 {
+			return 0, 0, errors.New("negative offset")
+		}
+	}
+
+	return limit, offset, nil
+}
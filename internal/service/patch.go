@@ -0,0 +1,245 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+
+	// patchAttempts bounds how often an unconditional PATCH is re-applied
+	// when the note changes between reading and writing it.
+	patchAttempts = 3
+)
+
+// NotePatch is the document PATCH requests are applied to. A field becomes
+// patchable by adding it here and to notes.NoteUpdate.
+type NotePatch struct {
+	Title    *string   `json:"title"`
+	Body     *string   `json:"body"`
+	Pinned   *bool     `json:"pinned"`
+	Archived *bool     `json:"archived"`
+	Favorite *bool     `json:"favorite"`
+	Tags     *[]string `json:"tags"`
+}
+
+func newNotePatch(note *notes.Note) NotePatch {
+	return NotePatch{
+		Title:    &note.Title,
+		Body:     &note.Body,
+		Pinned:   &note.Pinned,
+		Archived: &note.Archived,
+		Favorite: &note.Favorite,
+		Tags:     &note.Tags,
+	}
+}
+
+// update returns the changes the patched document makes to the note.
+func (p NotePatch) update(note *notes.Note) (notes.NoteUpdate, bool) {
+	var update notes.NoteUpdate
+	changed := false
+
+	if *p.Title != note.Title {
+		update.Title = p.Title
+		changed = true
+	}
+	if *p.Body != note.Body {
+		update.Body = p.Body
+		changed = true
+	}
+	if *p.Pinned != note.Pinned {
+		update.Pinned = p.Pinned
+		changed = true
+	}
+	if *p.Archived != note.Archived {
+		update.Archived = p.Archived
+		changed = true
+	}
+	if *p.Favorite != note.Favorite {
+		update.Favorite = p.Favorite
+		changed = true
+	}
+	if !slices.Equal(*p.Tags, note.Tags) {
+		update.Tags = p.Tags
+		changed = true
+	}
+
+	return update, changed
+}
+
+// apply copies the patched fields onto the note.
+func (p NotePatch) apply(note *notes.Note) {
+	note.Title = *p.Title
+	note.Body = *p.Body
+	note.Pinned = *p.Pinned
+	note.Archived = *p.Archived
+	note.Favorite = *p.Favorite
+	note.Tags = notes.NormalizeTags(*p.Tags)
+}
+
+// localhost:8000/api/note/:id
+//
+// Accepts application/merge-patch+json (RFC 7396) and
+// application/json-patch+json (RFC 6902) documents.
+func (s *Service) PatchNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	contentType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || (contentType != MIMEMergePatch && contentType != MIMEJSONPatch) {
+		s.logger.Errorf("Unsupported patch content type %q", contentType)
+		return c.JSON(s.NewError(UnsupportedMediaType))
+	}
+
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var operations jsonpatch.Patch
+	if contentType == MIMEJSONPatch {
+		operations, err = jsonpatch.DecodePatch(patch)
+	} else if !json.Valid(patch) {
+		err = errors.New("malformed merge patch")
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	rewrite, err := rewriteLinks(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch == "" && s.requireIfMatch {
+		return c.JSON(s.NewError(PreconditionRequired))
+	}
+
+	for attempt := 1; ; attempt++ {
+		note, role, err := s.getSharedNote(c, id, notes.RoleEditor)
+		if err != nil {
+			return s.ErrorResponse(c, err)
+		}
+
+		if ifMatch != "" && !etagMatches(ifMatch, noteETag(note), false) {
+			return c.JSON(s.NewError(PreconditionFailed))
+		}
+
+		patched, err := applyNotePatch(note, contentType, patch, operations)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(Conflict))
+		}
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidPatch))
+		}
+
+		update, changed := patched.update(note)
+		if !changed {
+			setNoteETag(c, note)
+			return c.JSON(http.StatusOK, Response{Object: note})
+		}
+
+		// Pins, archive and favorites organize the notes of the owner.
+		if role != notes.RoleOwner && (update.Pinned != nil || update.Archived != nil || update.Favorite != nil) {
+			return c.JSON(s.NewError(Forbidden))
+		}
+
+		if rewrite && update.Title != nil {
+			if err := s.checkRewriteLinks(c, note); err != nil {
+				return s.ErrorResponse(c, err)
+			}
+			update.RewriteLinks = true
+		}
+		err = s.notesRepository.UpdateNote(id, update, note.Version)
+		if errors.Is(err, notes.ErrVersionMismatch) && ifMatch == "" && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return s.noteWriteError(c, err)
+		}
+		s.pruneNoteRevisions(id)
+
+		previous := note.Body
+		patched.apply(note)
+		note.Version++
+		s.notifyMentions(c, note, previous, note.Body, nil)
+		setNoteETag(c, note)
+
+		loc, err := s.userLocation(c, nil)
+		if err != nil {
+			return s.ErrorResponse(c, err)
+		}
+		note.In(loc)
+
+		s.logger.Infof("Note with id %d was patched", id)
+		return c.JSON(http.StatusOK, Response{Object: note})
+	}
+}
+
+// applyNotePatch applies a JSON Patch or a JSON Merge Patch, depending on the
+// content type, to the patchable representation of the note.
+func applyNotePatch(
+	note *notes.Note,
+	contentType string,
+	patch []byte,
+	operations jsonpatch.Patch) (*NotePatch, error) {
+	doc, err := json.Marshal(newNotePatch(note))
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == MIMEJSONPatch {
+		doc, err = operations.Apply(doc)
+	} else {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patched NotePatch
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, err
+	}
+
+	if patched.Title == nil {
+		return nil, errors.New("title is required")
+	}
+	if patched.Body == nil {
+		empty := ""
+		patched.Body = &empty
+	}
+	for _, flag := range []**bool{&patched.Pinned, &patched.Archived, &patched.Favorite} {
+		if *flag == nil {
+			*flag = new(bool)
+		}
+	}
+	if patched.Tags == nil {
+		patched.Tags = &[]string{}
+	}
+
+	return &patched, nil
+}
@@ -0,0 +1,165 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchNote_MergePatch(t *testing.T) {
+	// Arrange
+	body := []byte(`{"body":"patched"}`)
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", body)
+	c.Request().Header.Set(echo.HeaderContentType, service.MIMEMergePatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "t", Body: "b", Version: 4}, nil)
+	patched := "patched"
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Body: &patched}, 4).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1-5"`, rec.Header().Get("ETag"))
+	mockNotes.AssertExpectations(t)
+}
+
+func TestPatchNote_JSONPatch(t *testing.T) {
+	// Arrange
+	body := []byte(`[{"op":"test","path":"/title","value":"t"},{"op":"replace","path":"/title","value":"new"}]`)
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", body)
+	c.Request().Header.Set(echo.HeaderContentType, service.MIMEJSONPatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "t", Body: "b", Version: 1}, nil)
+	title := "new"
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Title: &title}, 1).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestPatchNote_Flags(t *testing.T) {
+	// Arrange
+	body := []byte(`{"pinned":true,"favorite":null}`)
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", body)
+	c.Request().Header.Set(echo.HeaderContentType, service.MIMEMergePatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "t", Favorite: true}, nil)
+	pinned, favorite := true, false
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Pinned: &pinned, Favorite: &favorite}, 0).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestPatchNote_FailedTest(t *testing.T) {
+	// Arrange
+	body := []byte(`[{"op":"test","path":"/title","value":"other"}]`)
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", body)
+	c.Request().Header.Set(echo.HeaderContentType, service.MIMEJSONPatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "t"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestPatchNote_UnknownField(t *testing.T) {
+	// Arrange
+	body := []byte(`{"user_id":2}`)
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", body)
+	c.Request().Header.Set(echo.HeaderContentType, service.MIMEMergePatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "t"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestPatchNote_UnsupportedMediaType(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", []byte(`{"title":"x"}`))
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository))
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
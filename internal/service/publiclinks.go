@@ -0,0 +1,316 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/publiclinks"
+	"NotesService/pkg/markdown"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PublicLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxViews  *int       `json:"max_views"`
+	Password  string     `json:"password"`
+}
+
+// PublicLinkResponse is returned once, when the link is created. Later only
+// the hash of the token is known.
+type PublicLinkResponse struct {
+	publiclinks.Link
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// PublicNote is what a public link shows of a note.
+type PublicNote struct {
+	Title     string             `json:"title"`
+	Body      string             `json:"body"`
+	BodyHTML  string             `json:"body_html"`
+	TOC       []markdown.Heading `json:"toc"`
+	Tags      []string           `json:"tags"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+var publicNotePage = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>body{max-width:46rem;margin:2rem auto;padding:0 1rem;font-family:sans-serif;line-height:1.5}</style>
+</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+{{.BodyHTML}}
+</article>
+</body>
+</html>
+`))
+
+// localhost:8000/api/note/:id/links
+func (s *Service) CreatePublicLink(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request PublicLinkRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		s.logger.Errorf("Public link expiry %s is in the past", request.ExpiresAt)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if request.MaxViews != nil && *request.MaxViews <= 0 {
+		s.logger.Errorf("Invalid public link view limit %d", *request.MaxViews)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	link := publiclinks.Link{
+		NoteId:    id,
+		TokenHash: hashToken(token),
+		ExpiresAt: request.ExpiresAt,
+		MaxViews:  request.MaxViews,
+		CreatedAt: time.Now(),
+	}
+	if request.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+		hash := string(hashed)
+		link.PasswordHash = &hash
+		link.Protected = true
+	}
+
+	linksRepository := s.publicLinksRepository
+	link.Id, err = linksRepository.CreateLink(link)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	link.In(loc)
+
+	s.logger.Infof("Public link %d was created for note with id %d", link.Id, id)
+	return c.JSON(http.StatusOK, Response{Object: PublicLinkResponse{
+		Link:  link,
+		Token: token,
+		URL:   fmt.Sprintf("%s://%s/s/%s", c.Scheme(), c.Request().Host, token),
+	}})
+}
+
+// localhost:8000/api/note/:id/links
+func (s *Service) GetPublicLinks(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	linksRepository := s.publicLinksRepository
+	links, err := linksRepository.GetNoteLinks(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *links {
+		(*links)[i].In(loc)
+	}
+
+	s.logger.Infof("Public links of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: links})
+}
+
+// localhost:8000/api/link/:id
+func (s *Service) RevokePublicLink(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	linksRepository := s.publicLinksRepository
+	link, err := linksRepository.GetLink(id)
+	if errors.Is(err, publiclinks.ErrLinkNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if _, _, err := s.getSharedNote(c, link.NoteId, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	err = linksRepository.RevokeLink(id)
+	if errors.Is(err, publiclinks.ErrLinkNotFound) {
+		s.logger.Errorf("Public link %d is already revoked", id)
+		return c.JSON(s.NewError(Gone))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Public link %d was revoked", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/s/:token
+//
+// Serves the note of a public link as JSON or, for ?format=html and for
+// browsers, as an HTML page. Passwords are taken from basic authentication,
+// so browsers ask for them. Every successful request counts as a view.
+func (s *Service) GetPublicNote(c echo.Context) error {
+	page, err := wantsPublicPage(c)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	linksRepository := s.publicLinksRepository
+	link, err := linksRepository.GetLinkByToken(hashToken(c.Param("token")))
+	if errors.Is(err, publiclinks.ErrLinkNotFound) {
+		s.logger.Error("Unknown public link token")
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if !link.Active(time.Now()) {
+		s.logger.Errorf("Public link %d is no longer active", link.Id)
+		return c.JSON(s.NewError(Gone))
+	}
+
+	if link.PasswordHash != nil {
+		_, password, ok := c.Request().BasicAuth()
+		if !ok || bcrypt.CompareHashAndPassword([]byte(*link.PasswordHash), []byte(password)) != nil {
+			s.logger.Errorf("Wrong password for public link %d", link.Id)
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="note", charset="UTF-8"`)
+			return c.JSON(s.NewError(Unauthorized))
+		}
+	}
+
+	note, err := s.notesRepository.GetNote(link.NoteId)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Errorf("Note of public link %d is gone", link.Id)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	doc, err := s.renderNote(note)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	counted, err := linksRepository.RecordView(link.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	if !counted {
+		s.logger.Errorf("Public link %d is no longer active", link.Id)
+		return c.JSON(s.NewError(Gone))
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("X-Robots-Tag", "noindex")
+
+	public := PublicNote{
+		Title:     note.Title,
+		Body:      note.Body,
+		BodyHTML:  doc.HTML,
+		TOC:       doc.TOC,
+		Tags:      note.Tags,
+		UpdatedAt: note.UpdatedAt,
+	}
+
+	s.logger.Infof("Note with id %d was viewed through public link %d", note.Id, link.Id)
+	if !page {
+		return c.JSON(http.StatusOK, Response{Object: public})
+	}
+
+	var body bytes.Buffer
+	err = publicNotePage.Execute(&body, struct {
+		Title    string
+		BodyHTML template.HTML
+	}{
+		Title: note.Title,
+		// The rendered body is sanitized.
+		BodyHTML: template.HTML(doc.HTML),
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:")
+	return c.HTMLBlob(http.StatusOK, body.Bytes())
+}
+
+// wantsPublicPage reports whether a public link is to be served as an HTML
+// page: on ?format=html, or without ?format when the client accepts HTML.
+func wantsPublicPage(c echo.Context) (bool, error) {
+	switch c.QueryParam("format") {
+	case "":
+		return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML), nil
+	case "json":
+		return false, nil
+	case FormatHTML:
+		return true, nil
+	}
+
+	return false, &Response{ErrorMessage: InvalidParams}
+}
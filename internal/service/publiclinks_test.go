@@ -0,0 +1,243 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/publiclinks"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCreatePublicLink_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/links",
+		[]byte(`{"max_views":3,"password":"secret"}`))
+	c.SetPath("/api/note/:id/links")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockLinks := new(MockPublicLinksRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	var created publiclinks.Link
+	mockLinks.On("CreateLink", mock.Anything).
+		Run(func(args mock.Arguments) { created = args.Get(0).(publiclinks.Link) }).
+		Return(7, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithPublicLinks(mockLinks))
+
+	// Act
+	err := s.CreatePublicLink(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Object service.PublicLinkResponse `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	token := response.Object.Token
+	assert.NotEmpty(t, token)
+	assert.Equal(t, 7, response.Object.Id)
+	assert.True(t, response.Object.Protected)
+	assert.True(t, strings.HasSuffix(response.Object.URL, "/s/"+token))
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	sum := sha256.Sum256([]byte(token))
+	assert.Equal(t, hex.EncodeToString(sum[:]), created.TokenHash)
+	assert.Equal(t, 3, *created.MaxViews)
+	if assert.NotNil(t, created.PasswordHash) {
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(*created.PasswordHash), []byte("secret")))
+	}
+}
+
+func TestCreatePublicLink_ExpiryInThePast(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/links",
+		[]byte(`{"expires_at":"2020-01-01T00:00:00Z"}`))
+	c.SetPath("/api/note/:id/links")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockLinks := new(MockPublicLinksRepository)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithPublicLinks(mockLinks))
+
+	// Act
+	err := s.CreatePublicLink(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockLinks.AssertNotCalled(t, "CreateLink", mock.Anything)
+}
+
+func TestGetPublicNote_JSON(t *testing.T) {
+	// Arrange
+	c, rec, mockNotes, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1})
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plans", Body: "**bold**"}, nil)
+	mockLinks.On("RecordView", 7).Return(true, nil)
+
+	// Act
+	err := s.GetPublicNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var response struct {
+		Object map[string]any `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "Plans", response.Object["title"])
+	assert.Equal(t, "<p><strong>bold</strong></p>\n", response.Object["body_html"])
+	assert.NotContains(t, response.Object, "user_id")
+	mockLinks.AssertExpectations(t)
+}
+
+func TestGetPublicNote_HTMLPage(t *testing.T) {
+	// Arrange
+	c, rec, mockNotes, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1})
+	c.Request().Header.Set(echo.HeaderAccept, "text/html,application/xhtml+xml")
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "<Plans>", Body: "text"}, nil)
+	mockLinks.On("RecordView", 7).Return(true, nil)
+
+	// Act
+	err := s.GetPublicNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"))
+	assert.Contains(t, rec.Body.String(), "<h1>&lt;Plans&gt;</h1>")
+	assert.Contains(t, rec.Body.String(), "<p>text</p>")
+}
+
+func TestGetPublicNote_Expired(t *testing.T) {
+	// Arrange
+	expired := time.Now().Add(-time.Hour)
+	c, rec, _, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1, ExpiresAt: &expired})
+
+	// Act
+	err := s.GetPublicNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	mockLinks.AssertNotCalled(t, "RecordView", 7)
+}
+
+func TestGetPublicNote_ViewLimitReached(t *testing.T) {
+	// Arrange
+	c, rec, mockNotes, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1})
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plans"}, nil)
+	mockLinks.On("RecordView", 7).Return(false, nil)
+
+	// Act
+	err := s.GetPublicNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "Plans")
+}
+
+func TestGetPublicNote_Password(t *testing.T) {
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	hash := string(hashed)
+
+	t.Run("missing", func(t *testing.T) {
+		// Arrange
+		c, rec, _, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1, PasswordHash: &hash})
+
+		// Act
+		err := s.GetPublicNote(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+		mockLinks.AssertNotCalled(t, "RecordView", 7)
+	})
+
+	t.Run("correct", func(t *testing.T) {
+		// Arrange
+		c, rec, mockNotes, mockLinks, s := newPublicNoteContext(&publiclinks.Link{Id: 7, NoteId: 1, PasswordHash: &hash})
+		c.Request().SetBasicAuth("", "secret")
+		mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plans"}, nil)
+		mockLinks.On("RecordView", 7).Return(true, nil)
+
+		// Act
+		err := s.GetPublicNote(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestRevokePublicLink_ForeignNote(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/link/7", nil)
+	c.SetPath("/api/link/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockLinks := new(MockPublicLinksRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockLinks.On("GetLink", 7).Return(&publiclinks.Link{Id: 7, NoteId: 2}, nil)
+	mockNotes.On("GetNote", 2).Return(&notes.Note{Id: 2, UserId: 5}, nil)
+	mockNotes.On("GetNoteShare", 2, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithPublicLinks(mockLinks))
+
+	// Act
+	err := s.RevokePublicLink(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockLinks.AssertNotCalled(t, "RevokeLink", 7)
+}
+
+func newPublicNoteContext(link *publiclinks.Link) (
+	echo.Context,
+	*httptest.ResponseRecorder,
+	*MockNotesRepository,
+	*MockPublicLinksRepository,
+	*service.Service) {
+	c, rec := newEchoContext(http.MethodGet, "/s/token", nil)
+	c.SetPath("/s/:token")
+	c.SetParamNames("token")
+	c.SetParamValues("token")
+
+	sum := sha256.Sum256([]byte("token"))
+	mockNotes := new(MockNotesRepository)
+	mockLinks := new(MockPublicLinksRepository)
+	mockLinks.On("GetLinkByToken", hex.EncodeToString(sum[:])).Return(link, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, new(MockUsersRepository), service.WithPublicLinks(mockLinks))
+	return c, rec, mockNotes, mockLinks, s
+}
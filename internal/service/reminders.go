@@ -0,0 +1,326 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/reminders"
+	"NotesService/pkg/notify"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultReminderBatchSize = 100
+
+	// reminderDeliveryTimeout bounds the delivery of a reminder through a
+	// single notifier.
+	reminderDeliveryTimeout = 30 * time.Second
+	// reminderClaimLease is how long a claimed reminder is held back from
+	// other instances while it is delivered.
+	reminderClaimLease = 5 * time.Minute
+)
+
+type ReminderRequest struct {
+	// RemindAt is either RFC 3339 or 2006-01-02T15:04 in TimeZone.
+	RemindAt string `json:"remind_at"`
+	RRule    string `json:"rrule"`
+	// TimeZone defaults to the time zone of the user.
+	TimeZone string `json:"time_zone"`
+}
+
+// ReminderNotification is the data of reminder webhooks.
+type ReminderNotification struct {
+	ReminderId int       `json:"reminder_id"`
+	NoteId     int       `json:"note_id"`
+	NoteTitle  string    `json:"note_title"`
+	DueAt      time.Time `json:"due_at"`
+}
+
+// localhost:8000/api/note/:id/reminders
+func (s *Service) CreateReminder(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request ReminderRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleOwner)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if request.TimeZone != "" {
+		loc, err = time.LoadLocation(request.TimeZone)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	remindAt, err := time.Parse(time.RFC3339, request.RemindAt)
+	if err != nil {
+		remindAt, err = time.ParseInLocation("2006-01-02T15:04", request.RemindAt, loc)
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	reminder := reminders.Reminder{
+		NoteId:   note.Id,
+		UserId:   dbUser.Id,
+		RemindAt: remindAt,
+		RRule:    strings.TrimPrefix(strings.TrimSpace(request.RRule), "RRULE:"),
+		TimeZone: loc.String(),
+	}
+	reminder.DueAt, err = reminder.Next(time.Now())
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if reminder.DueAt == nil {
+		s.logger.Errorf("Reminder for note with id %d never fires", id)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	remindersRepository := s.remindersRepository
+	reminder.Id, err = remindersRepository.CreateReminder(reminder)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	reminder.In(loc)
+
+	s.logger.Infof("Reminder with id %d was set on note with id %d", reminder.Id, id)
+	return c.JSON(http.StatusOK, Response{Object: reminder})
+}
+
+// localhost:8000/api/note/:id/reminders
+func (s *Service) GetNoteReminders(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	remindersRepository := s.remindersRepository
+	list, err := remindersRepository.GetNoteReminders(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeReminders(list, loc)
+
+	s.logger.Infof("Reminders of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: list})
+}
+
+// localhost:8000/api/reminders
+func (s *Service) GetReminders(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	remindersRepository := s.remindersRepository
+	list, err := remindersRepository.GetUserReminders(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeReminders(list, loc)
+
+	s.logger.Infof("User %d took his reminders", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: list})
+}
+
+// localhost:8000/api/reminder/:id
+func (s *Service) DeleteReminder(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	remindersRepository := s.remindersRepository
+	reminder, err := remindersRepository.GetReminder(id)
+	if err == nil && reminder.UserId != dbUser.Id {
+		err = reminders.ErrReminderNotFound
+	}
+	if err == nil {
+		err = remindersRepository.DeleteReminder(id)
+	}
+	if errors.Is(err, reminders.ErrReminderNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Reminder with id %d was deleted", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// RunReminderScheduler delivers due reminders every interval until ctx is
+// cancelled, at most batchSize per run. Any number of instances may run it.
+func (s *Service) RunReminderScheduler(ctx context.Context, interval time.Duration, batchSize int) {
+	if batchSize <= 0 {
+		batchSize = DefaultReminderBatchSize
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.fireReminders(ctx, batchSize)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) fireReminders(ctx context.Context, batchSize int) {
+	fired := 0
+	for i := 0; i < batchSize && ctx.Err() == nil; i++ {
+		due, err := s.remindersRepository.ClaimDueReminder(reminderClaimLease)
+		if err != nil {
+			s.logger.Error(err)
+			break
+		}
+		if due == nil {
+			break
+		}
+
+		delivered := false
+		if due.Reminder.Attempts > reminders.MaxAttempts {
+			// Earlier claims were never finished, the occurrence is skipped.
+			s.logger.Errorf("Reminder %d was given up after %d attempts", due.Reminder.Id, reminders.MaxAttempts)
+		} else {
+			delivered = s.deliverReminder(ctx, *due)
+		}
+		if err := s.remindersRepository.FinishReminder(due.Reminder, delivered); err != nil {
+			s.logger.Error(err)
+			continue
+		}
+		if delivered {
+			fired++
+		}
+	}
+
+	if fired > 0 {
+		s.logger.Infof("%d reminders were fired", fired)
+	}
+}
+
+// deliverReminder sends the reminder through every notifier it was not yet
+// delivered through for this occurrence, so that a retry does not repeat
+// the ones that succeeded, and reports whether all of them succeeded.
+func (s *Service) deliverReminder(ctx context.Context, due reminders.Due) bool {
+	reminder := due.Reminder
+	delivered, err := s.remindersRepository.GetDeliveries(reminder.Id, *reminder.DueAt)
+	if err != nil {
+		s.logger.Error(err)
+		return false
+	}
+
+	message := reminderMessage(due)
+	ok := true
+	for _, channel := range notify.Channels(s.notifier) {
+		if slices.Contains(delivered, channel.Name) {
+			continue
+		}
+
+		deliveryCtx, cancel := context.WithTimeout(ctx, reminderDeliveryTimeout)
+		err := channel.Notify(deliveryCtx, message)
+		cancel()
+		if err == nil {
+			err = s.remindersRepository.AddDelivery(reminder.Id, *reminder.DueAt, channel.Name)
+		}
+		if err != nil {
+			s.logger.Errorf("Delivery of reminder with id %d through %s failed: %v", reminder.Id, channel.Name, err)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func reminderMessage(due reminders.Due) notify.Message {
+	dueAt := *due.Reminder.DueAt
+	if loc, err := time.LoadLocation(due.Reminder.TimeZone); err == nil {
+		dueAt = dueAt.In(loc)
+	}
+
+	return notify.Message{
+		Event:   "reminder",
+		To:      due.Email,
+		Subject: "Reminder: " + due.NoteTitle,
+		Text:    fmt.Sprintf("Reminder for note %q due at %s.", due.NoteTitle, dueAt.Format("2006-01-02 15:04 MST")),
+		Data: ReminderNotification{
+			ReminderId: due.Reminder.Id,
+			NoteId:     due.Reminder.NoteId,
+			NoteTitle:  due.NoteTitle,
+			DueAt:      dueAt,
+		},
+	}
+}
+
+func localizeReminders(list *[]reminders.Reminder, loc *time.Location) {
+	if list == nil {
+		return
+	}
+
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+}
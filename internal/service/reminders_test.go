@@ -0,0 +1,257 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/reminders"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"NotesService/pkg/notify"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateReminder_OneShot(t *testing.T) {
+	// Arrange
+	remindAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/reminders",
+		[]byte(`{"remind_at":"`+remindAt.Format(time.RFC3339)+`"}`))
+	c.SetPath("/api/note/:id/reminders")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockReminders.On("CreateReminder", mock.MatchedBy(func(r reminders.Reminder) bool {
+		return r.NoteId == 1 && r.UserId == 1 && r.RemindAt.Equal(remindAt) &&
+			r.TimeZone == "UTC" && r.DueAt != nil && r.DueAt.Equal(remindAt)
+	})).Return(4, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.CreateReminder(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockReminders.AssertExpectations(t)
+}
+
+func TestCreateReminder_RecurringKeepsWallClock(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/reminders",
+		[]byte(`{"remind_at":"2024-03-01T09:30","rrule":"RRULE:FREQ=DAILY","time_zone":"Europe/Berlin"}`))
+	c.SetPath("/api/note/:id/reminders")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	var created reminders.Reminder
+	mockReminders.On("CreateReminder", mock.Anything).
+		Run(func(args mock.Arguments) { created = args.Get(0).(reminders.Reminder) }).
+		Return(4, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.CreateReminder(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "FREQ=DAILY", created.RRule)
+	assert.True(t, created.DueAt.After(time.Now()))
+	assert.Equal(t, "09:30", created.DueAt.In(berlin).Format("15:04"))
+}
+
+func TestCreateReminder_InvalidRule(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/reminders",
+		[]byte(`{"remind_at":"2024-03-01T09:30","rrule":"FREQ=SOMETIMES"}`))
+	c.SetPath("/api/note/:id/reminders")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.CreateReminder(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockReminders.AssertNotCalled(t, "CreateReminder", mock.Anything)
+}
+
+func TestCreateReminder_InThePast(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/reminders", []byte(`{"remind_at":"2020-01-01T10:00:00Z"}`))
+	c.SetPath("/api/note/:id/reminders")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.CreateReminder(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestDeleteReminder_ForeignReminder(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/reminder/4", nil)
+	c.SetPath("/api/reminder/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("4")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockReminders.On("GetReminder", 4).Return(&reminders.Reminder{Id: 4, UserId: 2}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithReminders(mockReminders, nil))
+
+	// Act
+	err := s.DeleteReminder(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockReminders.AssertNotCalled(t, "DeleteReminder", 4)
+}
+
+func TestRunReminderScheduler_Delivers(t *testing.T) {
+	// Arrange
+	dueAt := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	standup := reminders.Reminder{Id: 4, NoteId: 1, TimeZone: "Europe/Berlin", DueAt: &dueAt, Attempts: 1}
+	broken := reminders.Reminder{Id: 5, NoteId: 2, TimeZone: "UTC", DueAt: &dueAt, Attempts: 1}
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockReminders := new(MockRemindersRepository)
+	mockNotifier := new(MockNotifier)
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return(&reminders.Due{Reminder: standup, NoteTitle: "Standup", Email: "user@test.com"}, nil).Once()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return(&reminders.Due{Reminder: broken, NoteTitle: "Broken", Email: "user@test.com"}, nil).Once()
+	mockReminders.On("GetDeliveries", mock.Anything, dueAt).Return([]string{}, nil)
+	mockReminders.On("AddDelivery", 4, dueAt, "email").Return(nil)
+	mockReminders.On("FinishReminder", standup, true).Return(nil)
+	mockReminders.On("FinishReminder", broken, false).Return(nil)
+	mockNotifier.On("Notify", mock.MatchedBy(func(m notify.Message) bool { return m.Subject == "Reminder: Standup" })).
+		Return(nil)
+	mockNotifier.On("Notify", mock.MatchedBy(func(m notify.Message) bool { return m.Subject == "Reminder: Broken" })).
+		Return(errors.New("smtp is down"))
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers,
+		service.WithReminders(mockReminders, notify.Named{Name: "email", Notifier: mockNotifier}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return((*reminders.Due)(nil), nil).Run(func(mock.Arguments) { cancel() })
+
+	// Act
+	s.RunReminderScheduler(ctx, time.Hour, 10)
+
+	// Assert
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	message := mockNotifier.Calls[0].Arguments.Get(0).(notify.Message)
+	assert.Equal(t, "user@test.com", message.To)
+	assert.Equal(t, "Reminder for note \"Standup\" due at 2024-03-01 09:30 CET.", message.Text)
+	mockReminders.AssertExpectations(t)
+	mockReminders.AssertNotCalled(t, "AddDelivery", 5, dueAt, "email")
+}
+
+func TestRunReminderScheduler_SkipsDeliveredChannels(t *testing.T) {
+	// Arrange
+	dueAt := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	reminder := reminders.Reminder{Id: 4, NoteId: 1, TimeZone: "UTC", DueAt: &dueAt, Attempts: 2}
+	mockReminders := new(MockRemindersRepository)
+	emailNotifier := new(MockNotifier)
+	webhookNotifier := new(MockNotifier)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return(&reminders.Due{Reminder: reminder, NoteTitle: "Standup", Email: "user@test.com"}, nil).Once()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return((*reminders.Due)(nil), nil).Run(func(mock.Arguments) { cancel() })
+	mockReminders.On("GetDeliveries", 4, dueAt).Return([]string{"email"}, nil)
+	mockReminders.On("AddDelivery", 4, dueAt, "webhook").Return(nil)
+	mockReminders.On("FinishReminder", reminder, true).Return(nil)
+	webhookNotifier.On("Notify", mock.Anything).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithReminders(mockReminders, notify.Multi{
+			notify.Named{Name: "email", Notifier: emailNotifier},
+			notify.Named{Name: "webhook", Notifier: webhookNotifier},
+		}))
+
+	// Act
+	s.RunReminderScheduler(ctx, time.Hour, 10)
+
+	// Assert
+	emailNotifier.AssertNotCalled(t, "Notify", mock.Anything)
+	webhookNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	mockReminders.AssertExpectations(t)
+}
+
+func TestRunReminderScheduler_GivesUpAbandonedClaims(t *testing.T) {
+	// Arrange
+	dueAt := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	reminder := reminders.Reminder{Id: 4, NoteId: 1, TimeZone: "UTC", DueAt: &dueAt, Attempts: reminders.MaxAttempts + 1}
+	mockReminders := new(MockRemindersRepository)
+	mockNotifier := new(MockNotifier)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return(&reminders.Due{Reminder: reminder, NoteTitle: "Standup", Email: "user@test.com"}, nil).Once()
+	mockReminders.On("ClaimDueReminder", mock.Anything).
+		Return((*reminders.Due)(nil), nil).Run(func(mock.Arguments) { cancel() })
+	mockReminders.On("FinishReminder", reminder, false).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository),
+		service.WithReminders(mockReminders, notify.Named{Name: "email", Notifier: mockNotifier}))
+
+	// Act
+	s.RunReminderScheduler(ctx, time.Hour, 10)
+
+	// Assert
+	mockNotifier.AssertNotCalled(t, "Notify", mock.Anything)
+	mockReminders.AssertExpectations(t)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/pkg/markdown"
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	FormatHTML = "html"
+
+	DefaultRenderCacheSize = 1000
+)
+
+// RenderedNote is a note with its body rendered to HTML, returned for
+// ?format=html.
+type RenderedNote struct {
+	notes.Note
+	BodyHTML string             `json:"body_html"`
+	TOC      []markdown.Heading `json:"toc"`
+}
+
+type RenderResponse struct {
+	Id      int                `json:"id"`
+	Version int                `json:"version"`
+	HTML    string             `json:"html"`
+	TOC     []markdown.Heading `json:"toc"`
+}
+
+// localhost:8000/api/note/:id/render
+func (s *Service) RenderNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	setNoteETag(c, note)
+	if etagMatches(c.Request().Header.Get("If-None-Match"), noteETag(note), true) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	doc, err := s.renderNote(note)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Note with id %d was rendered", id)
+	return c.JSON(http.StatusOK, Response{Object: RenderResponse{
+		Id:      note.Id,
+		Version: note.Version,
+		HTML:    doc.HTML,
+		TOC:     doc.TOC,
+	}})
+}
+
+// wantsHTML reports whether a read request asked for rendered bodies with
+// ?format=html.
+func wantsHTML(c echo.Context) (bool, error) {
+	switch c.QueryParam("format") {
+	case "", "json":
+		return false, nil
+	case FormatHTML:
+		return true, nil
+	}
+
+	return false, &Response{ErrorMessage: InvalidParams}
+}
+
+func (s *Service) renderNotes(list []notes.Note) ([]RenderedNote, error) {
+	rendered := make([]RenderedNote, 0, len(list))
+	for _, note := range list {
+		doc, err := s.renderNote(&note)
+		if err != nil {
+			return nil, err
+		}
+
+		rendered = append(rendered, RenderedNote{Note: note, BodyHTML: doc.HTML, TOC: doc.TOC})
+	}
+
+	return rendered, nil
+}
+
+// renderNote renders the body of the note. Results are cached per note
+// version, so a body is rendered once until the note changes.
+func (s *Service) renderNote(note *notes.Note) (*markdown.Document, error) {
+	key := renderKey{id: note.Id, version: note.Version}
+	if doc, ok := s.renderCache.get(key); ok {
+		return doc, nil
+	}
+
+	doc, err := markdown.Render(note.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.renderCache.put(key, doc)
+
+	return doc, nil
+}
+
+type renderKey struct {
+	id      int
+	version int
+}
+
+type renderEntry struct {
+	key renderKey
+	doc *markdown.Document
+}
+
+// renderCache is a least recently used cache of rendered note bodies.
+type renderCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[renderKey]*list.Element
+}
+
+func newRenderCache(capacity int) *renderCache {
+	return &renderCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[renderKey]*list.Element),
+	}
+}
+
+func (r *renderCache) get(key renderKey) (*markdown.Document, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+
+	return element.Value.(*renderEntry).doc, true
+}
+
+func (r *renderCache) put(key renderKey, doc *markdown.Document) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[key]; ok {
+		element.Value.(*renderEntry).doc = doc
+		r.order.MoveToFront(element)
+		return
+	}
+
+	r.entries[key] = r.order.PushFront(&renderEntry{key: key, doc: doc})
+	if r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*renderEntry).key)
+	}
+}
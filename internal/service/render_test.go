@@ -0,0 +1,125 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRenderNote_Success(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Version: 2, Body: "# Title\n\ntext"}, nil).Once()
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Version: 2, Body: "changed"}, nil).Once()
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	for i := 0; i < 2; i++ {
+		c, rec := newEchoContext(http.MethodGet, "/api/note/1/render", nil)
+		c.SetPath("/api/note/:id/render")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		setUser(c, "user@test.com")
+
+		// Act
+		err := s.RenderNote(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"1-2"`, rec.Header().Get("ETag"))
+
+		var response struct {
+			Object service.RenderResponse `json:"object"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		// The second body has the same version, so the cached rendering is returned.
+		assert.Equal(t, "<h1 id=\"title\">Title</h1>\n<p>text</p>\n", response.Object.HTML)
+		assert.Len(t, response.Object.TOC, 1)
+	}
+}
+
+func TestRenderNote_ForeignNote(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/render", nil)
+	c.SetPath("/api/note/:id/render")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 2}, nil)
+	mockNotes.On("GetNoteShare", 1, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.RenderNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetUserNotes_FormatHTML(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes?format=html", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetUserNotes", 1, mock.Anything).
+		Return(&[]notes.Note{{Id: 1, Body: "**bold** <script>x</script>"}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetUserNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Object []service.RenderedNote `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Object, 1)
+	assert.Equal(t, "**bold** <script>x</script>", response.Object[0].Body)
+	assert.Equal(t, "<p><strong>bold</strong> x</p>\n", response.Object[0].BodyHTML)
+}
+
+func TestGetNote_InvalidFormat(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1?format=pdf", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
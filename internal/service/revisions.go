@@ -0,0 +1,179 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/pkg/diff"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RevisionsDiff struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Lines []diff.Line `json:"lines"`
+}
+
+// localhost:8000/api/note/:id/revisions
+func (s *Service) GetNoteRevisions(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleEditor); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	revisions, err := notesRepository.GetNoteRevisions(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *revisions {
+		(*revisions)[i].CreatedAt = (*revisions)[i].CreatedAt.In(loc)
+	}
+
+	s.logger.Infof("Revisions of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: revisions})
+}
+
+// localhost:8000/api/note/:id/revisions/diff?from=1&to=2
+//
+// Both revisions are optional: "to" defaults to the latest revision and
+// "from" to the one preceding "to".
+func (s *Service) DiffNoteRevisions(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleEditor); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	to := 0
+	if c.QueryParam("to") != "" {
+		to, err = strconv.Atoi(c.QueryParam("to"))
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	} else {
+		revisions, err := notesRepository.GetNoteRevisions(id)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+		if len(*revisions) == 0 {
+			return c.JSON(s.NewError(NotFound))
+		}
+		to = (*revisions)[0].Revision
+	}
+
+	from := to - 1
+	if c.QueryParam("from") != "" {
+		from, err = strconv.Atoi(c.QueryParam("from"))
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InvalidParams))
+		}
+	}
+
+	fromBody := ""
+	if from > 0 {
+		fromRevision, err := s.getNoteRevision(id, from)
+		if err != nil {
+			return s.ErrorResponse(c, err)
+		}
+		fromBody = fromRevision.Body
+	}
+
+	toRevision, err := s.getNoteRevision(id, to)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	s.logger.Infof("Diff of note with id %d between revisions %d and %d was given", id, from, to)
+	return c.JSON(http.StatusOK, Response{Object: RevisionsDiff{
+		From:  from,
+		To:    to,
+		Lines: diff.Lines(fromBody, toRevision.Body),
+	}})
+}
+
+// localhost:8000/api/note/:id/revisions/:rev/restore
+func (s *Service) RestoreNoteRevision(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleEditor); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	revision, err := s.getNoteRevision(id, rev)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	version, err := s.checkIfMatch(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.UpdateNote(
+		id,
+		notes.NoteUpdate{Title: &revision.Title, Body: &revision.Body},
+		version)
+	if err != nil {
+		return s.noteWriteError(c, err)
+	}
+	s.pruneNoteRevisions(id)
+
+	s.logger.Infof("Note with id %d was restored to revision %d", id, rev)
+	return c.String(http.StatusOK, "OK")
+}
+
+func (s *Service) getNoteRevision(noteId, rev int) (*notes.Revision, error) {
+	revision, err := s.notesRepository.GetNoteRevision(noteId, rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &Response{ErrorMessage: NotFound}
+	}
+
+	return revision, err
+}
+
+// pruneNoteRevisions applies the configured retention policy. Failures are
+// only logged: the update itself has already been stored.
+func (s *Service) pruneNoteRevisions(noteId int) {
+	if s.revisionsKeepLast <= 0 && s.revisionsKeepDays <= 0 {
+		return
+	}
+
+	err := s.notesRepository.PruneNoteRevisions(noteId, s.revisionsKeepLast, s.revisionsKeepDays)
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
@@ -1,17 +1,45 @@
 package service
 
 import (
+	"NotesService/internal/attachments"
+	"NotesService/internal/collab"
+	"NotesService/internal/comments"
+	"NotesService/internal/events"
+	"NotesService/internal/idempotency"
 	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"NotesService/internal/publiclinks"
+	"NotesService/internal/reminders"
+	"NotesService/internal/templates"
 	"NotesService/internal/users"
+	"NotesService/internal/workspaces"
+	"NotesService/pkg/blob"
+	"NotesService/pkg/notify"
+	"errors"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 const (
-	InvalidParams       = "invalid params"
-	InvalidCredentials  = "invalid credentials"
-	InternalServerError = "internal error"
-	UserAlreadyExists   = "user already exists"
+	InvalidParams        = "invalid params"
+	InvalidCredentials   = "invalid credentials"
+	InternalServerError  = "internal error"
+	UserAlreadyExists    = "user already exists"
+	NotFound             = "not found"
+	PreconditionFailed   = "precondition failed"
+	PreconditionRequired = "precondition required"
+	UnsupportedMediaType = "unsupported media type"
+	InvalidPatch         = "invalid patch"
+	Conflict             = "conflict"
+	TooManyOperations    = "too many operations"
+	IdempotencyKeyReused = "idempotency key reused"
+	RequestInProgress    = "request in progress"
+	Forbidden            = "forbidden"
+	Unauthorized         = "unauthorized"
+	Gone                 = "gone"
+	FileTooLarge         = "file too large"
+	RequestTooLarge      = "request too large"
 )
 
 type Service struct {
@@ -19,16 +47,206 @@ type Service struct {
 
 	usersRepository users.UsersRepository
 	notesRepository notes.NotesRepository
+
+	templatesRepository     templates.TemplatesRepository
+	remindersRepository     reminders.RemindersRepository
+	idempotencyRepository   idempotency.IdempotencyRepository
+	idempotencyTTL          time.Duration
+	idempotencyMaxBody      int64
+	publicLinksRepository   publiclinks.PublicLinksRepository
+	workspacesRepository    workspaces.WorkspacesRepository
+	commentsRepository      comments.CommentsRepository
+	notificationsRepository notifications.NotificationsRepository
+	collabRepository        collab.CollabRepository
+	collabBroker            collab.Broker
+	collabHub               *collabHub
+	collabRoleTTL           time.Duration
+	eventsRepository        events.EventsRepository
+	eventsHub               *eventsHub
+	eventsHeartbeat         time.Duration
+	attachmentsRepository   attachments.AttachmentsRepository
+	blobStore               blob.Store
+	attachmentMaxSize       int64
+	thumbnailSize           int
+	thumbnailsWake          chan struct{}
+
+	revisionsKeepLast int
+	revisionsKeepDays int
+	requireIfMatch    bool
+	bulkLimit         int
+
+	renderCache *renderCache
+	notifier    notify.Notifier
+}
+
+type Option func(*Service)
+
+// WithRevisionRetention limits stored note revisions to the last keepLast
+// revisions and to those younger than keepDays. Zero disables a limit.
+func WithRevisionRetention(keepLast, keepDays int) Option {
+	return func(s *Service) {
+		s.revisionsKeepLast = keepLast
+		s.revisionsKeepDays = keepDays
+	}
+}
+
+// WithRequireIfMatch makes If-Match mandatory for note updates and deletions.
+func WithRequireIfMatch(require bool) Option {
+	return func(s *Service) {
+		s.requireIfMatch = require
+	}
+}
+
+// WithBulkLimit bounds the number of operations in a bulk request.
+func WithBulkLimit(limit int) Option {
+	return func(s *Service) {
+		if limit > 0 {
+			s.bulkLimit = limit
+		}
+	}
+}
+
+// WithTemplates sets the repository of note templates.
+func WithTemplates(repository templates.TemplatesRepository) Option {
+	return func(s *Service) {
+		s.templatesRepository = repository
+	}
+}
+
+// WithReminders sets the repository of reminders and the notifier due
+// reminders are delivered through. Without a notifier they are only logged.
+func WithReminders(repository reminders.RemindersRepository, notifier notify.Notifier) Option {
+	return func(s *Service) {
+		s.remindersRepository = repository
+		if notifier != nil {
+			s.notifier = notifier
+		}
+	}
+}
+
+// WithIdempotency enables the Idempotency-Key header on mutating requests.
+// Keys and their responses are kept for ttl, a day if it is zero. Bodies of
+// such requests are limited to maxBody bytes, DefaultIdempotencyMaxBody if
+// it is zero.
+func WithIdempotency(repository idempotency.IdempotencyRepository, ttl time.Duration, maxBody int64) Option {
+	return func(s *Service) {
+		s.idempotencyRepository = repository
+		s.idempotencyTTL = DefaultIdempotencyTTL
+		if ttl > 0 {
+			s.idempotencyTTL = ttl
+		}
+		s.idempotencyMaxBody = DefaultIdempotencyMaxBody
+		if maxBody > 0 {
+			s.idempotencyMaxBody = maxBody
+		}
+	}
+}
+
+// WithPublicLinks sets the repository of public note links.
+func WithPublicLinks(repository publiclinks.PublicLinksRepository) Option {
+	return func(s *Service) {
+		s.publicLinksRepository = repository
+	}
+}
+
+// WithWorkspaces sets the repository of workspaces.
+func WithWorkspaces(repository workspaces.WorkspacesRepository) Option {
+	return func(s *Service) {
+		s.workspacesRepository = repository
+	}
+}
+
+// WithComments sets the repository of note comments.
+func WithComments(repository comments.CommentsRepository) Option {
+	return func(s *Service) {
+		s.commentsRepository = repository
+	}
+}
+
+// WithNotifications sets the repository of the notification inbox. Without
+// it users are not notified of mentions, shares and comments.
+func WithNotifications(repository notifications.NotificationsRepository) Option {
+	return func(s *Service) {
+		s.notificationsRepository = repository
+	}
+}
+
+// WithCollab enables collaborative editing of notes. Operations are stored
+// in repository and the instances of the service learn about them through
+// broker.
+func WithCollab(repository collab.CollabRepository, broker collab.Broker) Option {
+	return func(s *Service) {
+		s.collabRepository = repository
+		s.collabBroker = broker
+		s.collabHub = newCollabHub()
+	}
+}
+
+// WithCollabRoleTTL sets how long the role of a collaborator is trusted
+// before it is looked up again, DefaultCollabRoleTTL if it is zero.
+func WithCollabRoleTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.collabRoleTTL = ttl
+		}
+	}
+}
+
+// WithEvents enables the event stream of note changes. Idle streams send a
+// heartbeat every heartbeat, DefaultEventsHeartbeat if it is zero.
+func WithEvents(repository events.EventsRepository, heartbeat time.Duration) Option {
+	return func(s *Service) {
+		s.eventsRepository = repository
+		s.eventsHub = newEventsHub()
+		s.eventsHeartbeat = DefaultEventsHeartbeat
+		if heartbeat > 0 {
+			s.eventsHeartbeat = heartbeat
+		}
+	}
+}
+
+// WithAttachments enables note attachments, stored in store. Uploads are
+// limited to maxSize bytes, DefaultAttachmentMaxSize if it is zero.
+func WithAttachments(repository attachments.AttachmentsRepository, store blob.Store, maxSize int64) Option {
+	return func(s *Service) {
+		s.attachmentsRepository = repository
+		s.blobStore = store
+		s.attachmentMaxSize = DefaultAttachmentMaxSize
+		if maxSize > 0 {
+			s.attachmentMaxSize = maxSize
+		}
+		s.thumbnailsWake = make(chan struct{}, 1)
+	}
+}
+
+// WithThumbnailSize bounds the width and height of the thumbnails of image
+// attachments.
+func WithThumbnailSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.thumbnailSize = size
+		}
+	}
 }
 
 func NewService(
 	logger echo.Logger,
 	notesRepository notes.NotesRepository,
-	usersRepository users.UsersRepository) *Service {
+	usersRepository users.UsersRepository,
+	options ...Option) *Service {
 	svc := &Service{
 		logger:          logger,
 		usersRepository: usersRepository,
 		notesRepository: notesRepository,
+		bulkLimit:       DefaultBulkLimit,
+		thumbnailSize:   DefaultThumbnailSize,
+		collabRoleTTL:   DefaultCollabRoleTTL,
+		renderCache:     newRenderCache(DefaultRenderCacheSize),
+		notifier:        notify.NewLogNotifier(logger),
+	}
+
+	for _, option := range options {
+		option(svc)
 	}
 
 	return svc
@@ -45,8 +263,46 @@ func (r *Response) Error() string {
 
 func (s *Service) NewError(err string) (int, *Response) {
 	statusCode := 400
-	if err == InternalServerError {
+	switch err {
+	case InternalServerError:
 		statusCode = 500
+	case Unauthorized:
+		statusCode = 401
+	case Forbidden:
+		statusCode = 403
+	case NotFound:
+		statusCode = 404
+	case PreconditionFailed:
+		statusCode = 412
+	case PreconditionRequired:
+		statusCode = 428
+	case UnsupportedMediaType:
+		statusCode = 415
+	case InvalidPatch:
+		statusCode = 422
+	case Conflict:
+		statusCode = 409
+	case TooManyOperations, FileTooLarge, RequestTooLarge:
+		statusCode = 413
+	case IdempotencyKeyReused:
+		statusCode = 422
+	case RequestInProgress:
+		statusCode = 409
+	case Gone:
+		statusCode = 410
 	}
 	return statusCode, &Response{ErrorMessage: err}
 }
+
+// ErrorResponse writes the response for an error returned by a service helper.
+// Errors that are not a *Response are reported as internal errors.
+func (s *Service) ErrorResponse(c echo.Context, err error) error {
+	s.logger.Error(err)
+
+	var resp *Response
+	if errors.As(err, &resp) {
+		return c.JSON(s.NewError(resp.ErrorMessage))
+	}
+
+	return c.JSON(s.NewError(InternalServerError))
+}
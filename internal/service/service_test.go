@@ -1,16 +1,29 @@
 package service_test
 
 import (
+	"NotesService/internal/attachments"
+	"NotesService/internal/comments"
+	"NotesService/internal/events"
+	"NotesService/internal/idempotency"
 	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"NotesService/internal/publiclinks"
+	"NotesService/internal/reminders"
 	"NotesService/internal/service"
+	"NotesService/internal/templates"
 	"NotesService/internal/users"
+	"NotesService/internal/workspaces"
+	"NotesService/pkg/diff"
 	"NotesService/pkg/logs"
+	"NotesService/pkg/notify"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
@@ -26,22 +39,113 @@ func (m *MockNotesRepository) GetNote(id int) (*notes.Note, error) {
 	args := m.Called(id)
 	return args.Get(0).(*notes.Note), args.Error(1)
 }
-func (m *MockNotesRepository) GetUserNotes(userId int) (*[]notes.Note, error) {
-	args := m.Called(userId)
+func (m *MockNotesRepository) GetUserNotes(userId int, filter notes.NotesFilter) (*[]notes.Note, error) {
+	args := m.Called(userId, filter)
 	return args.Get(0).(*[]notes.Note), args.Error(1)
 }
-func (m *MockNotesRepository) CreateNote(userId int, title, body string) error {
+func (m *MockNotesRepository) CreateNote(userId int, title, body string) (int, error) {
 	args := m.Called(userId, title, body)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockNotesRepository) UpdateNote(id int, update notes.NoteUpdate, version int) error {
+	args := m.Called(id, update, version)
 	return args.Error(0)
 }
-func (m *MockNotesRepository) UpdateNote(id int, title, body string) error {
-	args := m.Called(id, title, body)
+func (m *MockNotesRepository) DeleteNote(id int, version int) error {
+	args := m.Called(id, version)
 	return args.Error(0)
 }
-func (m *MockNotesRepository) DeleteNote(id int) error {
-	args := m.Called(id)
+func (m *MockNotesRepository) GetNoteRevisions(noteId int) (*[]notes.Revision, error) {
+	args := m.Called(noteId)
+	return args.Get(0).(*[]notes.Revision), args.Error(1)
+}
+func (m *MockNotesRepository) GetNoteRevision(noteId, revision int) (*notes.Revision, error) {
+	args := m.Called(noteId, revision)
+	return args.Get(0).(*notes.Revision), args.Error(1)
+}
+func (m *MockNotesRepository) PruneNoteRevisions(noteId, keepLast, keepDays int) error {
+	args := m.Called(noteId, keepLast, keepDays)
+	return args.Error(0)
+}
+func (m *MockNotesRepository) GetTrashedNotes(userId, workspaceId int) (*[]notes.Note, error) {
+	args := m.Called(userId, workspaceId)
+	return args.Get(0).(*[]notes.Note), args.Error(1)
+}
+func (m *MockNotesRepository) RestoreNote(userId, id int) error {
+	args := m.Called(userId, id)
+	return args.Error(0)
+}
+func (m *MockNotesRepository) EmptyTrash(userId, workspaceId int) (int64, error) {
+	args := m.Called(userId, workspaceId)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockNotesRepository) PurgeDeletedNotes(retentionDays int) (int64, error) {
+	args := m.Called(retentionDays)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockNotesRepository) ExecuteBulk(userId, workspaceId int, operations []notes.BulkOperation, atomic bool, authorize func(note *notes.Note, role string) error) ([]notes.BulkResult, error) {
+	args := m.Called(userId, workspaceId, operations, atomic, authorize)
+	return args.Get(0).([]notes.BulkResult), args.Error(1)
+}
+func (m *MockNotesRepository) GetBacklinks(noteId, userId int) (*[]notes.Note, error) {
+	args := m.Called(noteId, userId)
+	return args.Get(0).(*[]notes.Note), args.Error(1)
+}
+func (m *MockNotesRepository) GetDanglingLinks(userId, workspaceId int) (*[]notes.DanglingLink, error) {
+	args := m.Called(userId, workspaceId)
+	return args.Get(0).(*[]notes.DanglingLink), args.Error(1)
+}
+func (m *MockNotesRepository) GetNoteGraph(userId, workspaceId int) (*notes.Graph, error) {
+	args := m.Called(userId, workspaceId)
+	return args.Get(0).(*notes.Graph), args.Error(1)
+}
+func (m *MockNotesRepository) GetOrCreateDailyNote(userId int, date, title, body string) (*notes.Note, bool, error) {
+	args := m.Called(userId, date, title, body)
+	return args.Get(0).(*notes.Note), args.Bool(1), args.Error(2)
+}
+func (m *MockNotesRepository) GetDailyNotes(userId int, from, to string) (*[]notes.Note, error) {
+	args := m.Called(userId, from, to)
+	return args.Get(0).(*[]notes.Note), args.Error(1)
+}
+func (m *MockNotesRepository) GetNoteShares(noteId int) (*[]notes.Share, error) {
+	args := m.Called(noteId)
+	return args.Get(0).(*[]notes.Share), args.Error(1)
+}
+func (m *MockNotesRepository) GetNoteShare(noteId, userId int) (*notes.Share, error) {
+	args := m.Called(noteId, userId)
+	return args.Get(0).(*notes.Share), args.Error(1)
+}
+func (m *MockNotesRepository) ShareNote(noteId, userId int, role string) error {
+	args := m.Called(noteId, userId, role)
 	return args.Error(0)
 }
+func (m *MockNotesRepository) UnshareNote(noteId, userId int) error {
+	args := m.Called(noteId, userId)
+	return args.Error(0)
+}
+func (m *MockNotesRepository) GetSharedNotes(userId int) (*[]notes.SharedNote, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]notes.SharedNote), args.Error(1)
+}
+func (m *MockNotesRepository) CreateWorkspaceNote(userId, workspaceId int, title, body string) (int, error) {
+	args := m.Called(userId, workspaceId, title, body)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockNotesRepository) MoveNoteToWorkspace(id, workspaceId int) error {
+	args := m.Called(id, workspaceId)
+	return args.Error(0)
+}
+func (m *MockNotesRepository) GetNoteChanges(userid, workspaceId int, since, xmin int64, limit int) (*[]notes.Change, int64, error) {
+	args := m.Called(userid, workspaceId, since, xmin, limit)
+	return args.Get(0).(*[]notes.Change), args.Get(1).(int64), args.Error(2)
+}
+func (m *MockNotesRepository) GetOrCreateClientNote(
+	userid int,
+	workspaceId *int,
+	clientId, title, body string) (*notes.Note, bool, error) {
+	args := m.Called(userid, workspaceId, clientId, title, body)
+	return args.Get(0).(*notes.Note), args.Bool(1), args.Error(2)
+}
 
 type MockUsersRepository struct {
 	mock.Mock
@@ -78,16 +182,439 @@ func (m *MockUsersRepository) DeleteUser(id int) error {
 	return args.Error(0)
 }
 
+func (m *MockUsersRepository) UpdateUserTimeZone(id int, timeZone string) error {
+	args := m.Called(id, timeZone)
+	return args.Error(0)
+}
+
+func (m *MockUsersRepository) UpdateUserDailyTemplate(id int, templateId *int) error {
+	args := m.Called(id, templateId)
+	return args.Error(0)
+}
+
+func (m *MockUsersRepository) GetUserByCalendarToken(tokenHash string) (*users.User, error) {
+	args := m.Called(tokenHash)
+	if user, ok := args.Get(0).(*users.User); ok {
+		return user, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUsersRepository) UpdateUserCalendarToken(id int, tokenHash *string) error {
+	args := m.Called(id, tokenHash)
+	return args.Error(0)
+}
+
+type MockTemplatesRepository struct {
+	mock.Mock
+}
+
+func (m *MockTemplatesRepository) GetTemplate(id int) (*templates.Template, error) {
+	args := m.Called(id)
+	if template, ok := args.Get(0).(*templates.Template); ok {
+		return template, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+func (m *MockTemplatesRepository) GetUserTemplates(userId int) (*[]templates.Template, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]templates.Template), args.Error(1)
+}
+func (m *MockTemplatesRepository) CreateTemplate(userId int, name, title, body string) (int, error) {
+	args := m.Called(userId, name, title, body)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockTemplatesRepository) UpdateTemplate(id int, name, title, body string) error {
+	args := m.Called(id, name, title, body)
+	return args.Error(0)
+}
+func (m *MockTemplatesRepository) DeleteTemplate(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockRemindersRepository struct {
+	mock.Mock
+}
+
+func (m *MockRemindersRepository) GetReminder(id int) (*reminders.Reminder, error) {
+	args := m.Called(id)
+	if reminder, ok := args.Get(0).(*reminders.Reminder); ok {
+		return reminder, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+func (m *MockRemindersRepository) GetNoteReminders(noteId int) (*[]reminders.Reminder, error) {
+	args := m.Called(noteId)
+	return args.Get(0).(*[]reminders.Reminder), args.Error(1)
+}
+func (m *MockRemindersRepository) GetUserReminders(userId int) (*[]reminders.Reminder, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]reminders.Reminder), args.Error(1)
+}
+func (m *MockRemindersRepository) GetCalendarReminders(userId int) (*[]reminders.NoteReminder, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]reminders.NoteReminder), args.Error(1)
+}
+func (m *MockRemindersRepository) CreateReminder(reminder reminders.Reminder) (int, error) {
+	args := m.Called(reminder)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockRemindersRepository) DeleteReminder(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *MockRemindersRepository) ClaimDueReminder(lease time.Duration) (*reminders.Due, error) {
+	args := m.Called(lease)
+	return args.Get(0).(*reminders.Due), args.Error(1)
+}
+func (m *MockRemindersRepository) GetDeliveries(reminderId int, dueAt time.Time) ([]string, error) {
+	args := m.Called(reminderId, dueAt)
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *MockRemindersRepository) AddDelivery(reminderId int, dueAt time.Time, channel string) error {
+	args := m.Called(reminderId, dueAt, channel)
+	return args.Error(0)
+}
+func (m *MockRemindersRepository) FinishReminder(reminder reminders.Reminder, delivered bool) error {
+	args := m.Called(reminder, delivered)
+	return args.Error(0)
+}
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) Notify(ctx context.Context, message notify.Message) error {
+	args := m.Called(message)
+	return args.Error(0)
+}
+
+type MockIdempotencyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepository) ReserveKey(
+	userId int,
+	key, fingerprint string,
+	ttl time.Duration) (*idempotency.Key, bool, error) {
+	args := m.Called(userId, key, fingerprint, ttl)
+	if stored, ok := args.Get(0).(*idempotency.Key); ok {
+		return stored, args.Bool(1), args.Error(2)
+	}
+	return nil, args.Bool(1), args.Error(2)
+}
+
+func (m *MockIdempotencyRepository) SaveResponse(
+	userId int,
+	key string,
+	statusCode int,
+	contentType string,
+	response []byte) error {
+	args := m.Called(userId, key, statusCode, contentType, response)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) ReleaseKey(userId int, key string) error {
+	args := m.Called(userId, key)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteExpiredKeys(ttl time.Duration) (int64, error) {
+	args := m.Called(ttl)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockPublicLinksRepository struct {
+	mock.Mock
+}
+
+func (m *MockPublicLinksRepository) GetLink(id int) (*publiclinks.Link, error) {
+	args := m.Called(id)
+	if link, ok := args.Get(0).(*publiclinks.Link); ok {
+		return link, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockPublicLinksRepository) GetLinkByToken(tokenHash string) (*publiclinks.Link, error) {
+	args := m.Called(tokenHash)
+	if link, ok := args.Get(0).(*publiclinks.Link); ok {
+		return link, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockPublicLinksRepository) GetNoteLinks(noteId int) (*[]publiclinks.Link, error) {
+	args := m.Called(noteId)
+	return args.Get(0).(*[]publiclinks.Link), args.Error(1)
+}
+
+func (m *MockPublicLinksRepository) CreateLink(link publiclinks.Link) (int, error) {
+	args := m.Called(link)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockPublicLinksRepository) RevokeLink(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockPublicLinksRepository) RecordView(id int) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockCommentsRepository struct {
+	mock.Mock
+}
+
+func (m *MockCommentsRepository) GetComment(id int) (*comments.Comment, error) {
+	args := m.Called(id)
+	if comment, ok := args.Get(0).(*comments.Comment); ok {
+		return comment, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockCommentsRepository) GetThreads(noteId int, filter comments.ThreadsFilter) (*[]comments.Thread, int, error) {
+	args := m.Called(noteId, filter)
+	return args.Get(0).(*[]comments.Thread), args.Int(1), args.Error(2)
+}
+
+func (m *MockCommentsRepository) CreateComment(comment comments.Comment) (int, error) {
+	args := m.Called(comment)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockCommentsRepository) UpdateComment(id int, body string) error {
+	args := m.Called(id, body)
+	return args.Error(0)
+}
+
+func (m *MockCommentsRepository) DeleteComment(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockCommentsRepository) ResolveThread(id, userId int, resolved bool) error {
+	args := m.Called(id, userId, resolved)
+	return args.Error(0)
+}
+
+type MockNotificationsRepository struct {
+	mock.Mock
+}
+
+func (m *MockNotificationsRepository) GetNotifications(userId int, filter notifications.Filter) (*[]notifications.Notification, error) {
+	args := m.Called(userId, filter)
+	return args.Get(0).(*[]notifications.Notification), args.Error(1)
+}
+
+func (m *MockNotificationsRepository) CountUnread(userId int) (int, error) {
+	args := m.Called(userId)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockNotificationsRepository) CreateNotification(notification notifications.Notification) (int, error) {
+	args := m.Called(notification)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockNotificationsRepository) MarkRead(id, userId int) error {
+	args := m.Called(id, userId)
+	return args.Error(0)
+}
+
+func (m *MockNotificationsRepository) MarkAllRead(userId int) (int64, error) {
+	args := m.Called(userId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockNotificationsRepository) GetPreferences(userId int) (*[]notifications.Preference, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]notifications.Preference), args.Error(1)
+}
+
+func (m *MockNotificationsRepository) UpdatePreferences(userId int, preferences []notifications.Preference) error {
+	args := m.Called(userId, preferences)
+	return args.Error(0)
+}
+
+type MockWorkspacesRepository struct {
+	mock.Mock
+}
+
+func (m *MockWorkspacesRepository) GetWorkspace(id int) (*workspaces.Workspace, error) {
+	args := m.Called(id)
+	if workspace, ok := args.Get(0).(*workspaces.Workspace); ok {
+		return workspace, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) GetUserWorkspaces(userId int) (*[]workspaces.Workspace, error) {
+	args := m.Called(userId)
+	return args.Get(0).(*[]workspaces.Workspace), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) CreateWorkspace(userId int, name string) (int, error) {
+	args := m.Called(userId, name)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) DeleteWorkspace(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockWorkspacesRepository) GetMember(workspaceId, userId int) (*workspaces.Member, error) {
+	args := m.Called(workspaceId, userId)
+	if member, ok := args.Get(0).(*workspaces.Member); ok {
+		return member, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) GetMembers(workspaceId int) (*[]workspaces.Member, error) {
+	args := m.Called(workspaceId)
+	return args.Get(0).(*[]workspaces.Member), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) UpdateMemberRole(workspaceId, userId int, role string) error {
+	args := m.Called(workspaceId, userId, role)
+	return args.Error(0)
+}
+
+func (m *MockWorkspacesRepository) RemoveMember(workspaceId, userId int) error {
+	args := m.Called(workspaceId, userId)
+	return args.Error(0)
+}
+
+func (m *MockWorkspacesRepository) GetInvitation(id int) (*workspaces.Invitation, error) {
+	args := m.Called(id)
+	if invitation, ok := args.Get(0).(*workspaces.Invitation); ok {
+		return invitation, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) GetWorkspaceInvitations(workspaceId int) (*[]workspaces.Invitation, error) {
+	args := m.Called(workspaceId)
+	return args.Get(0).(*[]workspaces.Invitation), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) GetUserInvitations(email string) (*[]workspaces.Invitation, error) {
+	args := m.Called(email)
+	return args.Get(0).(*[]workspaces.Invitation), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) CreateInvitation(workspaceId, invitedBy int, email, role string) (int, error) {
+	args := m.Called(workspaceId, invitedBy, email, role)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWorkspacesRepository) RespondToInvitation(id, userId int, accept bool) error {
+	args := m.Called(id, userId, accept)
+	return args.Error(0)
+}
+
+type MockEventsRepository struct {
+	mock.Mock
+}
+
+func (m *MockEventsRepository) GetEvents(userId int, after, xmin int64, limit int) (*[]events.Event, int64, error) {
+	args := m.Called(userId, after, xmin, limit)
+	return args.Get(0).(*[]events.Event), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockEventsRepository) GetFirstEventId() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEventsRepository) GetLastEventId() (int64, int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockEventsRepository) DeleteEventsBefore(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEventsRepository) Listen(ctx context.Context, wake func()) error {
+	args := m.Called(ctx, wake)
+	return args.Error(0)
+}
+
+type MockAttachmentsRepository struct {
+	mock.Mock
+}
+
+func (m *MockAttachmentsRepository) GetAttachment(id int) (*attachments.Attachment, error) {
+	args := m.Called(id)
+	return args.Get(0).(*attachments.Attachment), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) GetNoteAttachments(noteId int) (*[]attachments.Attachment, error) {
+	args := m.Called(noteId)
+	return args.Get(0).(*[]attachments.Attachment), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) UseBlob(sha256 string) (bool, error) {
+	args := m.Called(sha256)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) CreateAttachment(attachment attachments.Attachment) (int, error) {
+	args := m.Called(attachment)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) DeleteAttachment(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockAttachmentsRepository) DeleteOrphanBlobs(unusedFor time.Duration, deleteBlob func(sha256 string) error) (int, error) {
+	args := m.Called(unusedFor, deleteBlob)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) GenerateThumbnails(limit int, generate func(attachments.Image) (*attachments.Thumbnail, error)) (int, error) {
+	args := m.Called(limit, generate)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) GetPendingLocations(limit int) ([]attachments.Image, error) {
+	args := m.Called(limit)
+	images, _ := args.Get(0).([]attachments.Image)
+	return images, args.Error(1)
+}
+
+func (m *MockAttachmentsRepository) AddStrippedBlob(sha256 string, stripped attachments.Blob) error {
+	args := m.Called(sha256, stripped)
+	return args.Error(0)
+}
+
+func (m *MockAttachmentsRepository) FinishStripLocation(sha256 string, stripped *attachments.Blob) error {
+	args := m.Called(sha256, stripped)
+	return args.Error(0)
+}
+
 func TestGetNote_Success(t *testing.T) {
 	//Arrange
 	c, rec := newEchoContext(http.MethodGet, "/api/note/1", nil)
 	c.SetPath("/api/note/:id")
 	c.SetParamNames("id")
 	c.SetParamValues("1")
+	setUser(c, "user@test.com")
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
-	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, Title: "test", Body: "body"}, nil)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "test", Body: "body"}, nil)
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
 
 	//Act
@@ -104,9 +631,11 @@ func TestGetNote_NotFound(t *testing.T) {
 	c.SetPath("/api/note/:id")
 	c.SetParamNames("id")
 	c.SetParamValues("-1")
+	setUser(c, "user@test.com")
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
 
 	mockNotes.On("GetNote", -1).Return((*notes.Note)(nil), errors.New(service.InvalidParams))
 
@@ -133,7 +662,7 @@ func TestGetUserNotes_Success(t *testing.T) {
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
 	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1, Email: "user@test.com"}, nil)
-	mockNotes.On("GetUserNotes", 1).Return(&[]notes.Note{{Id: 1, Title: "t", Body: "b"}}, nil)
+	mockNotes.On("GetUserNotes", 1, notes.NotesFilter{}).Return(&[]notes.Note{{Id: 1, Title: "t", Body: "b"}}, nil)
 
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
 
@@ -152,11 +681,14 @@ func TestUpdateNote_Success(t *testing.T) {
 	c.SetPath("/note/:id")
 	c.SetParamNames("id")
 	c.SetParamValues("5")
+	setUser(c, "user@test.com")
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1}, nil)
 
-	mockNotes.On("UpdateNote", 5, "Updated", "Changed").Return(nil)
+	mockNotes.On("UpdateNote", 5, noteUpdate("Updated", "Changed"), 0).Return(nil)
 
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
 
@@ -199,11 +731,14 @@ func TestUpdateNote_RepoError(t *testing.T) {
 	c.SetPath("/note/:id")
 	c.SetParamNames("id")
 	c.SetParamValues("5")
+	setUser(c, "user@test.com")
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1}, nil)
 
-	mockNotes.On("UpdateNote", 5, "T", "B").
+	mockNotes.On("UpdateNote", 5, noteUpdate("T", "B"), 0).
 		Return(errors.New("db error"))
 
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
@@ -222,11 +757,14 @@ func TestDeleteNote_Success(t *testing.T) {
 	c.SetPath("/note/:id")
 	c.SetParamNames("id")
 	c.SetParamValues("10")
+	setUser(c, "user@test.com")
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 10).Return(&notes.Note{Id: 10, UserId: 1}, nil)
 
-	mockNotes.On("DeleteNote", 10).Return(nil)
+	mockNotes.On("DeleteNote", 10, 0).Return(nil)
 
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
 
@@ -241,19 +779,153 @@ func TestDeleteNote_Success(t *testing.T) {
 	mockNotes.AssertExpectations(t)
 }
 
+func TestGetNote_NotModified(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1", nil)
+	c.Request().Header.Set("If-None-Match", `W/"1-3"`)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Version: 3}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, `"1-3"`, rec.Header().Get("ETag"))
+}
+
+func TestUpdateNote_IfMatch(t *testing.T) {
+	// Arrange
+	body := []byte(`{"title":"T","body":"B"}`)
+	c, rec := newEchoContext(http.MethodPut, "/note/5", body)
+	c.Request().Header.Set("If-Match", `"5-2"`)
+	c.SetPath("/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1, Version: 2}, nil)
+	mockNotes.On("UpdateNote", 5, noteUpdate("T", "B"), 2).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestUpdateNote_PreconditionFailed(t *testing.T) {
+	// Arrange
+	body := []byte(`{"title":"T","body":"B"}`)
+	c, rec := newEchoContext(http.MethodPut, "/note/5", body)
+	c.Request().Header.Set("If-Match", `"5-1"`)
+	c.SetPath("/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1, Version: 2}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", 5, mock.Anything, mock.Anything)
+}
+
+func TestUpdateNote_ConcurrentChange(t *testing.T) {
+	// Arrange
+	body := []byte(`{"title":"T","body":"B"}`)
+	c, rec := newEchoContext(http.MethodPut, "/note/5", body)
+	c.Request().Header.Set("If-Match", `"5-2"`)
+	c.SetPath("/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1, Version: 2}, nil)
+	mockNotes.On("UpdateNote", 5, noteUpdate("T", "B"), 2).Return(notes.ErrVersionMismatch)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
+
+func TestDeleteNote_PreconditionRequired(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/note/10", nil)
+	c.SetPath("/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("10")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 10).Return(&notes.Note{Id: 10, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithRequireIfMatch(true))
+
+	// Act
+	err := s.DeleteNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	mockNotes.AssertNotCalled(t, "DeleteNote", 10, mock.Anything)
+}
+
 func TestGetNote_Integration(t *testing.T) {
 	// Arrange
 	e := echo.New()
 
 	mockNotes := new(MockNotesRepository)
 	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
 
-	expectedNote := &notes.Note{Id: 1, Title: "Test title", Body: "Test body"}
+	expectedNote := &notes.Note{Id: 1, UserId: 1, Title: "Test title", Body: "Test body"}
 	mockNotes.On("GetNote", 1).Return(expectedNote, nil)
 
 	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
 
-	e.GET("/api/note/:id", s.GetNote)
+	e.GET("/api/note/:id", s.GetNote, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			setUser(c, "user@test.com")
+			return next(c)
+		}
+	})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/note/1", nil)
 	rec := httptest.NewRecorder()
@@ -275,6 +947,102 @@ func TestGetNote_Integration(t *testing.T) {
 	mockNotes.AssertExpectations(t)
 }
 
+func TestGetNoteRevisions_ForeignNote(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/revisions", nil)
+	c.SetPath("/api/note/:id/revisions")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 2}, nil)
+	mockNotes.On("GetNoteShare", 1, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetNoteRevisions(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "GetNoteRevisions", 1)
+}
+
+func TestDiffNoteRevisions_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/revisions/diff?from=1&to=2", nil)
+	c.SetPath("/api/note/:id/revisions/diff")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteRevision", 1, 1).Return(&notes.Revision{Revision: 1, Body: "a\nb"}, nil)
+	mockNotes.On("GetNoteRevision", 1, 2).Return(&notes.Revision{Revision: 2, Body: "a\nc"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.DiffNoteRevisions(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Object service.RevisionsDiff `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, []diff.Line{
+		{Op: diff.Equal, Text: "a"},
+		{Op: diff.Delete, Text: "b"},
+		{Op: diff.Insert, Text: "c"},
+	}, resp.Object.Lines)
+}
+
+func TestRestoreNoteRevision_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/revisions/3/restore", nil)
+	c.SetPath("/api/note/:id/revisions/:rev/restore")
+	c.SetParamNames("id", "rev")
+	c.SetParamValues("1", "3")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteRevision", 1, 3).Return(&notes.Revision{Revision: 3, Title: "old", Body: "old body"}, nil)
+	mockNotes.On("UpdateNote", 1, noteUpdate("old", "old body"), 0).Return(nil)
+	mockNotes.On("PruneNoteRevisions", 1, 10, 0).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithRevisionRetention(10, 0))
+
+	// Act
+	err := s.RestoreNoteRevision(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func noteUpdate(title, body string) notes.NoteUpdate {
+	return notes.NoteUpdate{Title: &title, Body: &body}
+}
+
+func setUser(c echo.Context, email string) {
+	claims := jwt.RegisteredClaims{Subject: email}
+	c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+}
+
 func newEchoContext(method, path string, body []byte) (echo.Context, *httptest.ResponseRecorder) {
 	e := echo.New()
 	req := httptest.NewRequest(method, path, bytes.NewReader(body))
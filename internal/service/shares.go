@@ -0,0 +1,175 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/notifications"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ShareRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// localhost:8000/api/note/:id/shares
+func (s *Service) GetNoteShares(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	shares, err := notesRepository.GetNoteShares(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Collaborators of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: shares})
+}
+
+// localhost:8000/api/note/:id/shares
+//
+// Shares the note with the registered user with the given email as viewer
+// or editor. Sharing again changes the role. Only the owner can share.
+func (s *Service) ShareNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request ShareRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.Role != notes.RoleViewer && request.Role != notes.RoleEditor {
+		s.logger.Errorf("Unknown share role %q", request.Role)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleOwner)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	usersRepository := s.usersRepository
+	collaborator, err := usersRepository.GetUserByEmail(request.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Errorf("User %q to share note with id %d with is not registered", request.Email, id)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if collaborator.Id == note.UserId {
+		s.logger.Errorf("Note with id %d cannot be shared with its owner", id)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.ShareNote(id, collaborator.Id, request.Role)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if owner, err := s.getCurrentUser(c); err == nil {
+		s.notifyUser(collaborator, notifications.Notification{
+			Type:    notifications.TypeShare,
+			ActorId: &owner.Id,
+			NoteId:  &note.Id,
+			Text:    fmt.Sprintf("%s shared note %q with you as %s", owner.Email, note.Title, request.Role),
+		})
+	}
+
+	s.logger.Infof("Note with id %d was shared with user %d as %s", id, collaborator.Id, request.Role)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/note/:id/shares/:user
+//
+// The owner can remove any collaborator, collaborators can remove themselves.
+func (s *Service) UnshareNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	userId, err := strconv.Atoi(c.Param("user"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if userId != dbUser.Id {
+		if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+			return s.ErrorResponse(c, err)
+		}
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.UnshareNote(id, userId)
+	if errors.Is(err, notes.ErrShareNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Note with id %d is no longer shared with user %d", id, userId)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/shared
+func (s *Service) GetSharedNotes(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	shared, err := notesRepository.GetSharedNotes(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *shared {
+		(*shared)[i].In(loc)
+	}
+
+	s.logger.Infof("User %d took notes shared with him", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: shared})
+}
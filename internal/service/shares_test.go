@@ -0,0 +1,300 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetNote_SharedViewer(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Title: "Plans"}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestUpdateNote_SharedViewerForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1", []byte(`{"title":"T","body":"B"}`))
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", 1, mock.Anything, mock.Anything)
+}
+
+func TestUpdateNote_SharedEditor(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1", []byte(`{"title":"T","body":"B"}`))
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+	mockNotes.On("UpdateNote", 1, noteUpdate("T", "B"), 0).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestDeleteNote_SharedEditorForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.DeleteNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "DeleteNote", 1, mock.Anything)
+}
+
+func TestDeleteNote_NotShared(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "stranger@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "stranger@test.com").Return(&users.User{Id: 3}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 3).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.DeleteNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "DeleteNote", 1, mock.Anything)
+}
+
+func TestShareNote_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1/shares",
+		[]byte(`{"email":"editor@test.com","role":"editor"}`))
+	c.SetPath("/api/note/:id/shares")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("ShareNote", 1, 2, notes.RoleEditor).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.ShareNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestShareNote_UnknownUser(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1/shares",
+		[]byte(`{"email":"nobody@test.com","role":"viewer"}`))
+	c.SetPath("/api/note/:id/shares")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockUsers.On("GetUserByEmail", "nobody@test.com").Return(nil, sql.ErrNoRows)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.ShareNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "ShareNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShareNote_EditorCannotReshare(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1/shares",
+		[]byte(`{"email":"friend@test.com","role":"viewer"}`))
+	c.SetPath("/api/note/:id/shares")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.ShareNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "ShareNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUnshareNote_LeaveSharedNote(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/note/1/shares/2", nil)
+	c.SetPath("/api/note/:id/shares/:user")
+	c.SetParamNames("id", "user")
+	c.SetParamValues("1", "2")
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("UnshareNote", 1, 2).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UnshareNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestPatchNote_SharedEditorCannotPin(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1", []byte(`{"pinned":true}`))
+	c.Request().Header.Set("Content-Type", service.MIMEMergePatch)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "editor@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "editor@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Tags: []string{}}, nil)
+	mockNotes.On("GetNoteShare", 1, 2).Return(&notes.Share{NoteId: 1, UserId: 2, Role: notes.RoleEditor}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PatchNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", 1, mock.Anything, mock.Anything)
+}
+
+func TestGetSharedNotes_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/shared", nil)
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetSharedNotes", 2).Return(&[]notes.SharedNote{
+		{Note: notes.Note{Id: 1, UserId: 1, Title: "Plans"}, Role: notes.RoleViewer, OwnerEmail: "user@test.com"},
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetSharedNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Object []map[string]any `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Object, 1) {
+		assert.Equal(t, "Plans", response.Object[0]["title"])
+		assert.Equal(t, "viewer", response.Object[0]["role"])
+		assert.Equal(t, "user@test.com", response.Object[0]["owner_email"])
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// localhost:8000/api/note/:id/pin
+func (s *Service) PinNote(c echo.Context) error {
+	return s.setNoteState(c, "pinned", notes.NoteUpdate{Pinned: boolPtr(true)})
+}
+
+// localhost:8000/api/note/:id/pin
+func (s *Service) UnpinNote(c echo.Context) error {
+	return s.setNoteState(c, "unpinned", notes.NoteUpdate{Pinned: boolPtr(false)})
+}
+
+// localhost:8000/api/note/:id/archive
+func (s *Service) ArchiveNote(c echo.Context) error {
+	return s.setNoteState(c, "archived", notes.NoteUpdate{Archived: boolPtr(true)})
+}
+
+// localhost:8000/api/note/:id/archive
+func (s *Service) UnarchiveNote(c echo.Context) error {
+	return s.setNoteState(c, "unarchived", notes.NoteUpdate{Archived: boolPtr(false)})
+}
+
+// localhost:8000/api/note/:id/favorite
+func (s *Service) FavoriteNote(c echo.Context) error {
+	return s.setNoteState(c, "added to favorites", notes.NoteUpdate{Favorite: boolPtr(true)})
+}
+
+// localhost:8000/api/note/:id/favorite
+func (s *Service) UnfavoriteNote(c echo.Context) error {
+	return s.setNoteState(c, "removed from favorites", notes.NoteUpdate{Favorite: boolPtr(false)})
+}
+
+func (s *Service) setNoteState(c echo.Context, state string, update notes.NoteUpdate) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	// Pins, archive and favorites organize the notes of the owner.
+	if _, _, err := s.getSharedNote(c, id, notes.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	version, err := s.checkIfMatch(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.UpdateNote(id, update, version)
+	if err != nil {
+		return s.noteWriteError(c, err)
+	}
+
+	s.logger.Infof("Note with id %d was %s", id, state)
+	return c.String(http.StatusOK, "OK")
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
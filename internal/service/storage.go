@@ -11,3 +11,9 @@ type Note struct {
 	Title  string
 	Body   string
 }
+
+type Template struct {
+	Name  string
+	Title string
+	Body  string
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/users"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	SyncStatusOK       = "ok"
+	SyncStatusCreated  = "created"
+	SyncStatusConflict = "conflict"
+	SyncStatusError    = "error"
+
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+)
+
+// SyncPage lists the notes changed and deleted since a sync token. Token is
+// passed as ?since= to get the following changes.
+type SyncPage struct {
+	Changed []notes.Note `json:"changed"`
+	Deleted []int        `json:"deleted"`
+	Token   string       `json:"token"`
+	HasMore bool         `json:"has_more"`
+}
+
+type SyncRequest struct {
+	Changes []SyncChange `json:"changes"`
+}
+
+// SyncChange is a change made offline. Notes created offline have no Id
+// and are told apart by ClientId. Version is the version of the note the
+// change was made on.
+type SyncChange struct {
+	Id       int     `json:"id"`
+	ClientId string  `json:"client_id"`
+	Version  int     `json:"version"`
+	Title    *string `json:"title"`
+	Body     *string `json:"body"`
+	Deleted  bool    `json:"deleted"`
+}
+
+// SyncResult reports how a change was applied. A change to a note that was
+// also changed on the server is a conflict: an edit is saved as a copy of
+// the note, ConflictId, and a deletion is dropped.
+type SyncResult struct {
+	Index      int    `json:"index"`
+	Id         int    `json:"id,omitempty"`
+	ClientId   string `json:"client_id,omitempty"`
+	Status     string `json:"status"`
+	Version    int    `json:"version,omitempty"`
+	ConflictId int    `json:"conflict_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SyncResponse struct {
+	Results []SyncResult `json:"results"`
+}
+
+// localhost:8000/api/sync
+//
+// Returns the notes of the user, or of the active workspace, changed since
+// the ?since= token, and the ids of those deleted. Without a token all notes
+// are returned.
+func (s *Service) GetSync(c echo.Context) error {
+	since, xmin, limit, err := syncParams(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspace, err := s.getActiveWorkspace(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	workspaceId := 0
+	if workspace != nil {
+		workspaceId = workspace.WorkspaceId
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	changes, current, err := notesRepository.GetNoteChanges(dbUser.Id, workspaceId, since, xmin, limit+1)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	page := SyncPage{Changed: []notes.Note{}, Deleted: []int{}}
+	if len(*changes) > limit {
+		page.HasMore = true
+		*changes = (*changes)[:limit]
+	}
+
+	last := since
+	for _, change := range *changes {
+		// Changes of transactions that were running at xmin may come before
+		// ones already synced, the token never goes back.
+		last = max(last, change.Seq)
+		note := change.Note
+		if note != nil && note.DeletedAt == nil {
+			note.In(loc)
+			page.Changed = append(page.Changed, *note)
+		} else if since > 0 || xmin > 0 {
+			// Notes moved to the trash or out of the synced notes are gone
+			// for the client too.
+			page.Deleted = append(page.Deleted, change.NoteId)
+		}
+	}
+	page.Token = formatCursor(last, current)
+
+	s.logger.Infof("User %d synced %d changes since %d", dbUser.Id, len(*changes), since)
+	return c.JSON(http.StatusOK, Response{Object: page})
+}
+
+// localhost:8000/api/sync
+//
+// Applies the changes made offline. Every change succeeds or fails on its
+// own.
+func (s *Service) PostSync(c echo.Context) error {
+	var request SyncRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if len(request.Changes) == 0 {
+		s.logger.Error("Empty sync request")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if len(request.Changes) > s.bulkLimit {
+		s.logger.Errorf("Sync request with %d changes exceeds the limit", len(request.Changes))
+		return c.JSON(s.NewError(TooManyOperations))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspace, err := s.getActiveWorkspace(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	var workspaceId *int
+	if workspace != nil {
+		workspaceId = &workspace.WorkspaceId
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	response := SyncResponse{Results: make([]SyncResult, len(request.Changes))}
+	conflicts := 0
+	for i, change := range request.Changes {
+		result := SyncResult{Index: i, Id: change.Id, ClientId: change.ClientId}
+		if message := validateSyncChange(change); message != "" {
+			result.Status = SyncStatusError
+			result.Error = message
+		} else if change.Id == 0 {
+			s.createSyncNote(c, dbUser, workspaceId, change.ClientId, *change.Title, *change.Body, &result)
+		} else {
+			s.applySyncChange(c, dbUser, workspaceId, change, loc, &result)
+		}
+
+		if result.Status == SyncStatusConflict {
+			conflicts++
+		}
+		response.Results[i] = result
+	}
+
+	s.logger.Infof("User %d uploaded %d changes with %d conflicts", dbUser.Id, len(request.Changes), conflicts)
+	return c.JSON(http.StatusOK, Response{Object: response})
+}
+
+// applySyncChange applies an offline change to an existing note.
+func (s *Service) applySyncChange(
+	c echo.Context,
+	user *users.User,
+	workspaceId *int,
+	change SyncChange,
+	loc *time.Location,
+	result *SyncResult) {
+	notesRepository := s.notesRepository
+	note, err := notesRepository.GetNote(change.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		if change.Deleted {
+			result.Status = SyncStatusOK
+			return
+		}
+
+		// The note was deleted on the server, the edit is kept as a copy.
+		s.createSyncConflict(c, user, workspaceId, 0, change, loc, result)
+		return
+	}
+	if err != nil {
+		s.syncError(err, result)
+		return
+	}
+
+	role, err := s.noteRole(note, user.Id)
+	if err != nil {
+		s.syncError(err, result)
+		return
+	}
+	if role == "" {
+		result.Status = SyncStatusError
+		result.Error = NotFound
+		return
+	}
+
+	required := notes.RoleEditor
+	if change.Deleted {
+		required = notes.RoleOwner
+	}
+	if noteRoleRanks[role] < noteRoleRanks[required] {
+		result.Status = SyncStatusError
+		result.Error = Forbidden
+		return
+	}
+
+	if change.Deleted {
+		err = notesRepository.DeleteNote(note.Id, change.Version)
+		if errors.Is(err, notes.ErrVersionMismatch) {
+			// The note was changed on the server, it is kept.
+			result.Status = SyncStatusConflict
+			result.Version = note.Version
+			return
+		}
+		if err != nil && !errors.Is(err, notes.ErrNoteNotFound) {
+			s.syncError(err, result)
+			return
+		}
+
+		result.Status = SyncStatusOK
+		return
+	}
+
+	if note.Title == *change.Title && note.Body == *change.Body {
+		result.Status = SyncStatusOK
+		result.Version = note.Version
+		return
+	}
+
+	err = notesRepository.UpdateNote(note.Id, notes.NoteUpdate{Title: change.Title, Body: change.Body}, change.Version)
+	if errors.Is(err, notes.ErrVersionMismatch) || errors.Is(err, notes.ErrNoteNotFound) {
+		s.createSyncConflict(c, user, note.WorkspaceId, note.Version, change, loc, result)
+		return
+	}
+	if err != nil {
+		s.syncError(err, result)
+		return
+	}
+	s.pruneNoteRevisions(note.Id)
+
+	previous := note.Body
+	note.Title, note.Body = *change.Title, *change.Body
+	s.notifyMentions(c, note, previous, note.Body, nil)
+
+	result.Status = SyncStatusOK
+	result.Version = change.Version + 1
+}
+
+// createSyncNote creates a note made offline. A note created before with the
+// same client id is reported as created again.
+func (s *Service) createSyncNote(
+	c echo.Context,
+	user *users.User,
+	workspaceId *int,
+	clientId, title, body string,
+	result *SyncResult) {
+	created := notes.Note{UserId: user.Id, Title: title, Body: body, WorkspaceId: workspaceId}
+
+	var err error
+	notesRepository := s.notesRepository
+	if clientId != "" {
+		note, isNew, err := notesRepository.GetOrCreateClientNote(user.Id, workspaceId, clientId, title, body)
+		if err != nil {
+			s.syncError(err, result)
+			return
+		}
+		if isNew {
+			s.notifyMentions(c, note, "", body, nil)
+		}
+
+		result.Id = note.Id
+		result.Status = SyncStatusCreated
+		result.Version = note.Version
+		return
+	}
+
+	if workspaceId != nil {
+		created.Id, err = notesRepository.CreateWorkspaceNote(user.Id, *workspaceId, title, body)
+	} else {
+		created.Id, err = notesRepository.CreateNote(user.Id, title, body)
+	}
+	if err != nil {
+		s.syncError(err, result)
+		return
+	}
+	s.notifyMentions(c, &created, "", body, nil)
+
+	result.Id = created.Id
+	result.Status = SyncStatusCreated
+	result.Version = 1
+}
+
+// createSyncConflict saves an offline edit of a note changed or deleted on
+// the server as a copy in workspaceId, or in the notes of the user if it is
+// nil. The note is at version on the server, 0 if it was deleted.
+func (s *Service) createSyncConflict(
+	c echo.Context,
+	user *users.User,
+	workspaceId *int,
+	version int,
+	change SyncChange,
+	loc *time.Location,
+	result *SyncResult) {
+	title := fmt.Sprintf("%s (conflict copy %s)", *change.Title, time.Now().In(loc).Format("2006-01-02 15:04"))
+	s.createSyncNote(c, user, workspaceId, "", title, *change.Body, result)
+	if result.Status != SyncStatusCreated {
+		return
+	}
+
+	result.ConflictId = result.Id
+	result.Id = change.Id
+	result.Status = SyncStatusConflict
+	result.Version = version
+	s.logger.Infof("User %d got a conflict copy %d of note with id %d", user.Id, result.ConflictId, change.Id)
+}
+
+func (s *Service) syncError(err error, result *SyncResult) {
+	s.logger.Error(err)
+	result.Status = SyncStatusError
+	result.Error = InternalServerError
+}
+
+func validateSyncChange(change SyncChange) string {
+	if change.Id < 0 {
+		return "invalid id"
+	}
+	if change.Id == 0 && change.Deleted {
+		return "id is required"
+	}
+	if change.Id != 0 && change.Version <= 0 {
+		return "version is required"
+	}
+	if !change.Deleted && (change.Title == nil || change.Body == nil) {
+		return "title and body are required"
+	}
+
+	return ""
+}
+
+// syncParams reads the ?since= token and the ?limit= of a sync.
+func syncParams(c echo.Context) (since, xmin int64, limit int, err error) {
+	if value := c.QueryParam("since"); value != "" {
+		since, xmin, err = parseCursor(value)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	limit = DefaultSyncLimit
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if limit <= 0 || limit > MaxSyncLimit {
+			return 0, 0, 0, errors.New("limit out of range")
+		}
+	}
+
+	return since, xmin, limit, nil
+}
@@ -0,0 +1,229 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetSync_Changes(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/sync?since=10&limit=3", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	deletedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mockNotes.On("GetNoteChanges", 1, 0, int64(10), int64(0), 4).Return(&[]notes.Change{
+		{Seq: 11, NoteId: 2, Note: &notes.Note{Id: 2, UserId: 1, Title: "changed"}},
+		{Seq: 12, NoteId: 3, Note: &notes.Note{Id: 3, UserId: 1, DeletedAt: &deletedAt}},
+		{Seq: 14, NoteId: 5},
+		{Seq: 15, NoteId: 6},
+	}, int64(700), nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Object service.SyncPage `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Object.Changed, 1) {
+		assert.Equal(t, "changed", resp.Object.Changed[0].Title)
+	}
+	assert.Equal(t, []int{3, 5}, resp.Object.Deleted)
+	assert.Equal(t, "14.700", resp.Object.Token)
+	assert.True(t, resp.Object.HasMore)
+}
+
+func TestGetSync_Initial(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/sync", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNoteChanges", 1, 0, int64(0), int64(0), service.DefaultSyncLimit+1).Return(&[]notes.Change{
+		{Seq: 3, NoteId: 1},
+		{Seq: 7, NoteId: 2, Note: &notes.Note{Id: 2, UserId: 1}},
+	}, int64(700), nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"deleted":[]`)
+	assert.Contains(t, rec.Body.String(), `"token":"7.700","has_more":false`)
+}
+
+func TestGetSync_InvalidToken(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/sync?since=abc", nil)
+	setUser(c, "user@test.com")
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), new(MockUsersRepository))
+
+	// Act
+	err := s.GetSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPostSync_Changes(t *testing.T) {
+	// Arrange
+	body := []byte(`{"changes":[
+		{"client_id":"tmp-1","title":"offline","body":"new"},
+		{"id":2,"version":3,"title":"title","body":"edited"},
+		{"id":3,"version":1,"deleted":true},
+		{"id":4,"version":2,"title":"mine","body":"offline edit"},
+		{"id":5,"version":2,"deleted":true},
+		{"id":6,"version":1}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/sync", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetOrCreateClientNote", 1, (*int)(nil), "tmp-1", "offline", "new").
+		Return(&notes.Note{Id: 10, UserId: 1, Title: "offline", Body: "new", Version: 1}, true, nil)
+
+	mockNotes.On("GetNote", 2).Return(&notes.Note{Id: 2, UserId: 1, Title: "title", Body: "old", Version: 3}, nil)
+	mockNotes.On("UpdateNote", 2, noteUpdate("title", "edited"), 3).Return(nil)
+
+	mockNotes.On("GetNote", 3).Return((*notes.Note)(nil), sql.ErrNoRows)
+
+	mockNotes.On("GetNote", 4).Return(&notes.Note{Id: 4, UserId: 1, Title: "mine", Body: "server edit", Version: 3}, nil)
+	mockNotes.On("UpdateNote", 4, noteUpdate("mine", "offline edit"), 2).Return(notes.ErrVersionMismatch)
+	mockNotes.On("CreateNote", 1, mock.MatchedBy(func(title string) bool {
+		return strings.HasPrefix(title, "mine (conflict copy ")
+	}), "offline edit").Return(11, nil)
+
+	mockNotes.On("GetNote", 5).Return(&notes.Note{Id: 5, UserId: 1, Version: 3}, nil)
+	mockNotes.On("DeleteNote", 5, 2).Return(notes.ErrVersionMismatch)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PostSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Object service.SyncResponse `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, []service.SyncResult{
+		{Index: 0, Id: 10, ClientId: "tmp-1", Status: service.SyncStatusCreated, Version: 1},
+		{Index: 1, Id: 2, Status: service.SyncStatusOK, Version: 4},
+		{Index: 2, Id: 3, Status: service.SyncStatusOK},
+		{Index: 3, Id: 4, Status: service.SyncStatusConflict, Version: 3, ConflictId: 11},
+		{Index: 4, Id: 5, Status: service.SyncStatusConflict, Version: 3},
+		{Index: 5, Id: 6, Status: service.SyncStatusError, Error: "title and body are required"},
+	}, resp.Object.Results)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetSync_ResumeRunningTransactions(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/sync?since=14.700", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNoteChanges", 1, 0, int64(14), int64(700), service.DefaultSyncLimit+1).Return(&[]notes.Change{
+		{Seq: 13, NoteId: 2, Note: &notes.Note{Id: 2, UserId: 1, Title: "late commit"}},
+	}, int64(705), nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"title":"late commit"`)
+	assert.Contains(t, rec.Body.String(), `"token":"14.705"`)
+}
+
+func TestPostSync_RetriedCreate(t *testing.T) {
+	// Arrange
+	body := []byte(`{"changes":[{"client_id":"tmp-1","title":"offline","body":"new"}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/sync", body)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetOrCreateClientNote", 1, (*int)(nil), "tmp-1", "offline", "new").
+		Return(&notes.Note{Id: 10, UserId: 1, Title: "offline", Body: "edited since", Version: 2}, false, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PostSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Object service.SyncResponse `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, []service.SyncResult{
+		{Index: 0, Id: 10, ClientId: "tmp-1", Status: service.SyncStatusCreated, Version: 2},
+	}, resp.Object.Results)
+	mockNotes.AssertNotCalled(t, "CreateNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPostSync_Forbidden(t *testing.T) {
+	// Arrange
+	body := []byte(`{"changes":[{"id":2,"version":1,"title":"t","body":"b"}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/sync", body)
+	setUser(c, "viewer@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "viewer@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 2).Return(&notes.Note{Id: 2, UserId: 1, Version: 1}, nil)
+	mockNotes.On("GetNoteShare", 2, 2).Return(&notes.Share{NoteId: 2, UserId: 2, Role: notes.RoleViewer}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.PostSync(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"error","error":"forbidden"`)
+	mockNotes.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/pkg/markdown"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	TaskStateOpen = "open"
+	TaskStateDone = "done"
+	TaskStateAll  = "all"
+)
+
+type TaskRequest struct {
+	// Checked sets the state of the task. The task is toggled if omitted.
+	Checked *bool `json:"checked"`
+}
+
+type NoteTask struct {
+	NoteId    int    `json:"note_id"`
+	NoteTitle string `json:"note_title"`
+	markdown.Task
+}
+
+// localhost:8000/api/note/:id/tasks
+func (s *Service) GetNoteTasks(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleViewer)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	setNoteETag(c, note)
+	s.logger.Infof("Tasks of note with id %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: markdown.Tasks(note.Body)})
+}
+
+// localhost:8000/api/note/:id/tasks/:index
+func (s *Service) UpdateNoteTask(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request TaskRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch == "" && s.requireIfMatch {
+		return c.JSON(s.NewError(PreconditionRequired))
+	}
+
+	for attempt := 1; ; attempt++ {
+		note, _, err := s.getSharedNote(c, id, notes.RoleEditor)
+		if err != nil {
+			return s.ErrorResponse(c, err)
+		}
+
+		if ifMatch != "" && !etagMatches(ifMatch, noteETag(note), false) {
+			return c.JSON(s.NewError(PreconditionFailed))
+		}
+
+		tasks := markdown.Tasks(note.Body)
+		if index < 0 || index >= len(tasks) {
+			s.logger.Errorf("Note with id %d has no task %d", id, index)
+			return c.JSON(s.NewError(NotFound))
+		}
+
+		checked := !tasks[index].Checked
+		if request.Checked != nil {
+			checked = *request.Checked
+		}
+
+		task := tasks[index]
+		task.Checked = checked
+		if checked == tasks[index].Checked {
+			setNoteETag(c, note)
+			return c.JSON(http.StatusOK, Response{Object: task})
+		}
+
+		body, err := markdown.SetTask(note.Body, index, checked)
+		if err != nil {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+
+		err = s.notesRepository.UpdateNote(id, notes.NoteUpdate{Body: &body}, note.Version)
+		if errors.Is(err, notes.ErrVersionMismatch) && ifMatch == "" && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return s.noteWriteError(c, err)
+		}
+		s.pruneNoteRevisions(id)
+
+		note.Version++
+		setNoteETag(c, note)
+
+		s.logger.Infof("Task %d of note with id %d was set to %t", index, id, checked)
+		return c.JSON(http.StatusOK, Response{Object: task})
+	}
+}
+
+// localhost:8000/api/tasks?state=open
+func (s *Service) GetTasks(c echo.Context) error {
+	state := c.QueryParam("state")
+	if state == "" {
+		state = TaskStateAll
+	}
+	if state != TaskStateOpen && state != TaskStateDone && state != TaskStateAll {
+		s.logger.Errorf("Unknown task state %q", state)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notesRepository := s.notesRepository
+	list, err := notesRepository.GetUserNotes(dbUser.Id, notes.NotesFilter{})
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	tasks := []NoteTask{}
+	if list != nil {
+		for _, note := range *list {
+			for _, task := range markdown.Tasks(note.Body) {
+				if state == TaskStateOpen && task.Checked || state == TaskStateDone && !task.Checked {
+					continue
+				}
+
+				tasks = append(tasks, NoteTask{NoteId: note.Id, NoteTitle: note.Title, Task: task})
+			}
+		}
+	}
+
+	s.logger.Infof("User %d took his %s tasks", dbUser.Id, state)
+	return c.JSON(http.StatusOK, Response{Object: tasks})
+}
@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateNoteTask_Toggle(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1/tasks/1", []byte(`{}`))
+	c.SetPath("/api/note/:id/tasks/:index")
+	c.SetParamNames("id", "index")
+	c.SetParamValues("1", "1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).
+		Return(&notes.Note{Id: 1, UserId: 1, Version: 3, Body: "- [x] one\n- [ ] two\n"}, nil)
+	body := "- [x] one\n- [x] two\n"
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Body: &body}, 3).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNoteTask(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1-4"`, rec.Header().Get("ETag"))
+	mockNotes.AssertExpectations(t)
+}
+
+func TestUpdateNoteTask_Retry(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1/tasks/0", []byte(`{"checked":true}`))
+	c.SetPath("/api/note/:id/tasks/:index")
+	c.SetParamNames("id", "index")
+	c.SetParamValues("1", "0")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).
+		Return(&notes.Note{Id: 1, UserId: 1, Version: 1, Body: "- [ ] one"}, nil).Once()
+	mockNotes.On("GetNote", 1).
+		Return(&notes.Note{Id: 1, UserId: 1, Version: 2, Body: "- [ ] one\n- [ ] two"}, nil).Once()
+	first := "- [x] one"
+	second := "- [x] one\n- [ ] two"
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Body: &first}, 1).Return(notes.ErrVersionMismatch)
+	mockNotes.On("UpdateNote", 1, notes.NoteUpdate{Body: &second}, 2).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNoteTask(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestUpdateNoteTask_NotFound(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPatch, "/api/note/1/tasks/5", []byte(`{"checked":true}`))
+	c.SetPath("/api/note/:id/tasks/:index")
+	c.SetParamNames("id", "index")
+	c.SetParamValues("1", "5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, Body: "- [ ] one"}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateNoteTask(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote")
+}
+
+func TestGetTasks_Open(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/tasks?state=open", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetUserNotes", 1, notes.NotesFilter{}).Return(&[]notes.Note{
+		{Id: 1, Title: "home", Body: "- [x] done\n- [ ] open"},
+		{Id: 2, Title: "work", Body: "- [ ] report"},
+	}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetTasks(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Object []service.NoteTask `json:"object"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Object, 2)
+	assert.Equal(t, "open", response.Object[0].Text)
+	assert.Equal(t, 1, response.Object[0].Index)
+	assert.Equal(t, "work", response.Object[1].NoteTitle)
+}
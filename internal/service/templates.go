@@ -0,0 +1,277 @@
+package service
+
+import (
+	"NotesService/internal/templates"
+	"NotesService/pkg/placeholder"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type FromTemplateRequest struct {
+	// Title overrides the title rendered from the template.
+	Title     *string           `json:"title"`
+	Variables map[string]string `json:"variables"`
+}
+
+// localhost:8000/api/templates
+func (s *Service) GetTemplates(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	templatesRepository := s.templatesRepository
+	list, err := templatesRepository.GetUserTemplates(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+
+	s.logger.Infof("User %d took his templates", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: list})
+}
+
+// localhost:8000/api/template/:id
+func (s *Service) GetTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	template, err := s.getOwnTemplate(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	template.In(loc)
+
+	s.logger.Infof("Template with id %d was given", id)
+	return c.JSON(http.StatusOK, Response{Object: template})
+}
+
+// localhost:8000/api/template
+func (s *Service) CreateTemplate(c echo.Context) error {
+	var template Template
+	err := c.Bind(&template)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		s.logger.Error("Template without a name")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	templatesRepository := s.templatesRepository
+	id, err := templatesRepository.CreateTemplate(dbUser.Id, template.Name, template.Title, template.Body)
+	if err != nil {
+		return s.templateWriteError(c, err)
+	}
+
+	s.logger.Infof("User %d created template with id %d", dbUser.Id, id)
+	return c.JSON(http.StatusOK, Response{Object: map[string]int{"id": id}})
+}
+
+// localhost:8000/api/template/:id
+func (s *Service) UpdateTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var template Template
+	err = c.Bind(&template)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		s.logger.Error("Template without a name")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getOwnTemplate(c, id); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	templatesRepository := s.templatesRepository
+	err = templatesRepository.UpdateTemplate(id, template.Name, template.Title, template.Body)
+	if err != nil {
+		return s.templateWriteError(c, err)
+	}
+
+	s.logger.Infof("Template with id %d was updated", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/template/:id
+func (s *Service) DeleteTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getOwnTemplate(c, id); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	templatesRepository := s.templatesRepository
+	err = templatesRepository.DeleteTemplate(id)
+	if err != nil {
+		return s.templateWriteError(c, err)
+	}
+
+	s.logger.Infof("Template with id %d was deleted", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/note/from-template/:id
+//
+// Besides the variables of the request, {{date}}, {{time}}, {{datetime}},
+// {{weekday}} and {{title}} are filled in. Dates are in the time zone of the
+// user.
+func (s *Service) CreateNoteFromTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request FromTemplateRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	template, err := s.getOwnTemplate(c, id)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	title, body := expandTemplate(template, time.Now().In(loc), request.Title, request.Variables)
+
+	notesRepository := s.notesRepository
+	noteId, err := notesRepository.CreateNote(dbUser.Id, title, body)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	note, err := notesRepository.GetNote(noteId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	note.In(loc)
+	setNoteETag(c, note)
+
+	s.logger.Infof("User %d created note with id %d from template %d", dbUser.Id, noteId, id)
+	return c.JSON(http.StatusOK, Response{Object: note})
+}
+
+// expandTemplate renders the title and body of a note created from the
+// template at now. Variables given by the user take precedence over the
+// built-in ones.
+func expandTemplate(
+	template *templates.Template,
+	now time.Time,
+	title *string,
+	variables map[string]string) (string, string) {
+	vars := map[string]string{
+		"date":     now.Format(time.DateOnly),
+		"time":     now.Format("15:04"),
+		"datetime": now.Format(time.RFC3339),
+		"weekday":  now.Weekday().String(),
+	}
+	for name, value := range variables {
+		vars[name] = value
+	}
+
+	noteTitle := placeholder.Expand(template.Title, vars)
+	if title != nil {
+		noteTitle = *title
+	}
+	if _, ok := variables["title"]; !ok {
+		vars["title"] = noteTitle
+	}
+
+	return noteTitle, placeholder.Expand(template.Body, vars)
+}
+
+// getOwnTemplate loads the template with the given id if it belongs to the
+// authenticated user. Foreign templates are reported as not found.
+func (s *Service) getOwnTemplate(c echo.Context, id int) (*templates.Template, error) {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := s.templatesRepository.GetTemplate(id)
+	if errors.Is(err, templates.ErrTemplateNotFound) {
+		return nil, &Response{ErrorMessage: NotFound}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if template.UserId != dbUser.Id {
+		return nil, &Response{ErrorMessage: NotFound}
+	}
+
+	return template, nil
+}
+
+func (s *Service) templateWriteError(c echo.Context, err error) error {
+	s.logger.Error(err)
+	switch {
+	case errors.Is(err, templates.ErrDuplicateName):
+		return c.JSON(s.NewError(Conflict))
+	case errors.Is(err, templates.ErrTemplateNotFound):
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	return c.JSON(s.NewError(InternalServerError))
+}
@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/templates"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateTemplate_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/template",
+		[]byte(`{"name":" standup ","title":"Standup {{date}}","body":"## {{title}}"}`))
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockTemplates.On("CreateTemplate", 1, "standup", "Standup {{date}}", "## {{title}}").Return(5, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	err := s.CreateTemplate(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"object":{"id":5}}`, rec.Body.String())
+}
+
+func TestCreateTemplate_DuplicateName(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/template", []byte(`{"name":"standup"}`))
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockTemplates.On("CreateTemplate", 1, "standup", "", "").Return(0, templates.ErrDuplicateName)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	err := s.CreateTemplate(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestDeleteTemplate_ForeignTemplate(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/template/5", nil)
+	c.SetPath("/api/template/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockTemplates.On("GetTemplate", 5).Return(&templates.Template{Id: 5, UserId: 2}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	err := s.DeleteTemplate(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockTemplates.AssertNotCalled(t, "DeleteTemplate", 5)
+}
+
+func TestCreateNoteFromTemplate_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/from-template/5",
+		[]byte(`{"variables":{"date":"2024-05-01","attendees":"Ann, Bob"}}`))
+	c.SetPath("/api/note/from-template/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockTemplates.On("GetTemplate", 5).Return(&templates.Template{
+		Id:     5,
+		UserId: 1,
+		Title:  "Standup {{date}}",
+		Body:   "# {{title}}\n{{attendees}} {{missing}}",
+	}, nil)
+	mockNotes.On("CreateNote", 1, "Standup 2024-05-01", "# Standup 2024-05-01\nAnn, Bob {{missing}}").
+		Return(7, nil)
+	mockNotes.On("GetNote", 7).Return(&notes.Note{Id: 7, UserId: 1, Version: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	err := s.CreateNoteFromTemplate(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"7-1"`, rec.Header().Get("ETag"))
+	mockNotes.AssertExpectations(t)
+}
+
+func TestCreateNoteFromTemplate_UserTimeZone(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/from-template/5", []byte(`{"title":"Journal"}`))
+	c.SetPath("/api/note/from-template/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockTemplates := new(MockTemplatesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").
+		Return(&users.User{Id: 1, TimeZone: "Pacific/Kiritimati"}, nil)
+	mockTemplates.On("GetTemplate", 5).
+		Return(&templates.Template{Id: 5, UserId: 1, Title: "{{date}}", Body: "{{title}} {{date}}"}, nil)
+
+	var body string
+	mockNotes.On("CreateNote", 1, "Journal", mock.Anything).
+		Run(func(args mock.Arguments) { body = args.String(2) }).
+		Return(7, nil)
+	mockNotes.On("GetNote", 7).Return(&notes.Note{Id: 7, UserId: 1, Version: 1}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithTemplates(mockTemplates))
+
+	// Act
+	before := time.Now()
+	err := s.CreateNoteFromTemplate(c)
+	after := time.Now()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	loc, _ := time.LoadLocation("Pacific/Kiritimati")
+	assert.Contains(t, []string{
+		"Journal " + before.In(loc).Format(time.DateOnly),
+		"Journal " + after.In(loc).Format(time.DateOnly),
+	}, body)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/users"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type TimeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
+}
+
+// localhost:8000/api/user/timezone
+func (s *Service) UpdateTimeZone(c echo.Context) error {
+	var request TimeZoneRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := time.LoadLocation(request.TimeZone); err != nil || request.TimeZone == "" {
+		s.logger.Errorf("Invalid time zone %q", request.TimeZone)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	usersRepository := s.usersRepository
+	err = usersRepository.UpdateUserTimeZone(dbUser.Id, request.TimeZone)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d set time zone %s", dbUser.Id, request.TimeZone)
+	return c.String(http.StatusOK, "OK")
+}
+
+// userLocation returns the time zone timestamps are rendered in: the one
+// requested with ?tz= or the Time-Zone header, then the preference stored
+// for the user, then UTC. A nil user is resolved from the request if it is
+// authenticated.
+func (s *Service) userLocation(c echo.Context, user *users.User) (*time.Location, error) {
+	name := c.QueryParam("tz")
+	if name == "" {
+		name = c.Request().Header.Get("Time-Zone")
+	}
+	if name == "" && user == nil {
+		if _, ok := c.Get("user").(*jwt.Token); ok {
+			var err error
+			user, err = s.getCurrentUser(c)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if name == "" && user != nil {
+		name = user.TimeZone
+	}
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, &Response{ErrorMessage: InvalidParams}
+	}
+
+	return loc, nil
+}
+
+func localizeNotes(list *[]notes.Note, loc *time.Location) {
+	if list == nil {
+		return
+	}
+
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+}
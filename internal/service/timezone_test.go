@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"net/http"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUserNotes_RequestedTimeZone(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes?tz=Europe/Moscow", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1, TimeZone: "Asia/Tokyo"}, nil)
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockNotes.On("GetUserNotes", 1, notes.NotesFilter{}).
+		Return(&[]notes.Note{{Id: 1, CreatedAt: createdAt, UpdatedAt: createdAt}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetUserNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"created_at":"2025-03-01T15:00:00+03:00"`)
+}
+
+func TestGetUserNotes_StoredTimeZone(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1, TimeZone: "Asia/Tokyo"}, nil)
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockNotes.On("GetUserNotes", 1, notes.NotesFilter{}).
+		Return(&[]notes.Note{{Id: 1, CreatedAt: createdAt, UpdatedAt: createdAt}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetUserNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), `"updated_at":"2025-03-01T21:00:00+09:00"`)
+}
+
+func TestUpdateTimeZone_Invalid(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/user/timezone", []byte(`{"time_zone":"Mars/Olympus"}`))
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.UpdateTimeZone(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockUsers.AssertNotCalled(t, "UpdateUserTimeZone", 1, "Mars/Olympus")
+}
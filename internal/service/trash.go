@@ -0,0 +1,141 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/users"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// localhost:8000/api/trash
+func (s *Service) GetTrash(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspaceId, err := s.activeWorkspaceId(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	notes, err := notesRepository.GetTrashedNotes(dbUser.Id, workspaceId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeNotes(notes, loc)
+
+	s.logger.Infof("User %d took his trash", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: notes})
+}
+
+// localhost:8000/api/note/:id/restore
+func (s *Service) RestoreNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.RestoreNote(dbUser.Id, id)
+	if errors.Is(err, notes.ErrNoteNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Note with id %d was restored from trash", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/trash
+func (s *Service) EmptyTrash(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspaceId, err := s.activeWorkspaceId(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	deleted, err := notesRepository.EmptyTrash(dbUser.Id, workspaceId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if deleted > 0 {
+		s.deleteOrphanBlobs()
+	}
+
+	s.logger.Infof("User %d emptied his trash, %d notes deleted", dbUser.Id, deleted)
+	return c.String(http.StatusOK, "OK")
+}
+
+// activeWorkspaceId returns the id of the workspace active in the JWT claims,
+// or 0 when the personal notes are active.
+func (s *Service) activeWorkspaceId(c echo.Context, user *users.User) (int, error) {
+	workspace, err := s.getActiveWorkspace(c, user)
+	if err != nil || workspace == nil {
+		return 0, err
+	}
+
+	return workspace.WorkspaceId, nil
+}
+
+// RunTrashPurge permanently deletes notes kept in the trash for longer than
+// retentionDays. It checks every interval until ctx is cancelled.
+func (s *Service) RunTrashPurge(ctx context.Context, interval time.Duration, retentionDays int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeTrash(retentionDays)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) purgeTrash(retentionDays int) {
+	purged, err := s.notesRepository.PurgeDeletedNotes(retentionDays)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+
+	if purged > 0 {
+		s.logger.Infof("%d notes were purged from trash", purged)
+		s.deleteOrphanBlobs()
+	}
+}
@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/pkg/logs"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetTrash_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/trash", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	deletedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockNotes.On("GetTrashedNotes", 1, 0).Return(&[]notes.Note{{Id: 3, DeletedAt: &deletedAt}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.GetTrash(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"deleted_at":"2025-01-01T00:00:00Z"`)
+}
+
+func TestRestoreNote_NotInTrash(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/3/restore", nil)
+	c.SetPath("/api/note/:id/restore")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("RestoreNote", 1, 3).Return(notes.ErrNoteNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.RestoreNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestEmptyTrash_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/trash", nil)
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("EmptyTrash", 1, 0).Return(int64(2), nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+
+	// Act
+	err := s.EmptyTrash(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestRunTrashPurge_PurgesUntilCancelled(t *testing.T) {
+	// Arrange
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	purged := make(chan struct{}, 10)
+	mockNotes.On("PurgeDeletedNotes", 30).Return(int64(1), nil).
+		Run(func(_ mock.Arguments) { purged <- struct{}{} })
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	// Act
+	go func() {
+		s.RunTrashPurge(ctx, time.Millisecond, 30)
+		close(done)
+	}()
+	<-purged
+	<-purged
+	cancel()
+
+	// Assert
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purge loop did not stop")
+	}
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"NotesService/cmd/config"
+	"NotesService/internal/users"
+	"NotesService/internal/workspaces"
+	"errors"
 	"net/http"
 	"net/mail"
 	"time"
@@ -13,6 +16,8 @@ import (
 
 type Claims struct {
 	Username string `json:"email"`
+	// Workspace is the id of the active workspace, 0 for the personal notes.
+	Workspace int `json:"workspace,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -35,7 +40,7 @@ func (s *Service) Login(c echo.Context) error {
 		return c.JSON(s.NewError(InvalidCredentials))
 	}
 
-	token, err := GenerateJWT(email)
+	token, err := GenerateJWT(email, 0)
 	if err != nil {
 		return err
 	}
@@ -82,7 +87,7 @@ func (s *Service) Register(c echo.Context) error {
 	return c.JSON(http.StatusOK, "OK")
 }
 
-func GenerateJWT(username string) (string, error) {
+func GenerateJWT(username string, workspaceId int) (string, error) {
 	appConf, err := config.GetConfig()
 	if err != nil {
 		return "", err
@@ -93,7 +98,8 @@ func GenerateJWT(username string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 
 	claims := &Claims{
-		Username: username,
+		Username:  username,
+		Workspace: workspaceId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   username,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
@@ -105,6 +111,38 @@ func GenerateJWT(username string) (string, error) {
 	return token.SignedString(jwtKey)
 }
 
+// getCurrentUser resolves the authenticated user from the JWT claims.
+func (s *Service) getCurrentUser(c echo.Context) (*users.User, error) {
+	token := c.Get("user").(*jwt.Token)
+	email, err := token.Claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.usersRepository.GetUserByEmail(email)
+}
+
+// getActiveWorkspace returns the membership of the user in the workspace
+// active in the JWT claims, or nil when the personal notes are active.
+// Tokens of users that have left the workspace are refused.
+func (s *Service) getActiveWorkspace(c echo.Context, user *users.User) (*workspaces.Member, error) {
+	token := c.Get("user").(*jwt.Token)
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.Workspace == 0 || s.workspacesRepository == nil {
+		return nil, nil
+	}
+
+	member, err := s.workspacesRepository.GetMember(claims.Workspace, user.Id)
+	if errors.Is(err, workspaces.ErrMemberNotFound) {
+		return nil, &Response{ErrorMessage: Forbidden}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
 func IsValidEmail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
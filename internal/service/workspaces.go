@@ -0,0 +1,554 @@
+package service
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/workspaces"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email"`
+	// Role defaults to member.
+	Role string `json:"role"`
+}
+
+// ActiveWorkspaceRequest selects a workspace, 0 for the personal notes.
+type ActiveWorkspaceRequest struct {
+	WorkspaceId int `json:"workspace_id"`
+}
+
+// localhost:8000/api/workspaces
+func (s *Service) GetWorkspaces(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	list, err := workspacesRepository.GetUserWorkspaces(dbUser.Id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+
+	s.logger.Infof("User %d took his workspaces", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: list})
+}
+
+// localhost:8000/api/workspace
+func (s *Service) CreateWorkspace(c echo.Context) error {
+	var request WorkspaceRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		s.logger.Error("Workspace name is empty")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspacesRepository := s.workspacesRepository
+	id, err := workspacesRepository.CreateWorkspace(dbUser.Id, request.Name)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d created workspace %d", dbUser.Id, id)
+	return c.JSON(http.StatusOK, Response{Object: workspaces.Workspace{
+		Id:   id,
+		Name: request.Name,
+		Role: workspaces.RoleOwner,
+	}})
+}
+
+// localhost:8000/api/workspace/:id
+//
+// Deletes the workspace together with its notes. Only the owner can.
+func (s *Service) DeleteWorkspace(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getWorkspaceMember(c, id, workspaces.RoleOwner); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	err = workspacesRepository.DeleteWorkspace(id)
+	if errors.Is(err, workspaces.ErrWorkspaceNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Workspace %d was deleted", id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/workspace/:id/members
+func (s *Service) GetWorkspaceMembers(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getWorkspaceMember(c, id, workspaces.RoleMember); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	members, err := workspacesRepository.GetMembers(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Members of workspace %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: members})
+}
+
+// localhost:8000/api/workspace/:id/members/:user
+//
+// Admins make other members admins or members. The owner keeps the role.
+func (s *Service) UpdateWorkspaceMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	userId, err := strconv.Atoi(c.Param("user"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request WorkspaceMemberRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.Role != workspaces.RoleAdmin && request.Role != workspaces.RoleMember {
+		s.logger.Errorf("Invalid workspace role %q", request.Role)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getWorkspaceMember(c, id, workspaces.RoleAdmin); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	member, err := workspacesRepository.GetMember(id, userId)
+	if errors.Is(err, workspaces.ErrMemberNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if member.Role == workspaces.RoleOwner {
+		s.logger.Errorf("Role of the owner of workspace %d cannot be changed", id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	err = workspacesRepository.UpdateMemberRole(id, userId, request.Role)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d is now %s of workspace %d", userId, request.Role, id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/workspace/:id/members/:user
+//
+// Admins remove other members, members can leave. The owner cannot leave.
+func (s *Service) RemoveWorkspaceMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	userId, err := strconv.Atoi(c.Param("user"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	current, err := s.getWorkspaceMember(c, id, workspaces.RoleMember)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if userId != current.UserId && !current.HasRole(workspaces.RoleAdmin) {
+		s.logger.Errorf("User %d cannot remove members of workspace %d", current.UserId, id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	workspacesRepository := s.workspacesRepository
+	member, err := workspacesRepository.GetMember(id, userId)
+	if errors.Is(err, workspaces.ErrMemberNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if member.Role == workspaces.RoleOwner {
+		s.logger.Errorf("Owner of workspace %d cannot be removed", id)
+		return c.JSON(s.NewError(Forbidden))
+	}
+
+	err = workspacesRepository.RemoveMember(id, userId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d was removed from workspace %d", userId, id)
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/workspace/:id/invitations
+func (s *Service) InviteToWorkspace(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request InvitationRequest
+	err = c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if request.Role == "" {
+		request.Role = workspaces.RoleMember
+	}
+	if request.Role != workspaces.RoleAdmin && request.Role != workspaces.RoleMember {
+		s.logger.Errorf("Invalid workspace role %q", request.Role)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+	if !IsValidEmail(request.Email) {
+		s.logger.Error("Invalid email")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	current, err := s.getWorkspaceMember(c, id, workspaces.RoleAdmin)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	usersRepository := s.usersRepository
+	invited, err := usersRepository.GetUserByEmail(request.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspacesRepository := s.workspacesRepository
+	if invited != nil {
+		_, err = workspacesRepository.GetMember(id, invited.Id)
+		if err == nil {
+			s.logger.Errorf("User %d is already a member of workspace %d", invited.Id, id)
+			return c.JSON(s.NewError(Conflict))
+		}
+		if !errors.Is(err, workspaces.ErrMemberNotFound) {
+			s.logger.Error(err)
+			return c.JSON(s.NewError(InternalServerError))
+		}
+	}
+
+	invitationId, err := workspacesRepository.CreateInvitation(id, current.UserId, request.Email, request.Role)
+	if errors.Is(err, workspaces.ErrAlreadyInvited) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(Conflict))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Invitation %d to workspace %d was sent", invitationId, id)
+	return c.JSON(http.StatusOK, Response{Object: workspaces.Invitation{
+		Id:          invitationId,
+		WorkspaceId: id,
+		Email:       request.Email,
+		Role:        request.Role,
+		InvitedBy:   &current.UserId,
+		Status:      workspaces.StatusPending,
+	}})
+}
+
+// localhost:8000/api/workspace/:id/invitations
+func (s *Service) GetWorkspaceInvitations(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	if _, err := s.getWorkspaceMember(c, id, workspaces.RoleAdmin); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	loc, err := s.userLocation(c, nil)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	invitations, err := workspacesRepository.GetWorkspaceInvitations(id)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeInvitations(invitations, loc)
+
+	s.logger.Infof("Invitations to workspace %d were given", id)
+	return c.JSON(http.StatusOK, Response{Object: invitations})
+}
+
+// localhost:8000/api/invitations
+func (s *Service) GetInvitations(c echo.Context) error {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	loc, err := s.userLocation(c, dbUser)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	workspacesRepository := s.workspacesRepository
+	invitations, err := workspacesRepository.GetUserInvitations(dbUser.Email)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+	localizeInvitations(invitations, loc)
+
+	s.logger.Infof("User %d took his invitations", dbUser.Id)
+	return c.JSON(http.StatusOK, Response{Object: invitations})
+}
+
+// localhost:8000/api/invitation/:id/accept
+func (s *Service) AcceptInvitation(c echo.Context) error {
+	return s.respondToInvitation(c, true)
+}
+
+// localhost:8000/api/invitation/:id/decline
+func (s *Service) DeclineInvitation(c echo.Context) error {
+	return s.respondToInvitation(c, false)
+}
+
+func (s *Service) respondToInvitation(c echo.Context, accept bool) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	workspacesRepository := s.workspacesRepository
+	invitation, err := workspacesRepository.GetInvitation(id)
+	if errors.Is(err, workspaces.ErrInvitationNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	// Invitations of other users are not disclosed.
+	if !strings.EqualFold(invitation.Email, dbUser.Email) || invitation.Status != workspaces.StatusPending {
+		s.logger.Errorf("Invitation %d is not pending for user %d", id, dbUser.Id)
+		return c.JSON(s.NewError(NotFound))
+	}
+
+	err = workspacesRepository.RespondToInvitation(id, dbUser.Id, accept)
+	if errors.Is(err, workspaces.ErrInvitationNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(NotFound))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if accept {
+		s.logger.Infof("User %d joined workspace %d", dbUser.Id, invitation.WorkspaceId)
+	} else {
+		s.logger.Infof("User %d declined invitation %d", dbUser.Id, id)
+	}
+	return c.String(http.StatusOK, "OK")
+}
+
+// localhost:8000/api/user/workspace
+//
+// Issues a token with the given workspace active, so that listing and
+// creating notes work on the notes of the workspace. Workspace 0 switches
+// back to the personal notes.
+func (s *Service) SwitchWorkspace(c echo.Context) error {
+	var request ActiveWorkspaceRequest
+	err := c.Bind(&request)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	if request.WorkspaceId != 0 {
+		if _, err := s.getWorkspaceMember(c, request.WorkspaceId, workspaces.RoleMember); err != nil {
+			return s.ErrorResponse(c, err)
+		}
+	}
+
+	token, err := GenerateJWT(dbUser.Email, request.WorkspaceId)
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("User %d switched to workspace %d", dbUser.Id, request.WorkspaceId)
+	return c.JSON(http.StatusOK, map[string]string{
+		"token": token,
+	})
+}
+
+// localhost:8000/api/note/:id/transfer
+//
+// Moves a personal note of the user into a workspace they are a member of.
+func (s *Service) TransferNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	var request ActiveWorkspaceRequest
+	err = c.Bind(&request)
+	if err != nil || request.WorkspaceId == 0 {
+		s.logger.Error("Workspace to transfer the note to is missing")
+		return c.JSON(s.NewError(InvalidParams))
+	}
+
+	note, _, err := s.getSharedNote(c, id, notes.RoleOwner)
+	if err != nil {
+		return s.ErrorResponse(c, err)
+	}
+	if note.WorkspaceId != nil {
+		s.logger.Errorf("Note with id %d already belongs to workspace %d", id, *note.WorkspaceId)
+		return c.JSON(s.NewError(Conflict))
+	}
+
+	if _, err := s.getWorkspaceMember(c, request.WorkspaceId, workspaces.RoleMember); err != nil {
+		return s.ErrorResponse(c, err)
+	}
+
+	notesRepository := s.notesRepository
+	err = notesRepository.MoveNoteToWorkspace(id, request.WorkspaceId)
+	if errors.Is(err, notes.ErrNoteNotFound) {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(Conflict))
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return c.JSON(s.NewError(InternalServerError))
+	}
+
+	s.logger.Infof("Note with id %d was transferred to workspace %d", id, request.WorkspaceId)
+	return c.String(http.StatusOK, "OK")
+}
+
+// getWorkspaceMember returns the membership of the authenticated user in the
+// workspace if they have at least the given role. Workspaces the user is not
+// a member of are reported as not found.
+func (s *Service) getWorkspaceMember(c echo.Context, workspaceId int, role string) (*workspaces.Member, error) {
+	dbUser, err := s.getCurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.workspacesRepository.GetMember(workspaceId, dbUser.Id)
+	if errors.Is(err, workspaces.ErrMemberNotFound) {
+		return nil, &Response{ErrorMessage: NotFound}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !member.HasRole(role) {
+		return nil, &Response{ErrorMessage: Forbidden}
+	}
+
+	return member, nil
+}
+
+func localizeInvitations(list *[]workspaces.Invitation, loc *time.Location) {
+	for i := range *list {
+		(*list)[i].In(loc)
+	}
+}
@@ -0,0 +1,521 @@
+package service_test
+
+import (
+	"NotesService/internal/notes"
+	"NotesService/internal/service"
+	"NotesService/internal/users"
+	"NotesService/internal/workspaces"
+	"NotesService/pkg/logs"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetUserNotes_ActiveWorkspace(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes?q=plan", nil)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleMember}, nil)
+	mockNotes.On("GetUserNotes", 1, notes.NotesFilter{WorkspaceId: 5, Query: "plan"}).Return(&[]notes.Note{}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetUserNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetUserNotes_LeftWorkspace(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/notes", nil)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(nil, workspaces.ErrMemberNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetUserNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "GetUserNotes")
+}
+
+func TestGetNote_WorkspaceMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "member@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "member@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleMember}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"workspace_id":5`)
+}
+
+func TestDeleteNote_WorkspaceMemberForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "member@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "member@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleMember}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.DeleteNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "DeleteNote")
+}
+
+func TestGetNote_WorkspaceNonMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1", nil)
+	c.SetPath("/api/note/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "stranger@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "stranger@test.com").Return(&users.User{Id: 3}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 3).Return(nil, workspaces.ErrMemberNotFound)
+	mockNotes.On("GetNoteShare", 1, 3).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUpdateWorkspaceMember_Owner(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/workspace/5/members/1", []byte(`{"role":"member"}`))
+	c.SetPath("/api/workspace/:id/members/:user")
+	c.SetParamNames("id", "user")
+	c.SetParamValues("5", "1")
+	setUser(c, "admin@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "admin@test.com").Return(&users.User{Id: 2}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleAdmin}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleOwner}, nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.UpdateWorkspaceMember(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockWorkspaces.AssertNotCalled(t, "UpdateMemberRole")
+}
+
+func TestInviteToWorkspace_AlreadyInvited(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/workspace/5/invitations", []byte(`{"email":"new@test.com"}`))
+	c.SetPath("/api/workspace/:id/invitations")
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	setUser(c, "owner@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "owner@test.com").Return(&users.User{Id: 1}, nil)
+	mockUsers.On("GetUserByEmail", "new@test.com").Return(nil, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleOwner}, nil)
+	mockWorkspaces.On("CreateInvitation", 5, 1, "new@test.com", workspaces.RoleMember).Return(0, workspaces.ErrAlreadyInvited)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.InviteToWorkspace(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestAcceptInvitation_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/invitation/3/accept", nil)
+	c.SetPath("/api/invitation/:id/accept")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "new@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "new@test.com").Return(&users.User{Id: 4, Email: "new@test.com"}, nil)
+	mockWorkspaces.On("GetInvitation", 3).Return(&workspaces.Invitation{Id: 3, WorkspaceId: 5, Email: "New@Test.com", Status: workspaces.StatusPending}, nil)
+	mockWorkspaces.On("RespondToInvitation", 3, 4, true).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.AcceptInvitation(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockWorkspaces.AssertExpectations(t)
+}
+
+func TestAcceptInvitation_OtherUser(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/invitation/3/accept", nil)
+	c.SetPath("/api/invitation/:id/accept")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	setUser(c, "other@test.com")
+
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "other@test.com").Return(&users.User{Id: 6, Email: "other@test.com"}, nil)
+	mockWorkspaces.On("GetInvitation", 3).Return(&workspaces.Invitation{Id: 3, WorkspaceId: 5, Email: "new@test.com", Status: workspaces.StatusPending}, nil)
+
+	s := service.NewService(logs.NewLogger(false), new(MockNotesRepository), mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.AcceptInvitation(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockWorkspaces.AssertNotCalled(t, "RespondToInvitation")
+}
+
+func TestTransferNote_Success(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/transfer", []byte(`{"workspace_id":5}`))
+	c.SetPath("/api/note/:id/transfer")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleMember}, nil)
+	mockNotes.On("MoveNoteToWorkspace", 1, 5).Return(nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.TransferNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestTransferNote_NotMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/transfer", []byte(`{"workspace_id":5}`))
+	c.SetPath("/api/note/:id/transfer")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "user@test.com")
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(nil, workspaces.ErrMemberNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.TransferNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "MoveNoteToWorkspace")
+}
+
+func TestGetNoteRevisions_WorkspaceMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/note/1/revisions", nil)
+	c.SetPath("/api/note/:id/revisions")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "member@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "member@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleMember}, nil)
+	mockNotes.On("GetNoteRevisions", 1).Return(&[]notes.Revision{{NoteId: 1, Revision: 1}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetNoteRevisions(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestRestoreNoteRevision_RemovedMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPost, "/api/note/1/revisions/1/restore", nil)
+	c.SetPath("/api/note/:id/revisions/:rev/restore")
+	c.SetParamNames("id", "rev")
+	c.SetParamValues("1", "1")
+	setUser(c, "user@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(nil, workspaces.ErrMemberNotFound)
+	mockNotes.On("GetNoteShare", 1, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.RestoreNoteRevision(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPinNote_WorkspaceMemberForbidden(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodPut, "/api/note/1/pin", nil)
+	c.SetPath("/api/note/:id/pin")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setUser(c, "member@test.com")
+
+	workspaceId := 5
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "member@test.com").Return(&users.User{Id: 2}, nil)
+	mockNotes.On("GetNote", 1).Return(&notes.Note{Id: 1, UserId: 1, WorkspaceId: &workspaceId}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleMember}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.PinNote(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetTrash_ActiveWorkspace(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/trash", nil)
+	setWorkspaceUser(c, "member@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "member@test.com").Return(&users.User{Id: 2}, nil)
+	mockWorkspaces.On("GetMember", 5, 2).Return(&workspaces.Member{WorkspaceId: 5, UserId: 2, Role: workspaces.RoleMember}, nil)
+	mockNotes.On("GetTrashedNotes", 2, 5).Return(&[]notes.Note{}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetTrash(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestEmptyTrash_RemovedMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodDelete, "/api/trash", nil)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(nil, workspaces.ErrMemberNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.EmptyTrash(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "EmptyTrash", mock.Anything, mock.Anything)
+}
+
+func TestBulkNotes_WorkspaceRoles(t *testing.T) {
+	// Arrange
+	body := []byte(`{"mode":"partial","operations":[
+		{"op":"create","title":"new"},
+		{"op":"tag","id":2,"tags":["work"]},
+		{"op":"delete","id":2},
+		{"op":"archive","id":4}]}`)
+	c, rec := newEchoContext(http.MethodPost, "/api/notes/bulk", body)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleMember}, nil)
+	mockWorkspaces.On("GetMember", 6, 1).Return(nil, workspaces.ErrMemberNotFound)
+	mockNotes.On("GetNoteShare", 4, 1).Return((*notes.Share)(nil), notes.ErrShareNotFound)
+
+	current, other := 5, 6
+	written := &notes.Note{Id: 2, UserId: 3, WorkspaceId: &current}
+	left := &notes.Note{Id: 4, UserId: 1, WorkspaceId: &other}
+	results := []notes.BulkResult{{Id: 10}, {Id: 2}, {Id: 2}, {Id: 4}}
+	mockNotes.On("ExecuteBulk", 1, 5, mock.Anything, false, mock.Anything).Run(func(args mock.Arguments) {
+		authorize := args.Get(4).(func(*notes.Note, string) error)
+		results[1].Err = authorize(written, notes.RoleEditor)
+		results[2].Err = authorize(written, notes.RoleOwner)
+		results[3].Err = authorize(left, notes.RoleEditor)
+	}).Return(results, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.BulkNotes(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	response := decodeBulkResponse(t, rec.Body.Bytes())
+	assert.Equal(t, service.BulkStatusOK, response.Results[0].Status)
+	assert.Equal(t, service.BulkStatusOK, response.Results[1].Status)
+	assert.Equal(t, service.Forbidden, response.Results[2].Error)
+	assert.Equal(t, service.NotFound, response.Results[3].Error)
+}
+
+func TestGetDanglingLinks_ActiveWorkspace(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/links/dangling", nil)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(&workspaces.Member{WorkspaceId: 5, UserId: 1, Role: workspaces.RoleMember}, nil)
+	mockNotes.On("GetDanglingLinks", 1, 5).Return(&[]notes.DanglingLink{{SourceNoteId: 2, SourceTitle: "Plan", TargetTitle: "Budget"}}, nil)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetDanglingLinks(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockNotes.AssertExpectations(t)
+}
+
+func TestGetGraph_RemovedMember(t *testing.T) {
+	// Arrange
+	c, rec := newEchoContext(http.MethodGet, "/api/graph", nil)
+	setWorkspaceUser(c, "user@test.com", 5)
+
+	mockNotes := new(MockNotesRepository)
+	mockUsers := new(MockUsersRepository)
+	mockWorkspaces := new(MockWorkspacesRepository)
+	mockUsers.On("GetUserByEmail", "user@test.com").Return(&users.User{Id: 1}, nil)
+	mockWorkspaces.On("GetMember", 5, 1).Return(nil, workspaces.ErrMemberNotFound)
+
+	s := service.NewService(logs.NewLogger(false), mockNotes, mockUsers, service.WithWorkspaces(mockWorkspaces))
+
+	// Act
+	err := s.GetGraph(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockNotes.AssertNotCalled(t, "GetNoteGraph", mock.Anything, mock.Anything)
+}
+
+func setWorkspaceUser(c echo.Context, email string, workspaceId int) {
+	claims := &service.Claims{
+		Username:         email,
+		Workspace:        workspaceId,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: email},
+	}
+	c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+}
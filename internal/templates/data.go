@@ -0,0 +1,143 @@
+package templates
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type TemplatesRepository interface {
+	GetTemplate(id int) (*Template, error)
+	GetUserTemplates(userid int) (*[]Template, error)
+	CreateTemplate(userid int, name, title, body string) (int, error)
+	UpdateTemplate(id int, name, title, body string) error
+	DeleteTemplate(id int) error
+}
+
+var (
+	ErrTemplateNotFound = errors.New("TemplateNotFound")
+	ErrDuplicateName    = errors.New("DuplicateTemplateName")
+)
+
+const templateColumns = `id, user_id, name, title, body, created_at, updated_at`
+
+type TemplatesDbRepository struct {
+	db *sql.DB
+}
+
+func NewTemplatesDbRepository(db *sql.DB) *TemplatesDbRepository {
+	return &TemplatesDbRepository{db: db}
+}
+
+func (r *TemplatesDbRepository) GetTemplate(id int) (*Template, error) {
+	template, err := scanTemplate(r.db.QueryRow(
+		`SELECT `+templateColumns+` FROM note_templates WHERE id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+
+	return template, err
+}
+
+func (r *TemplatesDbRepository) GetUserTemplates(userid int) (*[]Template, error) {
+	templates := []Template{}
+	rows, err := r.db.Query(
+		`SELECT `+templateColumns+` FROM note_templates WHERE user_id = $1 ORDER BY name`,
+		userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+
+	return &templates, rows.Err()
+}
+
+func (r *TemplatesDbRepository) CreateTemplate(userid int, name, title, body string) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO note_templates (user_id, name, title, body) VALUES ($1, $2, $3, $4) RETURNING id`,
+		userid,
+		name,
+		title,
+		body).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicateName
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *TemplatesDbRepository) UpdateTemplate(id int, name, title, body string) error {
+	res, err := r.db.Exec(
+		`UPDATE note_templates SET name = $1, title = $2, body = $3 WHERE id = $4`,
+		name,
+		title,
+		body,
+		id)
+	if isUniqueViolation(err) {
+		return ErrDuplicateName
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+
+	return nil
+}
+
+func (r *TemplatesDbRepository) DeleteTemplate(id int) error {
+	res, err := r.db.Exec(`DELETE FROM note_templates WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row scanner) (*Template, error) {
+	var template Template
+	err := row.Scan(
+		&template.Id,
+		&template.UserId,
+		&template.Name,
+		&template.Title,
+		&template.Body,
+		&template.CreatedAt,
+		&template.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,21 @@
+package templates
+
+import "time"
+
+// Template is a note skeleton. Its title and body may contain {{variable}}
+// placeholders that are filled in when a note is created from it.
+type Template struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// In converts the timestamps of the template to the given location.
+func (t *Template) In(loc *time.Location) {
+	t.CreatedAt = t.CreatedAt.In(loc)
+	t.UpdatedAt = t.UpdatedAt.In(loc)
+}
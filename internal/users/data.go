@@ -11,8 +11,14 @@ type UsersRepository interface {
 	CreateUser(email, hashed_password string) error
 	UpdateUser(id int, email, hashedPassword string) error
 	DeleteUser(id int) error
+	UpdateUserTimeZone(id int, timeZone string) error
+	UpdateUserDailyTemplate(id int, templateId *int) error
+	GetUserByCalendarToken(tokenHash string) (*User, error)
+	UpdateUserCalendarToken(id int, tokenHash *string) error
 }
 
+const userColumns = `id, email, hashed_password, created_at, updated_at, time_zone, daily_template_id`
+
 type UsersDbRepository struct {
 	db *sql.DB
 }
@@ -22,25 +28,11 @@ func NewUsersDbRepository(db *sql.DB) *UsersDbRepository {
 }
 
 func (r *UsersDbRepository) GetUserById(id int) (*User, error) {
-	var user User
-	err := r.db.QueryRow(`SELECT * FROM users WHERE id = $1`, id).
-		Scan(&user.Id, &user.Email, &user.HashedPassword, &user.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+	return scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
 }
 
 func (r *UsersDbRepository) GetUserByEmail(email string) (*User, error) {
-	var user User
-	err := r.db.QueryRow(`SELECT * FROM users WHERE email = $1`, email).
-		Scan(&user.Id, &user.Email, &user.HashedPassword, &user.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+	return scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = $1`, email))
 }
 
 func (r *UsersDbRepository) CreateUser(email, hashed_password string) error {
@@ -81,3 +73,70 @@ func (r *UsersDbRepository) DeleteUser(id int) error {
 
 	return nil
 }
+
+func (r *UsersDbRepository) UpdateUserTimeZone(id int, timeZone string) error {
+	res, err := r.db.Exec(`UPDATE users SET time_zone = $1 WHERE id = $2`, timeZone, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("UserNotFound")
+	}
+
+	return nil
+}
+
+// UpdateUserDailyTemplate sets the template daily notes are created from.
+// A nil templateId creates them empty.
+func (r *UsersDbRepository) UpdateUserDailyTemplate(id int, templateId *int) error {
+	res, err := r.db.Exec(`UPDATE users SET daily_template_id = $1 WHERE id = $2`, templateId, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("UserNotFound")
+	}
+
+	return nil
+}
+
+func (r *UsersDbRepository) GetUserByCalendarToken(tokenHash string) (*User, error) {
+	return scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE calendar_token_hash = $1`, tokenHash))
+}
+
+// UpdateUserCalendarToken replaces the hash of the token the calendar feed
+// of the user is served with. A nil tokenHash disables the feed.
+func (r *UsersDbRepository) UpdateUserCalendarToken(id int, tokenHash *string) error {
+	res, err := r.db.Exec(`UPDATE users SET calendar_token_hash = $1 WHERE id = $2`, tokenHash, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("UserNotFound")
+	}
+
+	return nil
+}
+
+func scanUser(row *sql.Row) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.Id,
+		&user.Email,
+		&user.HashedPassword,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.TimeZone,
+		&user.DailyTemplateId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -1,8 +1,14 @@
 package users
 
+import "time"
+
 type User struct {
-	Id             int    `json:"id"`
-	Email          string `json:"email"`
-	HashedPassword string `json:"hashed_password"`
-	CreatedAt      string `json:"created_at"`
+	Id             int       `json:"id"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	TimeZone       string    `json:"time_zone"`
+
+	DailyTemplateId *int `json:"daily_template_id"`
 }
@@ -0,0 +1,364 @@
+package workspaces
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type WorkspacesRepository interface {
+	GetWorkspace(id int) (*Workspace, error)
+	GetUserWorkspaces(userid int) (*[]Workspace, error)
+	CreateWorkspace(userid int, name string) (int, error)
+	DeleteWorkspace(id int) error
+	GetMember(workspaceId, userid int) (*Member, error)
+	GetMembers(workspaceId int) (*[]Member, error)
+	UpdateMemberRole(workspaceId, userid int, role string) error
+	RemoveMember(workspaceId, userid int) error
+	GetInvitation(id int) (*Invitation, error)
+	GetWorkspaceInvitations(workspaceId int) (*[]Invitation, error)
+	GetUserInvitations(email string) (*[]Invitation, error)
+	CreateInvitation(workspaceId, invitedBy int, email, role string) (int, error)
+	RespondToInvitation(id, userid int, accept bool) error
+}
+
+var (
+	ErrWorkspaceNotFound  = errors.New("WorkspaceNotFound")
+	ErrMemberNotFound     = errors.New("MemberNotFound")
+	ErrInvitationNotFound = errors.New("InvitationNotFound")
+	ErrAlreadyInvited     = errors.New("AlreadyInvited")
+)
+
+const invitationColumns = `i.id, i.workspace_id, w.name, i.email, i.role, i.invited_by, i.status,
+	i.created_at, i.responded_at`
+
+type WorkspacesDbRepository struct {
+	db *sql.DB
+}
+
+func NewWorkspacesDbRepository(db *sql.DB) *WorkspacesDbRepository {
+	return &WorkspacesDbRepository{db: db}
+}
+
+func (r *WorkspacesDbRepository) GetWorkspace(id int) (*Workspace, error) {
+	var workspace Workspace
+	err := r.db.QueryRow(
+		`SELECT id, name, created_at, updated_at FROM workspaces WHERE id = $1`,
+		id).Scan(&workspace.Id, &workspace.Name, &workspace.CreatedAt, &workspace.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// GetUserWorkspaces lists the workspaces the user is a member of with the
+// role of the user.
+func (r *WorkspacesDbRepository) GetUserWorkspaces(userid int) (*[]Workspace, error) {
+	workspaces := []Workspace{}
+	rows, err := r.db.Query(
+		`SELECT w.id, w.name, m.role, w.created_at, w.updated_at
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.name, w.id`,
+		userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(
+			&workspace.Id,
+			&workspace.Name,
+			&workspace.Role,
+			&workspace.CreatedAt,
+			&workspace.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	return &workspaces, rows.Err()
+}
+
+// CreateWorkspace creates a workspace owned by the user.
+func (r *WorkspacesDbRepository) CreateWorkspace(userid int, name string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO workspaces (name) VALUES ($1) RETURNING id`, name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)`,
+		id,
+		userid,
+		RoleOwner)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// DeleteWorkspace deletes the workspace with its notes.
+func (r *WorkspacesDbRepository) DeleteWorkspace(id int) error {
+	res, err := r.db.Exec(`DELETE FROM workspaces WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+func (r *WorkspacesDbRepository) GetMember(workspaceId, userid int) (*Member, error) {
+	member, err := scanMember(r.db.QueryRow(
+		`SELECT m.workspace_id, m.user_id, u.email, m.role, m.created_at
+		FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1 AND m.user_id = $2`,
+		workspaceId,
+		userid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMemberNotFound
+	}
+
+	return member, err
+}
+
+func (r *WorkspacesDbRepository) GetMembers(workspaceId int) (*[]Member, error) {
+	members := []Member{}
+	rows, err := r.db.Query(
+		`SELECT m.workspace_id, m.user_id, u.email, m.role, m.created_at
+		FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1
+		ORDER BY m.created_at, m.user_id`,
+		workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+
+	return &members, rows.Err()
+}
+
+func (r *WorkspacesDbRepository) UpdateMemberRole(workspaceId, userid int, role string) error {
+	res, err := r.db.Exec(
+		`UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceId,
+		userid,
+		role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+func (r *WorkspacesDbRepository) RemoveMember(workspaceId, userid int) error {
+	res, err := r.db.Exec(
+		`DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`,
+		workspaceId,
+		userid)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+func (r *WorkspacesDbRepository) GetInvitation(id int) (*Invitation, error) {
+	invitation, err := scanInvitation(r.db.QueryRow(
+		`SELECT `+invitationColumns+`
+		FROM workspace_invitations i JOIN workspaces w ON w.id = i.workspace_id
+		WHERE i.id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+
+	return invitation, err
+}
+
+// GetWorkspaceInvitations lists the pending invitations of the workspace.
+func (r *WorkspacesDbRepository) GetWorkspaceInvitations(workspaceId int) (*[]Invitation, error) {
+	return r.queryInvitations(
+		`SELECT `+invitationColumns+`
+		FROM workspace_invitations i JOIN workspaces w ON w.id = i.workspace_id
+		WHERE i.workspace_id = $1 AND i.status = 'pending'
+		ORDER BY i.created_at, i.id`,
+		workspaceId)
+}
+
+// GetUserInvitations lists the pending invitations sent to the email.
+func (r *WorkspacesDbRepository) GetUserInvitations(email string) (*[]Invitation, error) {
+	return r.queryInvitations(
+		`SELECT `+invitationColumns+`
+		FROM workspace_invitations i JOIN workspaces w ON w.id = i.workspace_id
+		WHERE lower(i.email) = lower($1) AND i.status = 'pending'
+		ORDER BY i.created_at, i.id`,
+		email)
+}
+
+// CreateInvitation returns ErrAlreadyInvited if an invitation of the email
+// to the workspace is pending.
+func (r *WorkspacesDbRepository) CreateInvitation(workspaceId, invitedBy int, email, role string) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO workspace_invitations (workspace_id, invited_by, email, role)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		workspaceId,
+		invitedBy,
+		email,
+		role).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrAlreadyInvited
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RespondToInvitation accepts or declines the pending invitation for the
+// user. Accepting adds the user to the workspace; users that are members
+// already keep their role.
+func (r *WorkspacesDbRepository) RespondToInvitation(id, userid int, accept bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := StatusDeclined
+	if accept {
+		status = StatusAccepted
+	}
+
+	var workspaceId int
+	var role string
+	err = tx.QueryRow(
+		`UPDATE workspace_invitations SET status = $2, responded_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING workspace_id, role`,
+		id,
+		status).Scan(&workspaceId, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if accept {
+		_, err = tx.Exec(
+			`INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)
+			ON CONFLICT (workspace_id, user_id) DO NOTHING`,
+			workspaceId,
+			userid,
+			role)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *WorkspacesDbRepository) queryInvitations(query string, args ...any) (*[]Invitation, error) {
+	invitations := []Invitation{}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return &invitations, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMember(row scanner) (*Member, error) {
+	var member Member
+	err := row.Scan(
+		&member.WorkspaceId,
+		&member.UserId,
+		&member.Email,
+		&member.Role,
+		&member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func scanInvitation(row scanner) (*Invitation, error) {
+	var invitation Invitation
+	err := row.Scan(
+		&invitation.Id,
+		&invitation.WorkspaceId,
+		&invitation.WorkspaceName,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.Status,
+		&invitation.CreatedAt,
+		&invitation.RespondedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
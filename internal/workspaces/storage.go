@@ -0,0 +1,71 @@
+package workspaces
+
+import "time"
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusDeclined = "declined"
+)
+
+// Workspace is a team space whose notes belong to all its members. Role is
+// the role of the user the workspace was listed for.
+type Workspace struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// In converts the timestamps of the workspace to the given location.
+func (w *Workspace) In(loc *time.Location) {
+	w.CreatedAt = w.CreatedAt.In(loc)
+	w.UpdatedAt = w.UpdatedAt.In(loc)
+}
+
+// Member is a user of a workspace. The owner can do everything, admins
+// manage members and invitations, members work on the notes.
+type Member struct {
+	WorkspaceId int       `json:"workspace_id"`
+	UserId      int       `json:"user_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Invitation asks the user with Email to join the workspace with Role.
+type Invitation struct {
+	Id            int        `json:"id"`
+	WorkspaceId   int        `json:"workspace_id"`
+	WorkspaceName string     `json:"workspace_name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	InvitedBy     *int       `json:"invited_by"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+}
+
+// In converts the timestamps of the invitation to the given location.
+func (i *Invitation) In(loc *time.Location) {
+	i.CreatedAt = i.CreatedAt.In(loc)
+	if i.RespondedAt != nil {
+		*i.RespondedAt = i.RespondedAt.In(loc)
+	}
+}
+
+var roleRanks = map[string]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// HasRole reports whether the member has at least the given role.
+func (m *Member) HasRole(role string) bool {
+	return roleRanks[m.Role] >= roleRanks[role]
+}
@@ -0,0 +1,75 @@
+package diff_test
+
+import (
+	"NotesService/pkg/diff"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLines_Identical(t *testing.T) {
+	lines := diff.Lines("a\nb", "a\nb")
+
+	assert.Equal(t, []diff.Line{
+		{Op: diff.Equal, Text: "a"},
+		{Op: diff.Equal, Text: "b"},
+	}, lines)
+}
+
+func TestLines_InsertAndDelete(t *testing.T) {
+	lines := diff.Lines("a\nb\nc\nd", "a\nx\nc\nd\ne")
+
+	assert.Equal(t, []diff.Line{
+		{Op: diff.Equal, Text: "a"},
+		{Op: diff.Delete, Text: "b"},
+		{Op: diff.Insert, Text: "x"},
+		{Op: diff.Equal, Text: "c"},
+		{Op: diff.Equal, Text: "d"},
+		{Op: diff.Insert, Text: "e"},
+	}, lines)
+}
+
+func TestLines_FromEmpty(t *testing.T) {
+	lines := diff.Lines("", "a\nb")
+
+	assert.Equal(t, []diff.Line{
+		{Op: diff.Insert, Text: "a"},
+		{Op: diff.Insert, Text: "b"},
+	}, lines)
+}
+
+func TestLines_Reconstructs(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix"
+	b := "zero\ntwo\nfour\nfour\nsix\nseven"
+
+	var gotA, gotB []string
+	for _, line := range diff.Lines(a, b) {
+		if line.Op != diff.Insert {
+			gotA = append(gotA, line.Text)
+		}
+		if line.Op != diff.Delete {
+			gotB = append(gotB, line.Text)
+		}
+	}
+
+	assert.Equal(t, []string{"one", "two", "three", "four", "five", "six"}, gotA)
+	assert.Equal(t, []string{"zero", "two", "four", "four", "six", "seven"}, gotB)
+}
+
+func TestLines_TooDifferent(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 5000; i++ {
+		a = append(a, "a"+strconv.Itoa(i))
+		b = append(b, "b"+strconv.Itoa(i))
+	}
+
+	lines := diff.Lines("same\n"+strings.Join(a, "\n"), "same\n"+strings.Join(b, "\n"))
+
+	if assert.Len(t, lines, 10001) {
+		assert.Equal(t, diff.Line{Op: diff.Equal, Text: "same"}, lines[0])
+		assert.Equal(t, diff.Line{Op: diff.Delete, Text: "a0"}, lines[1])
+		assert.Equal(t, diff.Line{Op: diff.Insert, Text: "b0"}, lines[5001])
+	}
+}
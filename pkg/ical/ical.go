@@ -0,0 +1,132 @@
+// Package ical writes RFC 5545 iCalendar data.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineLength is the length lines are folded at, in octets.
+const maxLineLength = 75
+
+const (
+	dateTimeFormat    = "20060102T150405"
+	utcDateTimeFormat = "20060102T150405Z"
+)
+
+type Param struct {
+	Name  string
+	Value string
+}
+
+type Property struct {
+	Name   string
+	Params []Param
+	Value  string
+}
+
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []Component
+}
+
+// NewCalendar returns a VCALENDAR component identified by prodId.
+func NewCalendar(prodId string) *Component {
+	calendar := &Component{Name: "VCALENDAR"}
+	calendar.Add("VERSION", "2.0")
+	calendar.Add("PRODID", prodId)
+	calendar.Add("CALSCALE", "GREGORIAN")
+
+	return calendar
+}
+
+// Add appends a property with a value that is written as is.
+func (c *Component) Add(name, value string, params ...Param) {
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Value: value})
+}
+
+// AddText appends a TEXT property, escaping its value.
+func (c *Component) AddText(name, text string) {
+	c.Add(name, EscapeText(text))
+}
+
+// AddTime appends a DATE-TIME property. UTC times are written in UTC form,
+// other times as local times with a TZID parameter, which needs a
+// VTIMEZONE for the location in the calendar.
+func (c *Component) AddTime(name string, t time.Time) {
+	if t.Location() == time.UTC {
+		c.Add(name, t.Format(utcDateTimeFormat))
+		return
+	}
+
+	c.Add(name, t.Format(dateTimeFormat), Param{Name: "TZID", Value: t.Location().String()})
+}
+
+// Encode writes the component with CRLF line endings and folded lines.
+func (c *Component) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, property := range c.Properties {
+		var line strings.Builder
+		line.WriteString(property.Name)
+		for _, param := range property.Params {
+			line.WriteString(";" + param.Name + "=" + paramValue(param.Value))
+		}
+		line.WriteString(":" + property.Value)
+		writeLine(w, line.String())
+	}
+	for i := range c.Components {
+		c.Components[i].encode(w)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+// writeLine folds line into chunks of at most maxLineLength octets without
+// splitting UTF-8 sequences. Continuation lines start with a space.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineLength - 1
+	}
+
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// EscapeText escapes a TEXT value.
+func EscapeText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(text)
+}
+
+// paramValue quotes parameter values that contain separators.
+func paramValue(value string) string {
+	if strings.ContainsAny(value, ";:,") {
+		return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+	}
+
+	return value
+}
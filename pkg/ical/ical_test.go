@@ -0,0 +1,99 @@
+package ical_test
+
+import (
+	"NotesService/pkg/ical"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode_FoldsLongLines(t *testing.T) {
+	event := ical.Component{Name: "VEVENT"}
+	event.AddText("SUMMARY", strings.Repeat("ж", 60))
+
+	var out strings.Builder
+	err := event.Encode(&out)
+
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\r\n"), "\r\n")
+	assert.Equal(t, "BEGIN:VEVENT", lines[0])
+	assert.Equal(t, "END:VEVENT", lines[len(lines)-1])
+	var unfolded strings.Builder
+	for i, line := range lines[1 : len(lines)-1] {
+		assert.LessOrEqual(t, len(line), 75)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(line, " "))
+			line = line[1:]
+		}
+		unfolded.WriteString(line)
+	}
+	assert.Equal(t, "SUMMARY:"+strings.Repeat("ж", 60), unfolded.String())
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `a\, b\; c\\d\ne`, ical.EscapeText("a, b; c\\d\ne"))
+}
+
+func TestAddTime(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	event := ical.Component{Name: "VEVENT"}
+	event.AddTime("DTSTAMP", time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC))
+	event.AddTime("DTSTART", time.Date(2024, 3, 1, 9, 30, 0, 0, berlin))
+
+	var out strings.Builder
+	event.Encode(&out)
+
+	assert.Contains(t, out.String(), "DTSTAMP:20240301T083000Z\r\n")
+	assert.Contains(t, out.String(), "DTSTART;TZID=Europe/Berlin:20240301T093000\r\n")
+}
+
+func TestTimeZone_Daylight(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	tz := ical.TimeZone(berlin, 2024)
+
+	var out strings.Builder
+	tz.Encode(&out)
+
+	assert.Equal(t, "BEGIN:VTIMEZONE\r\n"+
+		"TZID:Europe/Berlin\r\n"+
+		"BEGIN:DAYLIGHT\r\n"+
+		"DTSTART:19700329T020000\r\n"+
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n"+
+		"TZOFFSETFROM:+0100\r\n"+
+		"TZOFFSETTO:+0200\r\n"+
+		"TZNAME:CEST\r\n"+
+		"END:DAYLIGHT\r\n"+
+		"BEGIN:STANDARD\r\n"+
+		"DTSTART:19701025T030000\r\n"+
+		"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\n"+
+		"TZOFFSETFROM:+0200\r\n"+
+		"TZOFFSETTO:+0100\r\n"+
+		"TZNAME:CET\r\n"+
+		"END:STANDARD\r\n"+
+		"END:VTIMEZONE\r\n", out.String())
+}
+
+func TestTimeZone_Fixed(t *testing.T) {
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	tz := ical.TimeZone(kolkata, 2024)
+
+	var out strings.Builder
+	tz.Encode(&out)
+
+	assert.Contains(t, out.String(), "BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\n"+
+		"TZOFFSETFROM:+0530\r\nTZOFFSETTO:+0530\r\nTZNAME:IST\r\n")
+	assert.NotContains(t, out.String(), "DAYLIGHT")
+}
+
+func TestTimeZone_SecondWeek(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	tz := ical.TimeZone(newYork, 2024)
+
+	var out strings.Builder
+	tz.Encode(&out)
+
+	assert.Contains(t, out.String(), "DTSTART:19700308T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\n")
+	assert.Contains(t, out.String(), "DTSTART:19701101T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\n")
+}
@@ -0,0 +1,155 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeZone returns a VTIMEZONE describing loc with the offsets and yearly
+// transitions in effect in the given year. Earlier rule changes of the zone
+// are not described.
+func TimeZone(loc *time.Location, year int) Component {
+	tz := Component{Name: "VTIMEZONE"}
+	tz.Add("TZID", loc.String())
+
+	transitions := yearTransitions(loc, year)
+	if len(transitions) == 0 {
+		t := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		name, offset := t.Zone()
+		observance := Component{Name: "STANDARD"}
+		observance.Add("DTSTART", "19700101T000000")
+		observance.Add("TZOFFSETFROM", formatOffset(offset))
+		observance.Add("TZOFFSETTO", formatOffset(offset))
+		observance.Add("TZNAME", name)
+		tz.Components = append(tz.Components, observance)
+		return tz
+	}
+
+	for _, transition := range transitions {
+		tz.Components = append(tz.Components, transition.observance())
+	}
+
+	return tz
+}
+
+type transition struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+	dst        bool
+}
+
+// observance describes the transition as recurring every year on the same
+// weekday of the month, starting in 1970.
+func (t transition) observance() Component {
+	name := "STANDARD"
+	if t.dst {
+		name = "DAYLIGHT"
+	}
+
+	// The onset is given in the local time before the transition.
+	onset := t.at.UTC().Add(time.Duration(t.offsetFrom) * time.Second)
+	week := (onset.Day()-1)/7 + 1
+	if onset.Day()+7 > daysIn(onset.Month(), onset.Year()) {
+		week = -1
+	}
+	weekday := weekdays[onset.Weekday()]
+
+	start := nthWeekday(1970, onset.Month(), onset.Weekday(), week)
+	start = start.Add(time.Duration(onset.Hour())*time.Hour +
+		time.Duration(onset.Minute())*time.Minute +
+		time.Duration(onset.Second())*time.Second)
+
+	observance := Component{Name: name}
+	observance.Add("DTSTART", start.Format(dateTimeFormat))
+	observance.Add("RRULE", fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", onset.Month(), week, weekday))
+	observance.Add("TZOFFSETFROM", formatOffset(t.offsetFrom))
+	observance.Add("TZOFFSETTO", formatOffset(t.offsetTo))
+	observance.Add("TZNAME", t.name)
+
+	return observance
+}
+
+var weekdays = map[time.Weekday]string{
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+	time.Sunday:    "SU",
+}
+
+// yearTransitions finds the offset changes of loc during the year.
+func yearTransitions(loc *time.Location, year int) []transition {
+	var transitions []transition
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	prev := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	_, prevOffset := prev.In(loc).Zone()
+
+	for t := prev.Add(24 * time.Hour); !t.After(end); t = t.Add(24 * time.Hour) {
+		_, offset := t.In(loc).Zone()
+		if offset != prevOffset {
+			at := findTransition(loc, prev, t)
+			name, _ := at.In(loc).Zone()
+			transitions = append(transitions, transition{
+				at:         at,
+				offsetFrom: prevOffset,
+				offsetTo:   offset,
+				name:       name,
+				dst:        at.In(loc).IsDST(),
+			})
+			prevOffset = offset
+		}
+		prev = t
+	}
+
+	return transitions
+}
+
+// findTransition returns the first second in (from, to] with the offset of to.
+func findTransition(loc *time.Location, from, to time.Time) time.Time {
+	_, target := to.In(loc).Zone()
+	for to.Sub(from) > time.Second {
+		mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+		if _, offset := mid.In(loc).Zone(); offset == target {
+			to = mid
+		} else {
+			from = mid
+		}
+	}
+
+	return to
+}
+
+// nthWeekday returns midnight of the n-th weekday of the month, counting
+// from the end for a negative n.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := time.Date(year, month, daysIn(month, year), 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -((int(last.Weekday())-int(weekday)+7)%7 + 7*(-n-1)))
+	}
+
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	hours, minutes, seconds := offset/3600, offset/60%60, offset%60
+	if seconds != 0 {
+		return fmt.Sprintf("%c%02d%02d%02d", sign, hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%c%02d%02d", sign, hours, minutes)
+}
@@ -0,0 +1,332 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+var (
+	exifHeader        = []byte("Exif\x00\x00")
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	xmpKeyword        = []byte("XML:com.adobe.xmp\x00")
+	pngSignature      = []byte("\x89PNG\r\n\x1a\n")
+
+	errInvalidJPEG = errors.New("imaging: invalid JPEG")
+	errInvalidPNG  = errors.New("imaging: invalid PNG")
+	errInvalidExif = errors.New("imaging: invalid Exif")
+)
+
+// exifTypeSizes are the sizes of the Exif field types in bytes.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// StripLocation copies the image from r to w without the location it was
+// taken at. The GPS fields of the Exif data of JPEG images are cleared,
+// keeping the other fields, and XMP metadata, which may repeat them, is
+// dropped. PNG images lose their Exif and XMP chunks. Other images are
+// copied as they are.
+func StripLocation(w io.Writer, r io.Reader, contentType string) error {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(w, bufio.NewReader(r))
+	case "image/png":
+		return stripPNG(w, r)
+	}
+
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// stripJPEG rewrites the segments in front of the image data, which is
+// copied as it is.
+func stripJPEG(w io.Writer, r *bufio.Reader) error {
+	return readJPEG(r, func(marker byte, data []byte) error {
+		if marker == 0xe1 {
+			switch {
+			case bytes.HasPrefix(data, exifHeader):
+				if clearGPS(data[len(exifHeader):]) != nil {
+					// Exif data that cannot be read may hide a location.
+					return nil
+				}
+			case bytes.HasPrefix(data, xmpHeader), bytes.HasPrefix(data, xmpExtendedHeader):
+				return nil
+			}
+		}
+
+		return writeSegment(w, marker, data)
+	}, func(rest io.Reader) error {
+		_, err := io.Copy(w, rest)
+		return err
+	})
+}
+
+// readJPEG calls segment for every segment up to the start of the image
+// data and then scan with the rest of the image, starting with its marker.
+func readJPEG(r *bufio.Reader, segment func(marker byte, data []byte) error, scan func(rest io.Reader) error) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return errInvalidJPEG
+	}
+	if err := segment(0xd8, nil); err != nil {
+		return err
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return errInvalidJPEG
+		}
+		if b != 0xff {
+			return errInvalidJPEG
+		}
+
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xff {
+			// Fill bytes.
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return errInvalidJPEG
+		}
+
+		switch {
+		case marker == 0xda || marker == 0xd9:
+			return scan(io.MultiReader(bytes.NewReader([]byte{0xff, marker}), r))
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			if err := segment(marker, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return errInvalidJPEG
+		}
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return errInvalidJPEG
+		}
+
+		data := make([]byte, size-2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return errInvalidJPEG
+		}
+		if err := segment(marker, data); err != nil {
+			return err
+		}
+	}
+}
+
+// writeSegment writes a JPEG segment. Markers without data are written
+// without a length.
+func writeSegment(w io.Writer, marker byte, data []byte) error {
+	if marker == 0xd8 || marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+		_, err := w.Write([]byte{0xff, marker})
+		return err
+	}
+
+	header := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(data)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+// stripPNG copies the chunks of a PNG image except for eXIf and XMP.
+func stripPNG(w io.Writer, r io.Reader) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return errInvalidPNG
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errInvalidPNG
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:])
+
+		drop := kind == "eXIf"
+		var start []byte
+		if kind == "iTXt" {
+			// The keyword comes first, and tells XMP apart.
+			start = make([]byte, min(length, int64(len(xmpKeyword))))
+			if _, err := io.ReadFull(r, start); err != nil {
+				return errInvalidPNG
+			}
+			drop = bytes.Equal(start, xmpKeyword)
+		}
+
+		rest := length + 4 - int64(len(start))
+		if drop {
+			if _, err := io.CopyN(io.Discard, r, rest); err != nil {
+				return errInvalidPNG
+			}
+			continue
+		}
+
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(start); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, rest); err != nil {
+			return errInvalidPNG
+		}
+		if kind == "IEND" {
+			return nil
+		}
+	}
+}
+
+// tiff reads the TIFF structure Exif data is stored in.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, errInvalidExif
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errInvalidExif
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, errInvalidExif
+	}
+
+	return t, nil
+}
+
+// ifd returns the offset of the first entry and the number of entries of
+// the image file directory at offset.
+func (t *tiff) ifd(offset uint32) (uint32, uint32, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return 0, 0, errInvalidExif
+	}
+
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	if uint64(offset)+2+uint64(count)*12 > uint64(len(t.data)) {
+		return 0, 0, errInvalidExif
+	}
+
+	return offset + 2, count, nil
+}
+
+// find returns the offset of the entry with the tag in the first image file
+// directory, or 0.
+func (t *tiff) find(tag uint16) (uint32, error) {
+	start, count, err := t.ifd(t.order.Uint32(t.data[4:]))
+	if err != nil {
+		return 0, err
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := start + i*12
+		if t.order.Uint16(t.data[entry:]) == tag {
+			return entry, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// clearGPS empties the GPS directory of the Exif data in place.
+func clearGPS(data []byte) error {
+	t, err := newTIFF(data)
+	if err != nil {
+		return err
+	}
+
+	pointer, err := t.find(tagGPSInfo)
+	if err != nil || pointer == 0 {
+		return err
+	}
+
+	offset := t.order.Uint32(data[pointer+8:])
+	start, count, err := t.ifd(offset)
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := data[start+i*12 : start+i*12+12]
+		size := exifTypeSizes[t.order.Uint16(entry[2:])] * t.order.Uint32(entry[4:])
+		if size > 4 {
+			valueOffset := uint64(t.order.Uint32(entry[8:]))
+			if valueOffset+uint64(size) > uint64(len(data)) {
+				return errInvalidExif
+			}
+			clear(data[valueOffset : valueOffset+uint64(size)])
+		}
+		clear(entry)
+	}
+
+	// An empty directory without a next one.
+	clear(data[offset : offset+2])
+	if end := uint64(offset) + 6; end <= uint64(len(data)) {
+		clear(data[offset+2 : end])
+	}
+
+	return nil
+}
+
+// orientation returns the Exif orientation of a JPEG image read from r, 1
+// if it has none. Reading stops at the image data.
+func orientation(r io.Reader) int {
+	result := 1
+	errFound := errors.New("found")
+
+	readJPEG(bufio.NewReader(r), func(marker byte, data []byte) error {
+		if marker != 0xe1 || !bytes.HasPrefix(data, exifHeader) {
+			return nil
+		}
+
+		t, err := newTIFF(data[len(exifHeader):])
+		if err != nil {
+			return nil
+		}
+		entry, err := t.find(tagOrientation)
+		if err != nil || entry == 0 {
+			return nil
+		}
+
+		if value := int(t.order.Uint16(t.data[entry+8:])); value >= 1 && value <= 8 {
+			result = value
+		}
+		return errFound
+	}, func(io.Reader) error {
+		return nil
+	})
+
+	return result
+}
@@ -0,0 +1,218 @@
+// Package imaging reads the dimensions of JPEG, PNG and GIF images, makes
+// thumbnails of them and strips the location they were taken at.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// MaxPixels bounds the size of the images thumbnails are made of, since
+// decoding an image takes memory in proportion to it.
+const MaxPixels = 25_000_000
+
+var (
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	ErrTooLarge    = errors.New("imaging: image too large")
+)
+
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// Info describes an image. Width and Height are the dimensions the image is
+// displayed with, after the rotation its Exif orientation asks for.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Supported tells whether images of the content type can be read.
+func Supported(contentType string) bool {
+	for _, supported := range contentTypes {
+		if supported == contentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DecodeConfig reads the content type and the dimensions of the image
+// without decoding it.
+func DecodeConfig(r io.Reader) (Info, error) {
+	orientation, r := readOrientation(r)
+	config, format, err := image.DecodeConfig(r)
+	if errors.Is(err, image.ErrFormat) {
+		return Info{}, ErrUnsupported
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{ContentType: contentTypes[format], Width: config.Width, Height: config.Height}
+	if orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	return info, nil
+}
+
+// Thumbnail writes a thumbnail of the image read from r that fits into a
+// square of size pixels, turned the way the image is displayed. Images are
+// never enlarged. Thumbnails of JPEG images are JPEG images, the others are
+// PNG images to keep their transparency. No metadata is kept.
+func Thumbnail(w io.Writer, r io.Reader, size int) (Info, error) {
+	orientation, r := readOrientation(r)
+
+	var head bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if errors.Is(err, image.ErrFormat) {
+		return Info{}, ErrUnsupported
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return Info{}, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return Info{}, err
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), size)
+	if orientation >= 5 {
+		width, height = fit(bounds.Dy(), bounds.Dx(), size)
+		width, height = height, width
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	thumbnail := orient(resize(rgba, width, height), orientation)
+
+	info := Info{Width: thumbnail.Bounds().Dx(), Height: thumbnail.Bounds().Dy()}
+	if format == "jpeg" {
+		info.ContentType = "image/jpeg"
+		err = jpeg.Encode(w, thumbnail, &jpeg.Options{Quality: 85})
+	} else {
+		info.ContentType = "image/png"
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(w, thumbnail)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	return info, nil
+}
+
+// readOrientation reads the Exif orientation of a JPEG image, and returns
+// a reader of the whole image.
+func readOrientation(r io.Reader) (int, io.Reader) {
+	var head bytes.Buffer
+	orientation := orientation(io.TeeReader(r, &head))
+
+	return orientation, io.MultiReader(&head, r)
+}
+
+// fit scales width and height down to fit into a square of size.
+func fit(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+
+	if width >= height {
+		return size, max(1, (height*size+width/2)/width)
+	}
+
+	return max(1, (width*size+height/2)/height), size
+}
+
+// resize scales the image to width and height, averaging the pixels each
+// pixel of the result covers.
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			pixel := dst.Pix[y*dst.Stride+x*4:]
+			for i := range sum {
+				pixel[i] = uint8((sum[i] + n/2) / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// orient turns the image the way the Exif orientation asks for.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	bounds := image.Rect(0, 0, width, height)
+	if orientation >= 5 {
+		bounds = image.Rect(0, 0, height, width)
+	}
+
+	dst := image.NewRGBA(bounds)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,180 @@
+package imaging_test
+
+import (
+	"NotesService/pkg/imaging"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var location = []byte("LOCATIONLOCATIONLOCATION")
+
+// halves returns an image red on the left and blue on the right.
+func halves(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// exif returns an APP1 segment with the orientation and a GPS latitude.
+func exif(orientation uint16) []byte {
+	be := binary.BigEndian
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+
+	// IFD0 at 8: orientation and the GPS pointer.
+	tiff = be.AppendUint16(tiff, 2)
+	tiff = be.AppendUint16(tiff, 0x0112)
+	tiff = be.AppendUint16(tiff, 3)
+	tiff = be.AppendUint32(tiff, 1)
+	tiff = be.AppendUint16(tiff, orientation)
+	tiff = be.AppendUint16(tiff, 0)
+	tiff = be.AppendUint16(tiff, 0x8825)
+	tiff = be.AppendUint16(tiff, 4)
+	tiff = be.AppendUint32(tiff, 1)
+	tiff = be.AppendUint32(tiff, 38)
+	tiff = be.AppendUint32(tiff, 0)
+
+	// GPS IFD at 38 with a latitude stored at 56.
+	tiff = be.AppendUint16(tiff, 1)
+	tiff = be.AppendUint16(tiff, 2)
+	tiff = be.AppendUint16(tiff, 5)
+	tiff = be.AppendUint32(tiff, 3)
+	tiff = be.AppendUint32(tiff, 56)
+	tiff = be.AppendUint32(tiff, 0)
+	tiff = append(tiff, location...)
+
+	data := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1}
+	segment = be.AppendUint16(segment, uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+func xmp() []byte {
+	data := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), "<x:xmpmeta>"+string(location)+"</x:xmpmeta>"...)
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+func jpegWith(t *testing.T, img image.Image, segments ...[]byte) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func TestStripLocation_JPEG(t *testing.T) {
+	data := jpegWith(t, halves(40, 20), exif(6), xmp())
+
+	var stripped bytes.Buffer
+	err := imaging.StripLocation(&stripped, bytes.NewReader(data), "image/jpeg")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, stripped.String(), string(location))
+	assert.NotContains(t, stripped.String(), "xmpmeta")
+	assert.Contains(t, stripped.String(), "Exif\x00\x00")
+
+	info, err := imaging.DecodeConfig(bytes.NewReader(stripped.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, imaging.Info{ContentType: "image/jpeg", Width: 20, Height: 40}, info)
+
+	_, err = jpeg.Decode(bytes.NewReader(stripped.Bytes()))
+	assert.NoError(t, err)
+}
+
+func TestStripLocation_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, halves(4, 4)))
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(location)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, location...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	// After the signature and the IHDR chunk.
+	data := append(append(append([]byte{}, buf.Bytes()[:33]...), chunk...), buf.Bytes()[33:]...)
+
+	var stripped bytes.Buffer
+	err := imaging.StripLocation(&stripped, bytes.NewReader(data), "image/png")
+
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), stripped.Bytes())
+}
+
+func TestStripLocation_Invalid(t *testing.T) {
+	var stripped bytes.Buffer
+	err := imaging.StripLocation(&stripped, bytes.NewReader([]byte("not a jpeg")), "image/jpeg")
+
+	assert.Error(t, err)
+}
+
+func TestThumbnail_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, halves(1000, 500)))
+
+	var thumbnail bytes.Buffer
+	info, err := imaging.Thumbnail(&thumbnail, &buf, 256)
+
+	assert.NoError(t, err)
+	assert.Equal(t, imaging.Info{ContentType: "image/png", Width: 256, Height: 128}, info)
+
+	img, err := png.Decode(&thumbnail)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 128), img.Bounds())
+}
+
+func TestThumbnail_Orientation(t *testing.T) {
+	// Turned clockwise, the red half is on top.
+	data := jpegWith(t, halves(400, 200), exif(6))
+
+	var thumbnail bytes.Buffer
+	info, err := imaging.Thumbnail(&thumbnail, bytes.NewReader(data), 256)
+
+	assert.NoError(t, err)
+	assert.Equal(t, imaging.Info{ContentType: "image/jpeg", Width: 128, Height: 256}, info)
+
+	img, err := jpeg.Decode(&thumbnail)
+	assert.NoError(t, err)
+	r, _, b, _ := img.At(64, 20).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = img.At(64, 236).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestThumbnail_NotEnlarged(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, halves(30, 20)))
+
+	var thumbnail bytes.Buffer
+	info, err := imaging.Thumbnail(&thumbnail, &buf, 256)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30, info.Width)
+	assert.Equal(t, 20, info.Height)
+}
+
+func TestThumbnail_Unsupported(t *testing.T) {
+	var thumbnail bytes.Buffer
+	_, err := imaging.Thumbnail(&thumbnail, bytes.NewReader([]byte("plain text")), 256)
+
+	assert.ErrorIs(t, err, imaging.ErrUnsupported)
+}
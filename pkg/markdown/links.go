@@ -0,0 +1,55 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wikiLink matches [[Title]] and [[Title|label]].
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|\r\n]+)(\|[^\[\]\r\n]*)?\]\]`)
+
+// WikiLinks returns the titles linked from source with [[Title]], in order
+// of appearance. Titles are compared case-insensitively, so every title is
+// returned once. Links inside fenced code blocks are ignored.
+func WikiLinks(source string) []string {
+	titles := []string{}
+	seen := map[string]bool{}
+
+	forEachLine(source, func(_, _ int, line string) {
+		for _, match := range wikiLink.FindAllStringSubmatch(line, -1) {
+			title := strings.TrimSpace(match[1])
+			key := strings.ToLower(title)
+			if title == "" || seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			titles = append(titles, title)
+		}
+	})
+
+	return titles
+}
+
+// RewriteWikiLinks points the links to the title from at the title to,
+// keeping their labels.
+func RewriteWikiLinks(source, from, to string) string {
+	from = strings.TrimSpace(from)
+	var sb strings.Builder
+	last := 0
+
+	forEachLine(source, func(_, offset int, line string) {
+		for _, match := range wikiLink.FindAllStringSubmatchIndex(line, -1) {
+			if !strings.EqualFold(strings.TrimSpace(line[match[2]:match[3]]), from) {
+				continue
+			}
+
+			sb.WriteString(source[last : offset+match[2]])
+			sb.WriteString(to)
+			last = offset + match[3]
+		}
+	})
+	sb.WriteString(source[last:])
+
+	return sb.String()
+}
@@ -0,0 +1,25 @@
+package markdown_test
+
+import (
+	"NotesService/pkg/markdown"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWikiLinks(t *testing.T) {
+	links := markdown.WikiLinks("See [[Go]] and [[ Projects | my projects]].\n" +
+		"```\n[[Not a link]]\n```\n" +
+		"Again [[go]], [[]] and [[Books]]")
+
+	assert.Equal(t, []string{"Go", "Projects", "Books"}, links)
+}
+
+func TestRewriteWikiLinks(t *testing.T) {
+	body := markdown.RewriteWikiLinks(
+		"[[Go]] and [[go|the language]], not [[Gopher]]\n```\n[[Go]]\n```\n",
+		"Go",
+		"Golang")
+
+	assert.Equal(t, "[[Golang]] and [[Golang|the language]], not [[Gopher]]\n```\n[[Go]]\n```\n", body)
+}
@@ -0,0 +1,166 @@
+// Package markdown renders CommonMark with GitHub flavoured tables and task
+// lists to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	Id    string `json:"id"`
+}
+
+type Document struct {
+	HTML string    `json:"html"`
+	TOC  []Heading `json:"toc"`
+}
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+		),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+
+	policy = newPolicy()
+)
+
+// newPolicy allows only the elements goldmark produces for markdown. Raw
+// HTML in note bodies is never passed through.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements(
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"p", "br", "hr", "em", "strong", "del", "code", "pre", "blockquote",
+		"ul", "ol", "li", "table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).
+		OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Render converts source to sanitized HTML and collects its headings.
+func Render(source string) (*Document, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(newIDs()))
+	root := md.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, root); err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		HTML: policy.Sanitize(buf.String()),
+		TOC:  headings(root, src),
+	}, nil
+}
+
+func headings(root ast.Node, src []byte) []Heading {
+	toc := []Heading{}
+	ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		toc = append(toc, Heading{
+			Level: heading.Level,
+			Text:  plainText(heading, src),
+			Id:    string(idBytes),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+
+	return toc
+}
+
+func plainText(n ast.Node, src []byte) string {
+	var sb strings.Builder
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child := child.(type) {
+		case *ast.Text:
+			sb.Write(child.Segment.Value(src))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(child.Value)
+		default:
+			sb.WriteString(plainText(child, src))
+		}
+	}
+
+	return sb.String()
+}
+
+// ids generates heading anchors. Unlike the goldmark default it keeps
+// non-latin letters, so Cyrillic headings get readable anchors.
+type ids struct {
+	used map[string]bool
+}
+
+func newIDs() parser.IDs {
+	return &ids{used: map[string]bool{}}
+}
+
+func (s *ids) Generate(value []byte, kind ast.NodeKind) []byte {
+	var sb strings.Builder
+	for _, r := range strings.TrimSpace(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(unicode.ToLower(r))
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			sb.WriteRune('-')
+		}
+	}
+
+	id := sb.String()
+	if id == "" {
+		id = "heading"
+	}
+
+	result := id
+	for i := 1; s.used[result]; i++ {
+		result = fmt.Sprintf("%s-%d", id, i)
+	}
+	s.used[result] = true
+
+	return []byte(result)
+}
+
+func (s *ids) Put(value []byte) {
+	s.used[string(value)] = true
+}
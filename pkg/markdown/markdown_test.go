@@ -0,0 +1,44 @@
+package markdown_test
+
+import (
+	"NotesService/pkg/markdown"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender_Sanitizes(t *testing.T) {
+	doc, err := markdown.Render("<script>alert(1)</script>\n\n" +
+		"[bad](javascript:alert(1)) <b onclick=\"x\">b</b> [ok](https://example.com)\n")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, doc.HTML, "<script")
+	assert.NotContains(t, doc.HTML, "javascript:")
+	assert.NotContains(t, doc.HTML, "onclick")
+	assert.NotContains(t, doc.HTML, "<b")
+	assert.Contains(t, doc.HTML,
+		`<a href="https://example.com" rel="nofollow noopener" target="_blank">ok</a>`)
+}
+
+func TestRender_GFM(t *testing.T) {
+	doc, err := markdown.Render("| a | b |\n|:-|-:|\n| 1 | 2 |\n\n- [ ] todo\n- [x] done\n\n~~old~~\n")
+
+	assert.NoError(t, err)
+	assert.Contains(t, doc.HTML, `<th align="left">a</th>`)
+	assert.Contains(t, doc.HTML, `<td align="right">2</td>`)
+	assert.Contains(t, doc.HTML, `<input disabled="" type="checkbox"> todo`)
+	assert.Contains(t, doc.HTML, `<input checked="" disabled="" type="checkbox"> done`)
+	assert.Contains(t, doc.HTML, `<del>old</del>`)
+}
+
+func TestRender_TOC(t *testing.T) {
+	doc, err := markdown.Render("# Привет мир\n\n## Setup `go`\n\n# Привет мир\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []markdown.Heading{
+		{Level: 1, Text: "Привет мир", Id: "привет-мир"},
+		{Level: 2, Text: "Setup go", Id: "setup-go"},
+		{Level: 1, Text: "Привет мир", Id: "привет-мир-1"},
+	}, doc.TOC)
+	assert.Contains(t, doc.HTML, `<h1 id="привет-мир-1">`)
+}
@@ -0,0 +1,32 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mention matches @user@example.com that does not continue a word or an
+// email address.
+var mention = regexp.MustCompile(`(?:^|[^\w.@])@([\w.%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)`)
+
+// Mentions returns the lowercased email addresses mentioned in source with
+// @email, in order of appearance and each once. Mentions inside fenced code
+// blocks are ignored.
+func Mentions(source string) []string {
+	emails := []string{}
+	seen := map[string]bool{}
+
+	forEachLine(source, func(_, _ int, line string) {
+		for _, match := range mention.FindAllStringSubmatch(line, -1) {
+			email := strings.ToLower(match[1])
+			if seen[email] {
+				continue
+			}
+
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	})
+
+	return emails
+}
@@ -0,0 +1,20 @@
+package markdown_test
+
+import (
+	"NotesService/pkg/markdown"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentions(t *testing.T) {
+	mentions := markdown.Mentions("@alice@example.com, ask (@Bob@Example.org).\n" +
+		"```\n@carol@example.com\n```\n" +
+		"Mail dave@example.com or x@y@example.com, again @bob@example.org")
+
+	assert.Equal(t, []string{"alice@example.com", "bob@example.org"}, mentions)
+}
+
+func TestMentions_None(t *testing.T) {
+	assert.Empty(t, markdown.Mentions("@ alone, @name and me@"))
+}
@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrTaskNotFound = errors.New("TaskNotFound")
+
+// Task is a GFM task list item, "- [ ] text" or "- [x] text".
+type Task struct {
+	Index   int    `json:"index"`
+	Line    int    `json:"line"`
+	Depth   int    `json:"depth"`
+	Checked bool   `json:"checked"`
+	Text    string `json:"text"`
+
+	// mark is the byte offset of the check mark in the source.
+	mark int
+}
+
+var taskItem = regexp.MustCompile(`^([ \t]*)(?:[-*+]|\d{1,9}[.)])[ \t]+\[([ xX])\](?:[ \t]+(.*?))?[ \t]*\r?$`)
+
+// Tasks returns the task list items of source in document order. Items
+// inside fenced code blocks are ignored.
+func Tasks(source string) []Task {
+	tasks := []Task{}
+	forEachLine(source, func(number, offset int, line string) {
+		match := taskItem.FindStringSubmatchIndex(line)
+		if match == nil {
+			return
+		}
+
+		text := ""
+		if match[6] >= 0 {
+			text = line[match[6]:match[7]]
+		}
+		tasks = append(tasks, Task{
+			Index:   len(tasks),
+			Line:    number,
+			Depth:   indentWidth(line[match[2]:match[3]]) / 2,
+			Checked: line[match[4]] != ' ',
+			Text:    text,
+			mark:    offset + match[4],
+		})
+	})
+
+	return tasks
+}
+
+// SetTask checks or unchecks the task with the given index and returns the
+// changed source.
+func SetTask(source string, index int, checked bool) (string, error) {
+	tasks := Tasks(source)
+	if index < 0 || index >= len(tasks) {
+		return "", ErrTaskNotFound
+	}
+
+	mark := " "
+	if checked {
+		mark = "x"
+	}
+	task := tasks[index]
+
+	return source[:task.mark] + mark + source[task.mark+1:], nil
+}
+
+func indentWidth(indent string) int {
+	width := 0
+	for _, r := range indent {
+		if r == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+
+	return width
+}
+
+var fence = regexp.MustCompile("^[ ]{0,3}(`{3,}|~{3,})")
+
+// forEachLine calls fn with the 1-based number, byte offset and text of every
+// line of source that is not part of a fenced code block.
+func forEachLine(source string, fn func(number, offset int, line string)) {
+	var open string
+	offset := 0
+
+	for i, line := range strings.SplitAfter(source, "\n") {
+		start := offset
+		offset += len(line)
+		line = strings.TrimSuffix(line, "\n")
+
+		if marker := fence.FindStringSubmatch(line); marker != nil {
+			switch {
+			case open == "":
+				open = marker[1]
+			case marker[1][0] == open[0] && len(marker[1]) >= len(open) &&
+				strings.TrimSpace(line[len(marker[0]):]) == "":
+				open = ""
+			}
+			continue
+		}
+		if open != "" {
+			continue
+		}
+
+		fn(i+1, start, line)
+	}
+}
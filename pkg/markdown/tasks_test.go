@@ -0,0 +1,55 @@
+package markdown_test
+
+import (
+	"NotesService/pkg/markdown"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const checklist = "# Todo\n" +
+	"- [ ] buy milk\n" +
+	"- [x] call mom\r\n" +
+	"```\n" +
+	"- [ ] not a task\n" +
+	"```\n" +
+	"  * [X] nested\n" +
+	"1. [ ]\n" +
+	"- [] broken\n"
+
+func TestTasks(t *testing.T) {
+	tasks := markdown.Tasks(checklist)
+
+	assert.Len(t, tasks, 4)
+	assert.Equal(t, []string{"buy milk", "call mom", "nested", ""},
+		[]string{tasks[0].Text, tasks[1].Text, tasks[2].Text, tasks[3].Text})
+	assert.Equal(t, []bool{false, true, true, false},
+		[]bool{tasks[0].Checked, tasks[1].Checked, tasks[2].Checked, tasks[3].Checked})
+	assert.Equal(t, 7, tasks[2].Line)
+	assert.Equal(t, 1, tasks[2].Depth)
+	assert.Equal(t, 3, tasks[3].Index)
+}
+
+func TestSetTask(t *testing.T) {
+	body, err := markdown.SetTask(checklist, 0, true)
+	assert.NoError(t, err)
+
+	body, err = markdown.SetTask(body, 1, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "# Todo\n"+
+		"- [x] buy milk\n"+
+		"- [ ] call mom\r\n"+
+		"```\n"+
+		"- [ ] not a task\n"+
+		"```\n"+
+		"  * [X] nested\n"+
+		"1. [ ]\n"+
+		"- [] broken\n", body)
+}
+
+func TestSetTask_NotFound(t *testing.T) {
+	_, err := markdown.SetTask(checklist, 4, true)
+
+	assert.ErrorIs(t, err, markdown.ErrTaskNotFound)
+}
@@ -0,0 +1,246 @@
+// Package notify delivers messages to users through pluggable channels.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Message struct {
+	// Event names the kind of message, e.g. "reminder".
+	Event   string
+	To      string
+	Subject string
+	Text    string
+	// Data is sent along with webhooks.
+	Data any
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+// Multi delivers a message through every notifier and reports all failures.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, message Message) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Named gives a notifier a name that stays the same across restarts, so
+// that deliveries through it can be told apart.
+type Named struct {
+	Name string
+	Notifier
+}
+
+// Channels returns the notifiers a message is delivered through. Every
+// notifier of a Multi is a channel of its own. Notifiers without a name are
+// named after their type.
+func Channels(n Notifier) []Named {
+	multi, ok := n.(Multi)
+	if !ok {
+		multi = Multi{n}
+	}
+
+	channels := make([]Named, 0, len(multi))
+	for _, notifier := range multi {
+		named, ok := notifier.(Named)
+		if !ok {
+			named = Named{Name: fmt.Sprintf("%T", notifier), Notifier: notifier}
+		}
+		channels = append(channels, named)
+	}
+
+	return channels
+}
+
+// LogNotifier writes messages to the log.
+type LogNotifier struct {
+	logger echo.Logger
+}
+
+func NewLogNotifier(logger echo.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, message Message) error {
+	n.logger.Infof("Notification %s for %s: %s", message.Event, message.To, message.Subject)
+	return nil
+}
+
+// SMTPNotifier sends messages as plain text emails. STARTTLS is used when
+// the server offers it.
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPNotifier returns a notifier sending through the server at addr.
+// Authentication is skipped when username is empty.
+func NewSMTPNotifier(addr, from, username, password string) *SMTPNotifier {
+	notifier := &SMTPNotifier{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		notifier.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return notifier
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, message Message) error {
+	if message.To == "" {
+		return nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(n.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.email(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (n *SMTPNotifier) email(message Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return b.Bytes()
+}
+
+// WebhookNotifier posts messages as JSON. With a secret the body is signed
+// with HMAC-SHA256 in the X-Signature header.
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url, secret string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type webhookPayload struct {
+	Event   string `json:"event"`
+	To      string `json:"to,omitempty"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, message Message) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:   message.Event,
+		To:      message.To,
+		Subject: message.Subject,
+		Text:    message.Text,
+		Data:    message.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if n.secret != "" {
+		req.Header.Set("X-Signature", "sha256="+Sign(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", n.url, resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package notify_test
+
+import (
+	"NotesService/pkg/notify"
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+	}))
+	defer server.Close()
+
+	notifier := notify.NewWebhookNotifier(server.URL, "secret", time.Second)
+	err := notifier.Notify(context.Background(), notify.Message{
+		Event:   "reminder",
+		Subject: "Standup",
+		Data:    map[string]int{"note_id": 1},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256="+notify.Sign("secret", body), signature)
+
+	var payload map[string]any
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "reminder", payload["event"])
+	assert.Equal(t, map[string]any{"note_id": float64(1)}, payload["data"])
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	notifier := notify.NewWebhookNotifier(server.URL, "", time.Second)
+	err := notifier.Notify(context.Background(), notify.Message{Event: "reminder"})
+
+	assert.Error(t, err)
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(listener, received)
+
+	notifier := notify.NewSMTPNotifier(listener.Addr().String(), "notes@example.com", "", "")
+	err = notifier.Notify(context.Background(), notify.Message{
+		To:      "user@example.com",
+		Subject: "Reminder: Standup",
+		Text:    "line one\nline two",
+	})
+	assert.NoError(t, err)
+
+	commands := <-received
+	assert.Contains(t, commands, "MAIL FROM:<notes@example.com>")
+	assert.Contains(t, commands, "RCPT TO:<user@example.com>")
+	assert.Contains(t, commands, "To: user@example.com")
+	assert.Contains(t, commands, "Subject: Reminder: Standup")
+	assert.Contains(t, commands, "line two")
+}
+
+// serveSMTP accepts a single connection and speaks just enough SMTP to
+// receive one message. Every line the client sent is reported.
+func serveSMTP(listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var lines []string
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		switch {
+		case data && line == ".":
+			data = false
+			reply("250 OK")
+		case data:
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250 localhost")
+		case line == "DATA":
+			data = true
+			reply("354 Go ahead")
+		case line == "QUIT":
+			reply("221 Bye")
+			received <- lines
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+	received <- lines
+}
+
+func TestChannels(t *testing.T) {
+	webhook := notify.NewWebhookNotifier("http://localhost", "", time.Second)
+	channels := notify.Channels(notify.Multi{
+		notify.Named{Name: "webhook", Notifier: webhook},
+		notify.NewLogNotifier(nil),
+	})
+
+	if assert.Len(t, channels, 2) {
+		assert.Equal(t, "webhook", channels[0].Name)
+		assert.Equal(t, "*notify.LogNotifier", channels[1].Name)
+	}
+	assert.Equal(t, "*notify.WebhookNotifier", notify.Channels(webhook)[0].Name)
+}
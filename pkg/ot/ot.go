@@ -0,0 +1,372 @@
+// Package ot implements operational transformation of plain text.
+//
+// An Operation walks over a document and retains, inserts or deletes text.
+// Lengths and positions count Unicode code points. On the wire an operation
+// is a JSON array in which a positive number retains, a negative number
+// deletes and a string inserts, e.g. [3, "abc", -2, 5].
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var (
+	ErrBaseLength   = errors.New("operation does not match the document length")
+	ErrInvalid      = errors.New("invalid operation")
+	ErrIncompatible = errors.New("operations cannot be combined")
+)
+
+type kind int
+
+const (
+	retainOp kind = iota
+	insertOp
+	deleteOp
+)
+
+type component struct {
+	kind kind
+	n    int
+	text string
+}
+
+// Operation transforms a document of BaseLen code points into one of
+// TargetLen code points. The zero value is the empty operation on the empty
+// document.
+type Operation struct {
+	components []component
+	baseLen    int
+	targetLen  int
+}
+
+func New() *Operation {
+	return &Operation{}
+}
+
+// BaseLen is the length of the documents the operation applies to.
+func (o *Operation) BaseLen() int {
+	return o.baseLen
+}
+
+// TargetLen is the length of the documents the operation produces.
+func (o *Operation) TargetLen() int {
+	return o.targetLen
+}
+
+// IsNoop reports whether the operation leaves documents unchanged.
+func (o *Operation) IsNoop() bool {
+	return len(o.components) == 0 ||
+		len(o.components) == 1 && o.components[0].kind == retainOp
+}
+
+// Retain skips over n code points.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+
+	o.baseLen += n
+	o.targetLen += n
+	if last := o.last(); last != nil && last.kind == retainOp {
+		last.n += n
+	} else {
+		o.components = append(o.components, component{kind: retainOp, n: n})
+	}
+
+	return o
+}
+
+// Insert inserts text at the current position. Inserts are kept in front
+// of deletes at the same position, so equal edits have one representation.
+func (o *Operation) Insert(text string) *Operation {
+	if text == "" {
+		return o
+	}
+
+	n := utf8.RuneCountInString(text)
+	o.targetLen += n
+	last := o.last()
+	switch {
+	case last != nil && last.kind == insertOp:
+		last.text += text
+		last.n += n
+	case last != nil && last.kind == deleteOp:
+		i := len(o.components) - 1
+		if i > 0 && o.components[i-1].kind == insertOp {
+			o.components[i-1].text += text
+			o.components[i-1].n += n
+		} else {
+			deletion := *last
+			o.components[i] = component{kind: insertOp, n: n, text: text}
+			o.components = append(o.components, deletion)
+		}
+	default:
+		o.components = append(o.components, component{kind: insertOp, n: n, text: text})
+	}
+
+	return o
+}
+
+// Delete deletes n code points at the current position.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+
+	o.baseLen += n
+	if last := o.last(); last != nil && last.kind == deleteOp {
+		last.n += n
+	} else {
+		o.components = append(o.components, component{kind: deleteOp, n: n})
+	}
+
+	return o
+}
+
+func (o *Operation) last() *component {
+	if len(o.components) == 0 {
+		return nil
+	}
+
+	return &o.components[len(o.components)-1]
+}
+
+// Apply applies the operation to doc.
+func (o *Operation) Apply(doc string) (string, error) {
+	text := []rune(doc)
+	if len(text) != o.baseLen {
+		return "", ErrBaseLength
+	}
+
+	result := make([]rune, 0, o.targetLen)
+	pos := 0
+	for _, c := range o.components {
+		switch c.kind {
+		case retainOp:
+			result = append(result, text[pos:pos+c.n]...)
+			pos += c.n
+		case insertOp:
+			result = append(result, []rune(c.text)...)
+		case deleteOp:
+			pos += c.n
+		}
+	}
+
+	return string(result), nil
+}
+
+// Transform transforms the concurrent operations a and b, which apply to the
+// same document, into a' and b' such that applying a and then b' gives the
+// same document as applying b and then a'. Text inserted by a at the same
+// position as text inserted by b comes first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, ErrIncompatible
+	}
+
+	aPrime, bPrime := New(), New()
+	as, bs := a.components, b.components
+	var x, y *component
+	for {
+		if x == nil && len(as) > 0 {
+			x, as = &component{kind: as[0].kind, n: as[0].n, text: as[0].text}, as[1:]
+		}
+		if y == nil && len(bs) > 0 {
+			y, bs = &component{kind: bs[0].kind, n: bs[0].n, text: bs[0].text}, bs[1:]
+		}
+		if x == nil && y == nil {
+			break
+		}
+
+		if x != nil && x.kind == insertOp {
+			aPrime.Insert(x.text)
+			bPrime.Retain(x.n)
+			x = nil
+			continue
+		}
+		if y != nil && y.kind == insertOp {
+			aPrime.Retain(y.n)
+			bPrime.Insert(y.text)
+			y = nil
+			continue
+		}
+		if x == nil || y == nil {
+			return nil, nil, ErrIncompatible
+		}
+
+		n := min(x.n, y.n)
+		switch {
+		case x.kind == retainOp && y.kind == retainOp:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case x.kind == deleteOp && y.kind == retainOp:
+			aPrime.Delete(n)
+		case x.kind == retainOp && y.kind == deleteOp:
+			bPrime.Delete(n)
+		}
+		// Text deleted by both needs no deletion afterwards.
+
+		if x.n -= n; x.n == 0 {
+			x = nil
+		}
+		if y.n -= n; y.n == 0 {
+			y = nil
+		}
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// Compose combines a and b, where b applies to the documents produced by a,
+// into one operation with the effect of both.
+func Compose(a, b *Operation) (*Operation, error) {
+	if a.targetLen != b.baseLen {
+		return nil, ErrIncompatible
+	}
+
+	result := New()
+	as, bs := a.components, b.components
+	var x, y *component
+	for {
+		if x == nil && len(as) > 0 {
+			x, as = &component{kind: as[0].kind, n: as[0].n, text: as[0].text}, as[1:]
+		}
+		if y == nil && len(bs) > 0 {
+			y, bs = &component{kind: bs[0].kind, n: bs[0].n, text: bs[0].text}, bs[1:]
+		}
+		if x == nil && y == nil {
+			break
+		}
+
+		if x != nil && x.kind == deleteOp {
+			result.Delete(x.n)
+			x = nil
+			continue
+		}
+		if y != nil && y.kind == insertOp {
+			result.Insert(y.text)
+			y = nil
+			continue
+		}
+		if x == nil || y == nil {
+			return nil, ErrIncompatible
+		}
+
+		n := min(x.n, y.n)
+		switch {
+		case x.kind == retainOp && y.kind == retainOp:
+			result.Retain(n)
+		case x.kind == retainOp && y.kind == deleteOp:
+			result.Delete(n)
+		case x.kind == insertOp && y.kind == retainOp:
+			result.Insert(string([]rune(x.text)[:n]))
+		}
+		// Text inserted by a and deleted by b cancels out.
+
+		if x.kind == insertOp {
+			x.text = string([]rune(x.text)[n:])
+		}
+		if x.n -= n; x.n == 0 {
+			x = nil
+		}
+		if y.n -= n; y.n == 0 {
+			y = nil
+		}
+	}
+
+	return result, nil
+}
+
+// TransformIndex moves the position index in a document to where it is
+// after applying the operation, e.g. to keep a cursor in place.
+func (o *Operation) TransformIndex(index int) int {
+	moved := index
+	for _, c := range o.components {
+		switch c.kind {
+		case retainOp:
+			index -= c.n
+		case insertOp:
+			moved += c.n
+		case deleteOp:
+			moved -= min(index, c.n)
+			index -= c.n
+		}
+		if index < 0 {
+			break
+		}
+	}
+
+	return moved
+}
+
+// Diff returns an operation turning from into to by replacing the text
+// between their common prefix and suffix.
+func Diff(from, to string) *Operation {
+	a, b := []rune(from), []rune(to)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return New().
+		Retain(prefix).
+		Insert(string(b[prefix : len(b)-suffix])).
+		Delete(len(a) - prefix - suffix).
+		Retain(suffix)
+}
+
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	list := make([]any, 0, len(o.components))
+	for _, c := range o.components {
+		switch c.kind {
+		case retainOp:
+			list = append(list, c.n)
+		case insertOp:
+			list = append(list, c.text)
+		case deleteOp:
+			list = append(list, -c.n)
+		}
+	}
+
+	return json.Marshal(list)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, raw := range list {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			if text == "" || !utf8.ValidString(text) {
+				return ErrInvalid
+			}
+			o.Insert(text)
+			continue
+		}
+
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil || n == 0 {
+			return fmt.Errorf("%w: %s", ErrInvalid, raw)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+
+	return nil
+}
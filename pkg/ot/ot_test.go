@@ -0,0 +1,172 @@
+package ot_test
+
+import (
+	"NotesService/pkg/ot"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	op := ot.New().Retain(6).Delete(5).Insert("Gopher").Retain(1)
+
+	doc, err := op.Apply("Hello world!")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello Gopher!", doc)
+}
+
+func TestApply_BaseLength(t *testing.T) {
+	_, err := ot.New().Retain(3).Apply("four")
+
+	assert.ErrorIs(t, err, ot.ErrBaseLength)
+}
+
+func TestApply_Unicode(t *testing.T) {
+	doc, err := ot.New().Retain(1).Delete(1).Insert("ü").Retain(3).Apply("Größe")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Güöße", doc)
+}
+
+func TestTransform_SamePosition(t *testing.T) {
+	a := ot.New().Retain(2).Insert("A").Retain(2)
+	b := ot.New().Retain(2).Insert("B").Retain(2)
+
+	aPrime, bPrime, err := ot.Transform(a, b)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	left := apply(t, apply(t, "abcd", a), bPrime)
+	right := apply(t, apply(t, "abcd", b), aPrime)
+	assert.Equal(t, "abABcd", left)
+	assert.Equal(t, left, right)
+}
+
+func TestTransform_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		doc := randomText(r, r.Intn(20))
+		a, b := randomOperation(r, doc), randomOperation(r, doc)
+
+		aPrime, bPrime, err := ot.Transform(a, b)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, apply(t, apply(t, doc, a), bPrime), apply(t, apply(t, doc, b), aPrime))
+	}
+}
+
+func TestCompose_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		doc := randomText(r, r.Intn(20))
+		a := randomOperation(r, doc)
+		b := randomOperation(r, apply(t, doc, a))
+
+		ab, err := ot.Compose(a, b)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, apply(t, apply(t, doc, a), b), apply(t, doc, ab))
+	}
+}
+
+func TestTransform_Incompatible(t *testing.T) {
+	_, _, err := ot.Transform(ot.New().Retain(2), ot.New().Retain(3))
+
+	assert.ErrorIs(t, err, ot.ErrIncompatible)
+}
+
+func TestTransformIndex(t *testing.T) {
+	op := ot.New().Retain(2).Insert("xyz").Delete(2).Retain(3)
+
+	assert.Equal(t, 1, op.TransformIndex(1))
+	assert.Equal(t, 5, op.TransformIndex(2))
+	assert.Equal(t, 5, op.TransformIndex(3))
+	assert.Equal(t, 6, op.TransformIndex(5))
+}
+
+func TestDiff(t *testing.T) {
+	op := ot.Diff("The quick fox", "The quick brown fox")
+
+	assert.Equal(t, "The quick brown fox", apply(t, "The quick fox", op))
+	assert.Equal(t, `[10,"brown ",3]`, marshal(t, op))
+}
+
+func TestJSON(t *testing.T) {
+	var op ot.Operation
+	assert.NoError(t, json.Unmarshal([]byte(`[3,"ab",-2,1]`), &op))
+
+	assert.Equal(t, 6, op.BaseLen())
+	assert.Equal(t, 6, op.TargetLen())
+	assert.Equal(t, `[3,"ab",-2,1]`, marshal(t, &op))
+}
+
+func TestJSON_InsertBeforeDelete(t *testing.T) {
+	var op ot.Operation
+	assert.NoError(t, json.Unmarshal([]byte(`[-2,"ab"]`), &op))
+
+	assert.Equal(t, `["ab",-2]`, marshal(t, &op))
+}
+
+func TestJSON_Invalid(t *testing.T) {
+	for _, data := range []string{`[0]`, `[""]`, `[true]`, `{"retain":1}`, `[1.5]`} {
+		var op ot.Operation
+		assert.Error(t, json.Unmarshal([]byte(data), &op), data)
+	}
+}
+
+func apply(t *testing.T, doc string, op *ot.Operation) string {
+	t.Helper()
+	result, err := op.Apply(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func marshal(t *testing.T, op *ot.Operation) string {
+	t.Helper()
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func randomText(r *rand.Rand, n int) string {
+	letters := []rune("abcdé🙂 ")
+	text := make([]rune, n)
+	for i := range text {
+		text[i] = letters[r.Intn(len(letters))]
+	}
+	return string(text)
+}
+
+func randomOperation(r *rand.Rand, doc string) *ot.Operation {
+	op := ot.New()
+	left := len([]rune(doc))
+	for left > 0 {
+		n := 1 + r.Intn(left)
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+			left -= n
+		case 1:
+			op.Delete(n)
+			left -= n
+		default:
+			op.Insert(randomText(r, 1+r.Intn(4)))
+		}
+	}
+	if r.Intn(2) == 0 {
+		op.Insert(randomText(r, 1+r.Intn(4)))
+	}
+	return op
+}
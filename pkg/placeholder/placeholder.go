@@ -0,0 +1,19 @@
+// Package placeholder fills {{name}} placeholders in text.
+package placeholder
+
+import "regexp"
+
+var placeholder = regexp.MustCompile(`\{\{\s*([\p{L}\p{N}_.-]+)\s*\}\}`)
+
+// Expand replaces every {{name}} in text with vars[name]. Names are case
+// sensitive. Placeholders without a value are left as they are.
+func Expand(text string, vars map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+
+		return match
+	})
+}
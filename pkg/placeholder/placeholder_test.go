@@ -0,0 +1,27 @@
+package placeholder_test
+
+import (
+	"NotesService/pkg/placeholder"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	text := placeholder.Expand(
+		"# {{title}} {{ date }}\n{{attendees}} {{unknown}} {{дата}}",
+		map[string]string{
+			"title":     "Standup",
+			"date":      "2024-05-01",
+			"attendees": "Ann, Bob",
+			"дата":      "1 мая",
+		})
+
+	assert.Equal(t, "# Standup 2024-05-01\nAnn, Bob {{unknown}} 1 мая", text)
+}
+
+func TestExpand_NoRecursion(t *testing.T) {
+	text := placeholder.Expand("{{a}}", map[string]string{"a": "{{b}}", "b": "x"})
+
+	assert.Equal(t, "{{b}}", text)
+}